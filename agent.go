@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/mmmorris1975/aws-runas/lib/agent"
+	"github.com/mmmorris1975/aws-runas/lib/config"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// number of times the user is prompted for an MFA code the agent accepts, before giving up
+const agentMfaAttempts = 3
+
+func agentHandler() {
+	if *agentFgFlag {
+		runAgent()
+	} else {
+		startAgent()
+	}
+}
+
+// runAgent runs the credential agent until it gets an interrupt or termination signal
+func runAgent() {
+	p := agent.NewProfileProvider(func(p *agent.ProfileProvider) { p.StateDir = cacheDir() }).WithLogger(log)
+	s := agent.NewServer(agent.SocketPath(), p).WithLogger(log)
+
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		log.Debugf("Got signal: %s", sig.String())
+		if err := s.Close(); err != nil {
+			log.Debugf("Error stopping agent: %v", err)
+		}
+	}()
+
+	if err := s.ListenAndServe(); err != nil {
+		log.Fatalf("Error running credential agent: %v", err)
+	}
+}
+
+// startAgent starts the credential agent as a background process, and prints the environment variables used to find
+// the agent, in the format of the --output option, so the output can be eval()'d, like ssh-agent
+func startAgent() {
+	path := agent.SocketPath()
+	c := agent.NewClient(path)
+	c.Timeout = 1 * time.Second
+	if err := c.Ping(); err == nil {
+		log.Fatalf("A credential agent is already running, listening on %s", path)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Error starting credential agent: %v", err)
+	}
+
+	args := []string{"--agent-foreground"}
+	if *verbose {
+		args = append(args, "--verbose")
+	}
+
+	a := exec.Command(exe, args...)
+	a.Env = append(os.Environ(), fmt.Sprintf("%s=%s", agent.SocketEnvVar, path))
+	agent.Detach(a)
+
+	if err := a.Start(); err != nil {
+		log.Fatalf("Error starting credential agent: %v", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- a.Wait() }()
+
+	for c.Ping() != nil {
+		select {
+		case err := <-exited:
+			log.Fatalf("Credential agent exited: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	lineFmt := envLineFormat(*outputFormat)
+	fmt.Printf(lineFmt, agent.SocketEnvVar, path)
+	fmt.Printf(lineFmt, agent.PidEnvVar, strconv.Itoa(a.Process.Pid))
+}
+
+// useAgent returns true if a credential agent was started for this shell, and the requested operation gets credentials
+func useAgent() bool {
+	if _, ok := os.LookupEnv(agent.SocketEnvVar); !ok {
+		return false
+	}
+
+	return !(*listRoles || *listMfa || *makeConf || *writeConf || *updateFlag || *diagFlag || *ec2MdFlag ||
+		*ecsMdFlag || *listCache || len(*purgeCache) > 0)
+}
+
+// agentCredentials gets the credentials for the profile from the credential agent, and runs the command (or prints the
+// credentials).  False is returned if the agent can't provide the credentials, so they must be looked up without the
+// agent.
+func agentCredentials() bool {
+	p := &agentProvider{client: agent.NewClient(agent.SocketPath()), req: &agent.Request{Profile: *profile,
+		Session: *sesCreds, Refresh: *refresh, MfaSerial: *mfaArn, SessionDuration: *duration, RoleDuration: *roleDuration}}
+
+	res, err := p.request()
+	if err != nil {
+		log.Debugf("Credential agent error, not using agent: %v", err)
+		return false
+	}
+	p.res = res
+
+	// later requests (from the --auto-refresh endpoint) get the credentials held by the agent
+	p.req.Refresh = false
+
+	cfg = &config.AwsConfig{Region: res.Region}
+	if *showExpire {
+		printExpiration(time.Unix(res.Expiration, 0))
+	}
+
+	handleCredentials(credentials.NewCredentials(p))
+	return true
+}
+
+// agentProvider is the AWS credentials.Provider getting credentials from the credential agent
+type agentProvider struct {
+	credentials.Expiry
+	client *agent.Client
+	req    *agent.Request
+	res    *agent.Response
+}
+
+// Retrieve implements the AWS credentials.Provider interface to return the credentials from the agent.  The agent
+// refreshes the credentials before they expire, so they're only fetched again when they expire.
+func (p *agentProvider) Retrieve() (credentials.Value, error) {
+	res := p.res
+	p.res = nil
+
+	if res == nil {
+		var err error
+		if res, err = p.request(); err != nil {
+			return credentials.Value{}, err
+		}
+	}
+
+	p.SetExpiration(time.Unix(res.Expiration, 0), 0)
+	return res.Value(), nil
+}
+
+// request sends the request to the agent.  If the user has an MFA device, and the agent needs an MFA code to get the
+// credentials, the code is requested from the MFA token provider configured for the profile's device.
+func (p *agentProvider) request() (*agent.Response, error) {
+	defer func() { p.req.TokenCode = "" }()
+
+	for i := 0; i < agentMfaAttempts; i++ {
+		res, err := p.client.Credentials(p.req)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.MfaRequired {
+			if p.req.TokenCode, err = newTokenProvider(p.mfaConfig())(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if len(res.Error) > 0 {
+			return nil, fmt.Errorf("%s", res.Error)
+		}
+		return res, nil
+	}
+
+	return nil, fmt.Errorf("invalid MFA code")
+}
+
+// mfaConfig returns the MFA token provider configuration for the MFA device of the requested profile, resolved the same
+// way as the agent resolves it, so the client prompts for the code using the configured token provider
+func (p *agentProvider) mfaConfig() *config.AwsConfig {
+	r, err := config.NewConfigResolver(&config.AwsConfig{MfaSerial: p.req.MfaSerial})
+	if err != nil {
+		log.Debugf("Error loading config file: %v", err)
+		return new(config.AwsConfig)
+	}
+
+	c, err := r.WithLogger(log).ResolveConfig(p.req.Profile)
+	if err != nil {
+		log.Debugf("Error resolving profile %s: %v", p.req.Profile, err)
+		return new(config.AwsConfig)
+	}
+	return c.MfaDeviceConfig(c.MfaSerial)
+}
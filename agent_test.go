@@ -0,0 +1,125 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/mmmorris1975/aws-runas/lib/agent"
+	"github.com/mmmorris1975/aws-runas/lib/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUseAgent(t *testing.T) {
+	t.Run("no agent", func(t *testing.T) {
+		if useAgent() {
+			t.Error("agent used without socket env var")
+		}
+	})
+
+	os.Setenv(agent.SocketEnvVar, "agent.sock")
+	defer os.Unsetenv(agent.SocketEnvVar)
+
+	t.Run("agent", func(t *testing.T) {
+		if !useAgent() {
+			t.Error("agent not used")
+		}
+	})
+
+	t.Run("list roles", func(t *testing.T) {
+		*listRoles = true
+		defer func() { *listRoles = false }()
+
+		if useAgent() {
+			t.Error("agent used to list roles")
+		}
+	})
+}
+
+func TestAgentCredentials(t *testing.T) {
+	d, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(d)
+
+	path := filepath.Join(d, agent.SocketName)
+	os.Setenv(agent.SocketEnvVar, path)
+	defer os.Unsetenv(agent.SocketEnvVar)
+
+	origCfg := cfg
+	defer func() { cfg = origCfg }()
+
+	t.Run("no agent", func(t *testing.T) {
+		if agentCredentials() {
+			t.Error("credentials returned without agent")
+		}
+	})
+
+	s := agent.NewServer(path, new(mockAgentProvider))
+	go s.ListenAndServe()
+	defer s.Close()
+
+	for i := 0; agent.NewClient(path).Ping() != nil; i++ {
+		if i > 50 {
+			t.Error("agent did not start")
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Run("good", func(t *testing.T) {
+		defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+		defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+		defer os.Unsetenv(config.RegionEnvVar)
+		defer os.Unsetenv(config.DefaultRegionEnvVar)
+
+		if !agentCredentials() {
+			t.Error("credentials not returned from agent")
+			return
+		}
+
+		if os.Getenv("AWS_ACCESS_KEY_ID") != "AKIAAGENT" || cfg.Region != "us-west-2" {
+			t.Error("agent credentials not used")
+		}
+	})
+}
+
+func TestAgentProvider_MfaConfig(t *testing.T) {
+	os.Setenv("AWS_CONFIG_FILE", "lib/config/test/config_chain")
+	defer os.Setenv("AWS_CONFIG_FILE", ".aws/config")
+
+	t.Run("device config", func(t *testing.T) {
+		p := &agentProvider{req: &agent.Request{Profile: "multimfa", MfaSerial: "arn:aws:iam::123456789012:mfa/yubikey"}}
+
+		c := p.mfaConfig()
+		if c.MfaTokenProvider != "command" || c.MfaTokenCommand != "ykman oath accounts code -s aws" {
+			t.Error("device token provider not used")
+		}
+	})
+
+	t.Run("bad profile", func(t *testing.T) {
+		p := &agentProvider{req: &agent.Request{Profile: "not-a-profile"}}
+		if c := p.mfaConfig(); len(c.MfaTokenProvider) > 0 {
+			t.Error("unexpected token provider")
+		}
+	})
+}
+
+func TestEnvLineFormat(t *testing.T) {
+	if envLineFormat(fishOutput) != "set -gx %s '%s';\n" {
+		t.Error("bad fish format")
+	}
+
+	if envLineFormat(envOutput) != "%s=%s\n" {
+		t.Error("bad env format")
+	}
+}
+
+type mockAgentProvider struct{}
+
+func (p *mockAgentProvider) Credentials(r *agent.Request) (*credentials.Credentials, string, error) {
+	return credentials.NewStaticCredentials("AKIAAGENT", "AgentSecret", ""), "us-west-2", nil
+}
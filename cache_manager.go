@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/mmmorris1975/aws-runas/lib/cache"
+	"github.com/mmmorris1975/aws-runas/lib/config"
+	"io"
+	"os"
+	"regexp"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	purgeExpired = "expired"
+	purgeAll     = "all"
+)
+
+// cache files for role ARN profiles are named <account id>-<role name>
+var arnProfileRe = regexp.MustCompile(`^(\d{12})-(.+)$`)
+
+// cacheEntryOutput adds the remaining credential lifetime to the JSON output of a cache entry
+type cacheEntryOutput struct {
+	*cache.CacheEntry
+	Remaining int64 `json:"remaining_seconds"`
+}
+
+func cacheHandler() {
+	// The metadata service keeps its session token cache files in the same directory
+	entries, err := cache.FindCacheEntries(cacheOptions(), cacheDir())
+	if err != nil {
+		log.Fatalf("Error finding cached credentials: %v", err)
+	}
+	resolveCacheRoleArns(entries)
+
+	if len(*purgeCache) > 0 {
+		for _, e := range purgeCacheEntries(entries, *purgeCache) {
+			log.Infof("Removed cached %s credentials for %s", e.Type, e.Profile)
+		}
+		return
+	}
+
+	if err := printCacheEntries(entries, os.Stdout, *listFormat); err != nil {
+		log.Fatalf("Error printing cached credentials: %v", err)
+	}
+}
+
+// the role ARN isn't stored with the cached credentials, look it up using the profile the cache file is named after
+func resolveCacheRoleArns(entries []*cache.CacheEntry) {
+	r, err := config.NewConfigResolver(nil)
+	if err != nil {
+		log.Debugf("Error loading config file: %v", err)
+		return
+	}
+
+	for _, e := range entries {
+		if e.Type != cache.AssumeRoleEntryType {
+			continue
+		}
+
+		if c, err := r.ResolveProfileConfig(e.Profile); err == nil && len(c.RoleArn) > 0 {
+			e.RoleArn = c.RoleArn
+		} else if m := arnProfileRe.FindStringSubmatch(e.Profile); m != nil {
+			// role ARN used as the profile, any role path is not part of the cache file name
+			e.RoleArn = arn.ARN{Partition: "aws", Service: "iam", AccountID: m[1], Resource: "role/" + m[2]}.String()
+		}
+	}
+}
+
+// purgeCacheEntries removes the entries selected by which, the value 'expired' selects entries with expired
+// credentials, 'all' selects every entry, any other value selects the entries for the profile with that name.
+// The list of removed entries is returned.
+func purgeCacheEntries(entries []*cache.CacheEntry, which string) []*cache.CacheEntry {
+	removed := make([]*cache.CacheEntry, 0)
+
+	for _, e := range entries {
+		switch which {
+		case purgeAll:
+		case purgeExpired:
+			if !e.IsExpired() {
+				continue
+			}
+		default:
+			if e.Profile != which {
+				continue
+			}
+		}
+
+		if err := e.Remove(); err != nil {
+			log.Errorf("Error removing cache file %s: %v", e.Path, err)
+			continue
+		}
+		removed = append(removed, e)
+	}
+
+	return removed
+}
+
+func printCacheEntries(entries []*cache.CacheEntry, w io.Writer, format string) error {
+	if format == "json" {
+		out := make([]*cacheEntryOutput, 0)
+		for _, e := range entries {
+			o := &cacheEntryOutput{CacheEntry: e}
+			if !e.IsExpired() {
+				o.Remaining = int64(e.Remaining().Seconds())
+			}
+			out = append(out, o)
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROFILE\tTYPE\tROLE ARN\tPROVIDER\tEXPIRATION\tREMAINING")
+	for _, e := range entries {
+		exp := "unknown"
+		rem := "unknown"
+		if e.Readable {
+			exp = e.Expiration.Format("2006-01-02 15:04:05")
+			rem = "expired"
+			if !e.IsExpired() {
+				rem = e.Remaining().Round(time.Second).String()
+			}
+		}
+
+		prov := e.Provider
+		if e.Encrypted && !e.Readable {
+			prov = "(encrypted)"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Profile, e.Type, dashIfEmpty(e.RoleArn), dashIfEmpty(prov), exp, rem)
+	}
+	return tw.Flush()
+}
+
+func dashIfEmpty(s string) string {
+	if len(s) < 1 {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/mmmorris1975/aws-runas/lib/cache"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func cacheTestEntries(d string) []*cache.CacheEntry {
+	os.MkdirAll(d, 0755)
+	ioutil.WriteFile(filepath.Join(d, ".aws_assume_role_a"), []byte("{}"), 0600)
+	ioutil.WriteFile(filepath.Join(d, ".aws_session_token_b"), []byte("{}"), 0600)
+	ioutil.WriteFile(filepath.Join(d, ".aws_assume_role_c"), []byte("{}"), 0600)
+
+	return []*cache.CacheEntry{
+		{Path: filepath.Join(d, ".aws_assume_role_a"), Profile: "a", Type: cache.AssumeRoleEntryType, Readable: true,
+			Expiration: time.Now().Add(1 * time.Hour), RoleArn: "arn:aws:iam::123456789012:role/a", Provider: "AssumeRoleProvider"},
+		{Path: filepath.Join(d, ".aws_session_token_b"), Profile: "b", Type: cache.SessionTokenEntryType, Readable: true,
+			Expiration: time.Unix(1, 0)},
+		{Path: filepath.Join(d, ".aws_assume_role_c"), Profile: "c", Type: cache.AssumeRoleEntryType, Encrypted: true},
+	}
+}
+
+func TestPrintCacheEntries(t *testing.T) {
+	d := ".cache-print"
+	defer os.RemoveAll(d)
+	e := cacheTestEntries(d)
+
+	t.Run("table", func(t *testing.T) {
+		b := new(strings.Builder)
+		if err := printCacheEntries(e, b, "table"); err != nil {
+			t.Error(err)
+			return
+		}
+
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+		if len(lines) != 4 || !strings.HasPrefix(lines[0], "PROFILE") {
+			t.Errorf("unexpected output:\n%s", b.String())
+			return
+		}
+
+		if !strings.Contains(lines[1], "arn:aws:iam::123456789012:role/a") || !strings.Contains(lines[1], "AssumeRoleProvider") {
+			t.Errorf("bad role entry: %s", lines[1])
+		}
+
+		if !strings.HasSuffix(lines[2], "expired") {
+			t.Errorf("bad expired entry: %s", lines[2])
+		}
+
+		if !strings.Contains(lines[3], "(encrypted)") || !strings.HasSuffix(lines[3], "unknown") {
+			t.Errorf("bad encrypted entry: %s", lines[3])
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		b := new(strings.Builder)
+		if err := printCacheEntries(e, b, "json"); err != nil {
+			t.Error(err)
+			return
+		}
+
+		out := make([]map[string]interface{}, 0)
+		if err := json.Unmarshal([]byte(b.String()), &out); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(out) != 3 || out[0]["profile"] != "a" || out[0]["remaining_seconds"].(float64) < 1 {
+			t.Errorf("unexpected output:\n%s", b.String())
+		}
+
+		if out[1]["remaining_seconds"].(float64) != 0 {
+			t.Error("expired entry has remaining lifetime")
+		}
+	})
+}
+
+func TestPurgeCacheEntries(t *testing.T) {
+	d := ".cache-purge"
+	defer os.RemoveAll(d)
+
+	t.Run("expired", func(t *testing.T) {
+		r := purgeCacheEntries(cacheTestEntries(d), purgeExpired)
+		if len(r) != 2 || r[0].Profile != "b" || r[1].Profile != "c" {
+			t.Error("unexpected entries removed")
+		}
+
+		if _, err := os.Stat(filepath.Join(d, ".aws_assume_role_a")); err != nil {
+			t.Error("valid entry was removed")
+		}
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		r := purgeCacheEntries(cacheTestEntries(d), "a")
+		if len(r) != 1 || r[0].Profile != "a" {
+			t.Error("unexpected entries removed")
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		if r := purgeCacheEntries(cacheTestEntries(d), purgeAll); len(r) != 3 {
+			t.Error("unexpected entries removed")
+		}
+
+		if f, _ := filepath.Glob(filepath.Join(d, ".aws_*")); len(f) > 0 {
+			t.Errorf("files not removed: %v", f)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		e := []*cache.CacheEntry{{Path: filepath.Join(d, "not-a-file"), Profile: "x"}}
+		if r := purgeCacheEntries(e, "x"); len(r) > 0 {
+			t.Error("unexpected entries removed")
+		}
+	})
+}
+
+func TestResolveCacheRoleArns(t *testing.T) {
+	e := []*cache.CacheEntry{
+		{Profile: "123456789012-Admin", Type: cache.AssumeRoleEntryType},
+		{Profile: "default", Type: cache.SessionTokenEntryType},
+	}
+	resolveCacheRoleArns(e)
+
+	if e[0].RoleArn != "arn:aws:iam::123456789012:role/Admin" {
+		t.Errorf("bad role arn for ARN profile: %s", e[0].RoleArn)
+	}
+
+	if len(e[1].RoleArn) > 0 {
+		t.Error("unexpected role arn for session token entry")
+	}
+}
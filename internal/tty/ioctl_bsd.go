@@ -0,0 +1,11 @@
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package tty
+
+import "golang.org/x/sys/unix"
+
+// The ioctl requests to get and set the terminal attributes
+const (
+	IoctlGetTermios = unix.TIOCGETA
+	IoctlSetTermios = unix.TIOCSETA
+)
@@ -0,0 +1,11 @@
+// +build aix linux solaris
+
+package tty
+
+import "golang.org/x/sys/unix"
+
+// The ioctl requests to get and set the terminal attributes
+const (
+	IoctlGetTermios = unix.TCGETS
+	IoctlSetTermios = unix.TCSETS
+)
@@ -0,0 +1,21 @@
+// Package tty provides access to the controlling terminal, for prompting the user when stdin and stdout may be in
+// use by other programs.
+package tty
+
+import "os"
+
+// Open returns the controlling terminal opened for reading and writing.  The caller is responsible for closing both.
+func Open() (in *os.File, out *os.File, err error) {
+	in, err = os.Open(inDevice)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out, err = os.OpenFile(outDevice, os.O_WRONLY, 0)
+	if err != nil {
+		in.Close()
+		return nil, nil, err
+	}
+
+	return in, out, nil
+}
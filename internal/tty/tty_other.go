@@ -0,0 +1,19 @@
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package tty
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+const (
+	inDevice  = "/dev/tty"
+	outDevice = "/dev/tty"
+)
+
+// DisableEcho is not supported on this platform, and always returns an error
+func DisableEcho(f *os.File) (func(), error) {
+	return nil, fmt.Errorf("disabling terminal echo is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,32 @@
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package tty
+
+import (
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+const (
+	inDevice  = "/dev/tty"
+	outDevice = "/dev/tty"
+)
+
+// DisableEcho turns off echo on the terminal f, while keeping line buffering and signal generation.  The returned
+// function restores the original terminal settings.
+func DisableEcho(f *os.File) (func(), error) {
+	fd := int(f.Fd())
+	t, err := unix.IoctlGetTermios(fd, IoctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	orig := *t
+	t.Lflag &^= unix.ECHO
+	t.Lflag |= unix.ICANON | unix.ISIG
+	if err := unix.IoctlSetTermios(fd, IoctlSetTermios, t); err != nil {
+		return nil, err
+	}
+
+	return func() { unix.IoctlSetTermios(fd, IoctlSetTermios, &orig) }, nil
+}
@@ -0,0 +1,45 @@
+// +build windows
+
+package tty
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	inDevice  = "CONIN$"
+	outDevice = "CONOUT$"
+
+	enableEchoInput = 0x4
+)
+
+var (
+	kernel32           = syscall.NewLazyDLL("kernel32.dll")
+	procSetConsoleMode = kernel32.NewProc("SetConsoleMode")
+)
+
+// DisableEcho turns off echo on the console f.  The returned function restores the original console mode.
+func DisableEcho(f *os.File) (func(), error) {
+	h := syscall.Handle(f.Fd())
+
+	var mode uint32
+	if err := syscall.GetConsoleMode(h, &mode); err != nil {
+		return nil, err
+	}
+
+	if err := SetConsoleMode(h, mode&^enableEchoInput); err != nil {
+		return nil, err
+	}
+
+	return func() { SetConsoleMode(h, mode) }, nil
+}
+
+// SetConsoleMode sets the input or output mode of the console handle h, the counterpart of syscall.GetConsoleMode
+func SetConsoleMode(h syscall.Handle, mode uint32) error {
+	r, _, err := procSetConsoleMode.Call(uintptr(h), uintptr(mode))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
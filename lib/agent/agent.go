@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// SocketEnvVar is the environment variable with the path of the agent socket, like SSH_AUTH_SOCK for ssh-agent
+	SocketEnvVar = "AWS_RUNAS_AGENT_SOCK"
+	// PidEnvVar is the environment variable with the process ID of the agent started in the background
+	PidEnvVar = "AWS_RUNAS_AGENT_PID"
+	// SocketName is the file name of the agent socket
+	SocketName = "aws-runas-agent.sock"
+)
+
+// Request is the JSON document sent to the agent to get the credentials for a profile.  The SessionDuration,
+// RoleDuration and MfaSerial fields override the profile configuration, like the matching command line options.
+type Request struct {
+	Profile         string
+	Session         bool          `json:",omitempty"`
+	Refresh         bool          `json:",omitempty"`
+	TokenCode       string        `json:",omitempty"`
+	MfaSerial       string        `json:",omitempty"`
+	SessionDuration time.Duration `json:",omitempty"`
+	RoleDuration    time.Duration `json:",omitempty"`
+}
+
+// Response is the JSON document returned by the agent.  If MfaRequired is true, the request must be sent again with
+// the MFA code in the TokenCode field.
+type Response struct {
+	AccessKeyID     string `json:",omitempty"`
+	SecretAccessKey string `json:",omitempty"`
+	SessionToken    string `json:",omitempty"`
+	Expiration      int64  `json:",omitempty"`
+	Region          string `json:",omitempty"`
+	MfaRequired     bool   `json:",omitempty"`
+	Error           string `json:",omitempty"`
+}
+
+// Value returns the credentials in the response as an AWS credentials.Value
+func (r *Response) Value() credentials.Value {
+	return credentials.Value{AccessKeyID: r.AccessKeyID, SecretAccessKey: r.SecretAccessKey, SessionToken: r.SessionToken,
+		ProviderName: "AgentProvider"}
+}
+
+// SocketPath returns the path of the agent socket.  The value of the AWS_RUNAS_AGENT_SOCK environment variable is used
+// if set, otherwise the socket is in the directory set in the XDG_RUNTIME_DIR environment variable, or the directory
+// of the SDK credentials file (normally $HOME/.aws), which are only accessible by the user.
+func SocketPath() string {
+	if v, ok := os.LookupEnv(SocketEnvVar); ok && len(v) > 0 {
+		return v
+	}
+
+	if v, ok := os.LookupEnv("XDG_RUNTIME_DIR"); ok && len(v) > 0 {
+		return filepath.Join(v, SocketName)
+	}
+	return filepath.Join(filepath.Dir(defaults.SharedCredentialsFilename()), SocketName)
+}
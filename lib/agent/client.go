@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+)
+
+// Client sends requests to the agent listening on the socket at Path
+type Client struct {
+	Path    string
+	Timeout time.Duration
+}
+
+// NewClient creates a Client for the agent socket at path
+func NewClient(path string) *Client {
+	return &Client{Path: path, Timeout: 30 * time.Second}
+}
+
+// Credentials sends the request to the agent, and returns the agent's response.  An error is only returned if there
+// was a problem communicating with the agent, errors getting the credentials are returned in Response.Error.
+func (c *Client) Credentials(req *Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", c.Path, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(c.Timeout)); err != nil {
+		return nil, err
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+
+	res := new(Response)
+	if err := json.NewDecoder(conn).Decode(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Ping returns nil if the agent is accepting connections
+func (c *Client) Ping() error {
+	conn, err := net.DialTimeout("unix", c.Path, c.Timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,14 @@
+// +build !windows
+
+package agent
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Detach configures cmd to run in a new session, so the agent keeps running after the terminal it was started from
+// is closed
+func Detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
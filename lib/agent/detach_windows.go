@@ -0,0 +1,16 @@
+// +build windows
+
+package agent
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+const detachedProcess = 0x00000008
+
+// Detach configures cmd to run without a console in a new process group, so the agent keeps running after the console
+// it was started from is closed
+func Detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess}
+}
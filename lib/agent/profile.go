@@ -0,0 +1,268 @@
+package agent
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/mmmorris1975/aws-runas/lib/config"
+	credlib "github.com/mmmorris1975/aws-runas/lib/credentials"
+	"github.com/mmmorris1975/simple-logger"
+	"strings"
+	"time"
+)
+
+// ProfileProvider is the default agent Provider, which gets the credentials for the profiles in the SDK config file
+// using the IAM user credentials of the profile's source profile.  The session token and role credentials are only
+// held in memory, they are never written to the credential cache.
+type ProfileProvider struct {
+	// StateDir is the directory used by the totp MFA token provider to track used codes
+	StateDir   string
+	sessions   map[string]*session.Session
+	identities map[string]*credlib.AwsIdentity
+	tokens     map[string]*credentials.Credentials
+	roles      map[string]*credentials.Credentials
+	tokenCode  string
+	log        *simple_logger.Logger
+}
+
+// NewProfileProvider creates a ProfileProvider.  A list of options can be provided to override the default
+// ProfileProvider configuration.
+func NewProfileProvider(options ...func(*ProfileProvider)) *ProfileProvider {
+	p := &ProfileProvider{
+		sessions:   make(map[string]*session.Session),
+		identities: make(map[string]*credlib.AwsIdentity),
+		tokens:     make(map[string]*credentials.Credentials),
+		roles:      make(map[string]*credentials.Credentials),
+	}
+
+	for _, o := range options {
+		o(p)
+	}
+
+	return p
+}
+
+// WithLogger configures the provided logger in the provider
+func (p *ProfileProvider) WithLogger(l *simple_logger.Logger) *ProfileProvider {
+	p.log = l
+	return p
+}
+
+// Credentials returns the credentials for the profile in request r, and the region configured for the profile.  The
+// session token credentials are returned if the profile has no role, or r.Session is true.  Profiles using external
+// identity providers (credential_source, web identity, SAML or AWS SSO) are not supported.
+func (p *ProfileProvider) Credentials(r *Request) (*credentials.Credentials, string, error) {
+	rc, err := config.NewConfigResolver(&config.AwsConfig{MfaSerial: r.MfaSerial, SessionDuration: r.SessionDuration,
+		RoleDuration: r.RoleDuration})
+	if err != nil {
+		return nil, "", err
+	}
+
+	c, err := rc.WithLogger(p.log).ResolveConfig(r.Profile)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if federated(c) {
+		return nil, "", fmt.Errorf("profile '%s' does not use IAM user credentials, which is not supported by the agent", r.Profile)
+	}
+	for _, h := range c.RoleChain {
+		if federated(h) {
+			return nil, "", fmt.Errorf("role chain of profile '%s' does not use IAM user credentials, which is not supported by the agent", r.Profile)
+		}
+	}
+
+	if len(c.RoleChain) > 0 && c.RoleDuration > credlib.ChainedRoleMaxDuration {
+		return nil, "", fmt.Errorf("role chaining limits the credential duration to %s", credlib.ChainedRoleMaxDuration)
+	}
+
+	// the MFA code from the client is only good for this request
+	p.tokenCode = r.TokenCode
+	defer func() { p.tokenCode = "" }()
+
+	src := sourceProfile(r.Profile, c)
+	s := p.session(src, c.Region)
+
+	var creds *credentials.Credentials
+	if len(c.RoleArn) < 1 || r.Session {
+		creds = p.sessionTokenCredentials(src, s, c, r.Refresh)
+	} else {
+		creds, err = p.roleCredentials(r.Profile, src, s, c, r.Refresh)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return creds, c.Region, nil
+}
+
+func (p *ProfileProvider) session(profile, region string) *session.Session {
+	k := fmt.Sprintf("%s|%s", profile, region)
+	if s, ok := p.sessions[k]; ok {
+		return s
+	}
+
+	sc := new(aws.Config).WithCredentialsChainVerboseErrors(true).WithRegion(region)
+	if p.log != nil && p.log.Level == simple_logger.DEBUG {
+		sc.WithLogger(p.log).LogLevel = aws.LogLevel(aws.LogDebug)
+	}
+
+	s := session.Must(session.NewSessionWithOptions(session.Options{Config: *sc, Profile: profile}))
+	p.sessions[k] = s
+	return s
+}
+
+func (p *ProfileProvider) sessionTokenCredentials(src string, s *session.Session, c *config.AwsConfig, refresh bool) *credentials.Credentials {
+	k := fmt.Sprintf("%s|%s|%s", src, c.MfaSerial, c.SessionDuration)
+	if creds, ok := p.tokens[k]; ok {
+		if refresh {
+			creds.Expire()
+		}
+		return creds
+	}
+
+	ew := credlib.SessionTokenDefaultDuration / 10
+	if c.SessionDuration > 0 {
+		ew = c.SessionDuration / 10
+	}
+
+	creds := credlib.NewSessionCredentials(s, func(pv *credlib.SessionTokenProvider) {
+		pv.SerialNumber = c.MfaSerial
+		pv.TokenProvider = p.tokenProvider(c)
+		pv.Duration = c.SessionDuration
+		pv.ExpiryWindow = ew
+		pv.WithLogger(p.log)
+	})
+	p.tokens[k] = creds
+	return creds
+}
+
+func (p *ProfileProvider) roleCredentials(profile, src string, s *session.Session, c *config.AwsConfig, refresh bool) (*credentials.Credentials, error) {
+	k := fmt.Sprintf("%s|%s|%s|%s", profile, src, c.RoleArn, c.RoleDuration)
+	if creds, ok := p.roles[k]; ok {
+		if refresh {
+			creds.Expire()
+			if c.RoleDuration <= 1*time.Hour {
+				p.sessionTokenCredentials(src, s, c, true)
+			}
+		}
+		return creds, nil
+	}
+
+	id, err := p.identity(src, s)
+	if err != nil {
+		return nil, err
+	}
+
+	ew := credlib.AssumeRoleMinDuration / 10
+	if c.RoleDuration > credlib.AssumeRoleMinDuration {
+		ew = c.RoleDuration / 10
+	}
+
+	var serial string
+	if c.RoleDuration > 1*time.Hour {
+		// session token credentials can't be used to get role credentials longer than 1 hour, so MFA is done in the
+		// assume role call, using the IAM user credentials
+		serial = c.MfaSerial
+	} else {
+		s = s.Copy(new(aws.Config).WithCredentials(p.sessionTokenCredentials(src, s, c, refresh)))
+	}
+
+	for _, r := range c.RoleChain {
+		hop := credlib.NewAssumeRoleCredentials(s, r.RoleArn, func(pv *credlib.AssumeRoleProvider) {
+			pv.RoleSessionName = id.UserName
+			pv.ExternalID = r.ExternalID
+			pv.Duration = c.RoleDuration
+			pv.ExpiryWindow = ew
+			pv.WithLogger(p.log)
+		})
+		s = s.Copy(new(aws.Config).WithCredentials(hop))
+	}
+
+	creds := credlib.NewAssumeRoleCredentials(s, c.RoleArn, func(pv *credlib.AssumeRoleProvider) {
+		pv.RoleSessionName = id.UserName
+		pv.ExternalID = c.ExternalID
+		pv.SerialNumber = serial
+		pv.TokenProvider = p.tokenProvider(c)
+		pv.Duration = c.RoleDuration
+		pv.ExpiryWindow = ew
+		pv.WithLogger(p.log)
+	})
+	p.roles[k] = creds
+	return creds, nil
+}
+
+// the identity of the IAM user is looked up once for each source profile, and used as the role session name
+func (p *ProfileProvider) identity(src string, s *session.Session) (*credlib.AwsIdentity, error) {
+	if id, ok := p.identities[src]; ok {
+		return id, nil
+	}
+
+	id, err := credlib.NewAwsIdentityManager(s).WithLogger(p.log).GetCallerIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	if id.IdentityType != "user" {
+		return nil, fmt.Errorf("source profile '%s' does not use IAM user credentials, which is not supported by the agent", src)
+	}
+
+	p.identities[src] = id
+	return id, nil
+}
+
+// tokenProvider returns the MFA token provider used when the agent needs to refresh credentials.  An MFA token provider
+// configured to run without user interaction is used if available, otherwise the MFA code sent with the request is used.
+// If there is no code, ErrMfaRequired is returned, so the client can prompt for the code and try again.
+func (p *ProfileProvider) tokenProvider(c *config.AwsConfig) func() (string, error) {
+	dc := c.MfaDeviceConfig(c.MfaSerial)
+
+	var tp func() (string, error)
+	switch strings.ToLower(dc.MfaTokenProvider) {
+	case "", credlib.StdinTokenProviderType, credlib.TtyTokenProviderType:
+	default:
+		var err error
+		tp, err = credlib.NewTokenProvider(dc.MfaTokenProvider, &credlib.TokenProviderOptions{Command: dc.MfaTokenCommand,
+			SecretFile: dc.MfaTotpSecretFile, SecretCommand: dc.MfaTotpSecretCommand, StateDir: p.StateDir})
+		if err != nil {
+			p.debug("error configuring MFA token provider: %v", err)
+		}
+	}
+
+	return func() (string, error) {
+		if tp != nil {
+			return tp()
+		}
+
+		if len(p.tokenCode) > 0 {
+			t := p.tokenCode
+			p.tokenCode = ""
+			return t, nil
+		}
+		return "", new(credlib.ErrMfaRequired)
+	}
+}
+
+func (p *ProfileProvider) debug(f string, v ...interface{}) {
+	if p.log != nil {
+		p.log.Debugf(f, v...)
+	}
+}
+
+func federated(c *config.AwsConfig) bool {
+	return len(c.CredentialSource) > 0 || len(c.WebIdentityTokenFile) > 0 || len(c.SamlAuthUrl) > 0 || len(c.SsoStartUrl) > 0
+}
+
+// sourceProfile returns the name of the profile with the IAM user credentials.  An empty value (the SDK default
+// profile) is returned if the profile is a role ARN.
+func sourceProfile(profile string, c *config.AwsConfig) string {
+	if len(c.SourceProfile) > 0 {
+		return c.SourceProfile
+	}
+
+	if profile == c.RoleArn {
+		return ""
+	}
+	return profile
+}
@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"github.com/mmmorris1975/aws-runas/lib/config"
+	credlib "github.com/mmmorris1975/aws-runas/lib/credentials"
+	"os"
+	"testing"
+)
+
+func TestProfileProvider_Credentials(t *testing.T) {
+	os.Setenv("AWS_CONFIG_FILE", "../../.aws/config")
+	defer os.Unsetenv("AWS_CONFIG_FILE")
+
+	p := NewProfileProvider()
+
+	t.Run("session", func(t *testing.T) {
+		c, r, err := p.Credentials(&Request{Profile: "circle-role", Session: true})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if r != "eu-west-1" {
+			t.Error("bad region")
+		}
+
+		c2, _, err := p.Credentials(&Request{Profile: "circle-role", Session: true})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c != c2 {
+			t.Error("session token credentials not reused")
+		}
+
+		if len(p.tokens) != 1 || len(p.sessions) != 1 {
+			t.Error("unexpected held credentials")
+		}
+	})
+
+}
+
+func TestProfileProvider_TokenProvider(t *testing.T) {
+	p := NewProfileProvider()
+
+	t.Run("mfa required", func(t *testing.T) {
+		_, err := p.tokenProvider(new(config.AwsConfig))()
+		if _, ok := err.(*credlib.ErrMfaRequired); !ok {
+			t.Errorf("did not receive expected error: %v", err)
+		}
+	})
+
+	t.Run("request code", func(t *testing.T) {
+		p.tokenCode = "123456"
+		tp := p.tokenProvider(new(config.AwsConfig))
+
+		c, err := tp()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c != "123456" {
+			t.Error("bad mfa code")
+		}
+
+		if _, err := tp(); err == nil {
+			t.Error("mfa code was reused")
+		}
+	})
+
+	t.Run("command", func(t *testing.T) {
+		c, err := p.tokenProvider(&config.AwsConfig{MfaTokenProvider: credlib.CommandTokenProviderType, MfaTokenCommand: "echo 654321"})()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c != "654321" {
+			t.Error("bad mfa code")
+		}
+	})
+}
+
+func TestFederated(t *testing.T) {
+	if federated(&config.AwsConfig{SourceProfile: "x"}) {
+		t.Error("source profile is not federated")
+	}
+
+	if !federated(&config.AwsConfig{SamlAuthUrl: "https://idp.example.com/saml"}) {
+		t.Error("saml profile is federated")
+	}
+}
+
+func TestSourceProfile(t *testing.T) {
+	t.Run("source profile", func(t *testing.T) {
+		if sourceProfile("x", &config.AwsConfig{SourceProfile: "y"}) != "y" {
+			t.Error("source_profile not used")
+		}
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		if sourceProfile("x", new(config.AwsConfig)) != "x" {
+			t.Error("profile not used")
+		}
+	})
+
+	t.Run("role arn", func(t *testing.T) {
+		a := "arn:aws:iam::123456789012:role/Admin"
+		if len(sourceProfile(a, &config.AwsConfig{RoleArn: a})) > 0 {
+			t.Error("role arn used as profile")
+		}
+	})
+}
@@ -0,0 +1,244 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	credlib "github.com/mmmorris1975/aws-runas/lib/credentials"
+	"github.com/mmmorris1975/simple-logger"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider is the interface for the type looking up the credentials for an agent request.  The returned credentials
+// are held by the agent, and refreshed before they expire.
+type Provider interface {
+	Credentials(r *Request) (*credentials.Credentials, string, error)
+}
+
+// Server is the credential agent, listening for requests on the unix domain socket at Path.  Only the user running the
+// agent is allowed to connect to the socket.
+type Server struct {
+	// Path is the location of the agent socket
+	Path string
+	// Provider looks up the credentials for each request
+	Provider Provider
+	// RefreshInterval is how often the credentials held by the agent are checked, and refreshed if they are within
+	// the expiry window of their provider
+	RefreshInterval time.Duration
+	// Timeout is the maximum time allowed to handle a request
+	Timeout  time.Duration
+	listener net.Listener
+	creds    map[*credentials.Credentials]bool
+	done     chan struct{}
+	mu       sync.Mutex
+	lmu      sync.Mutex
+	log      *simple_logger.Logger
+}
+
+// NewServer creates a Server listening on the socket at path, using Provider p to lookup credentials.  A list of
+// options can be provided to override the default Server configuration.
+func NewServer(path string, p Provider, options ...func(*Server)) *Server {
+	s := &Server{
+		Path:            path,
+		Provider:        p,
+		RefreshInterval: 1 * time.Minute,
+		Timeout:         5 * time.Minute,
+		creds:           make(map[*credentials.Credentials]bool),
+		done:            make(chan struct{}),
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithLogger configures the provided logger in the server
+func (s *Server) WithLogger(l *simple_logger.Logger) *Server {
+	s.log = l
+	return s
+}
+
+// ListenAndServe creates the agent socket, and handles requests until Close() is called.  An error is returned if
+// another agent is listening on the socket.
+func (s *Server) ListenAndServe() error {
+	l, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	go s.refresh()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops the agent, and removes the socket
+func (s *Server) Close() error {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	default:
+		close(s.done)
+	}
+
+	if s.listener == nil {
+		return nil
+	}
+
+	err := s.listener.Close()
+	os.Remove(s.Path)
+	return err
+}
+
+func (s *Server) listen() (net.Listener, error) {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil, fmt.Errorf("agent is closed")
+	default:
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return nil, err
+	}
+
+	c := NewClient(s.Path)
+	c.Timeout = 1 * time.Second
+	if err := c.Ping(); err == nil {
+		return nil, fmt.Errorf("an agent is already listening on %s", s.Path)
+	}
+
+	// a socket left behind by an agent which didn't shut down cleanly
+	if err := os.Remove(s.Path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(s.Path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	s.debug("agent listening on %s", s.Path)
+	s.listener = l
+	return l, nil
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(s.Timeout)); err != nil {
+		s.debug("error setting connection deadline: %v", err)
+		return
+	}
+
+	req := new(Request)
+	if err := json.NewDecoder(conn).Decode(req); err != nil {
+		if err != io.EOF {
+			// an empty connection is a ping from a client checking that the agent is running
+			s.debug("error reading request: %v", err)
+		}
+		return
+	}
+
+	if err := json.NewEncoder(conn).Encode(s.credentials(req)); err != nil {
+		s.debug("error writing response: %v", err)
+	}
+}
+
+func (s *Server) credentials(req *Request) *Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.debug("credential request for profile '%s'", req.Profile)
+	c, region, err := s.Provider.Credentials(req)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	v, err := c.Get()
+	if err != nil {
+		return errorResponse(err)
+	}
+	s.creds[c] = true
+
+	res := &Response{AccessKeyID: v.AccessKeyID, SecretAccessKey: v.SecretAccessKey, SessionToken: v.SessionToken,
+		Region: region}
+	if t, err := c.ExpiresAt(); err == nil {
+		res.Expiration = t.Unix()
+	}
+	return res
+}
+
+// refresh the held credentials when they're within their expiry window, so clients don't wait for AWS API calls.
+// Credentials which can't be refreshed (like session tokens requiring an MFA code) are dropped until requested again.
+func (s *Server) refresh() {
+	t := time.NewTicker(s.RefreshInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			s.mu.Lock()
+			for c := range s.creds {
+				if c.IsExpired() {
+					if _, err := c.Get(); err != nil {
+						s.debug("error refreshing credentials: %v", err)
+						delete(s.creds, c)
+					}
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Server) debug(f string, v ...interface{}) {
+	if s.log != nil {
+		s.log.Debugf(f, v...)
+	}
+}
+
+func errorResponse(err error) *Response {
+	res := &Response{Error: err.Error()}
+
+	switch t := err.(type) {
+	case *credlib.ErrMfaRequired:
+		res.MfaRequired = true
+	case awserr.Error:
+		if t.Code() == "AccessDenied" && strings.HasPrefix(t.Message(), "MultiFactorAuthentication failed") {
+			res.MfaRequired = true
+		}
+	}
+	return res
+}
@@ -0,0 +1,229 @@
+package agent
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	credlib "github.com/mmmorris1975/aws-runas/lib/credentials"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	d, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(d)
+
+	path := filepath.Join(d, SocketName)
+	p := &mockProvider{creds: credentials.NewCredentials(&mockCredProvider{ttl: 1 * time.Hour}),
+		expiring: &mockCredProvider{ttl: 1 * time.Millisecond}}
+	s := NewServer(path, p, func(s *Server) { s.RefreshInterval = 50 * time.Millisecond })
+
+	go s.ListenAndServe()
+	defer s.Close()
+
+	c := NewClient(path)
+	for i := 0; c.Ping() != nil; i++ {
+		if i > 50 {
+			t.Error("agent did not start")
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Run("permissions", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("unix permissions not used on windows")
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if fi.Mode().Perm() != 0600 {
+			t.Errorf("bad socket permissions: %s", fi.Mode().Perm())
+		}
+	})
+
+	t.Run("already running", func(t *testing.T) {
+		if err := NewServer(path, p).ListenAndServe(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		res, err := c.Credentials(&Request{Profile: "x"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if res.AccessKeyID != "AKIAMOCK" || res.SessionToken != "MockToken" || res.Region != "us-east-2" {
+			t.Errorf("unexpected response: %+v", res)
+		}
+
+		if res.Expiration < time.Now().Unix() {
+			t.Error("bad expiration")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		res, err := c.Credentials(&Request{Profile: "bad"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(res.Error) < 1 || len(res.AccessKeyID) > 0 || res.MfaRequired {
+			t.Errorf("unexpected response: %+v", res)
+		}
+	})
+
+	t.Run("mfa required", func(t *testing.T) {
+		res, err := c.Credentials(&Request{Profile: "mfa"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if !res.MfaRequired {
+			t.Error("MFA required not set")
+		}
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		if _, err := c.Credentials(&Request{Profile: "expiring"}); err != nil {
+			t.Error(err)
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+
+		if atomic.LoadInt32(&p.expiring.count) < 2 {
+			t.Error("credentials were not refreshed")
+		}
+	})
+}
+
+func TestServer_Close(t *testing.T) {
+	d, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(d)
+
+	path := filepath.Join(d, "sub", SocketName)
+	s := NewServer(path, new(mockProvider))
+
+	ch := make(chan error)
+	go func() { ch <- s.ListenAndServe() }()
+
+	for i := 0; NewClient(path).Ping() != nil; i++ {
+		if i > 50 {
+			t.Error("agent did not start")
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := <-ch; err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("socket was not removed")
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	t.Run("mfa required", func(t *testing.T) {
+		if !errorResponse(new(credlib.ErrMfaRequired)).MfaRequired {
+			t.Error("MFA required not set")
+		}
+	})
+
+	t.Run("mfa failed", func(t *testing.T) {
+		err := awserr.New("AccessDenied", "MultiFactorAuthentication failed with invalid MFA one time pass code.", nil)
+		if !errorResponse(err).MfaRequired {
+			t.Error("MFA required not set")
+		}
+	})
+
+	t.Run("access denied", func(t *testing.T) {
+		err := awserr.New("AccessDenied", "not authorized", nil)
+		if r := errorResponse(err); r.MfaRequired || len(r.Error) < 1 {
+			t.Error("bad error response")
+		}
+	})
+}
+
+func TestSocketPath(t *testing.T) {
+	t.Run("env var", func(t *testing.T) {
+		os.Setenv(SocketEnvVar, "/tmp/my.sock")
+		defer os.Unsetenv(SocketEnvVar)
+
+		if SocketPath() != "/tmp/my.sock" {
+			t.Error("env var not used")
+		}
+	})
+
+	t.Run("runtime dir", func(t *testing.T) {
+		os.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+		defer os.Unsetenv("XDG_RUNTIME_DIR")
+
+		if SocketPath() != filepath.Join("/run/user/1000", SocketName) {
+			t.Error("runtime dir not used")
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		if filepath.Base(SocketPath()) != SocketName {
+			t.Error("bad socket name")
+		}
+	})
+}
+
+type mockProvider struct {
+	creds    *credentials.Credentials
+	expiring *mockCredProvider
+}
+
+func (p *mockProvider) Credentials(r *Request) (*credentials.Credentials, string, error) {
+	switch r.Profile {
+	case "bad":
+		return nil, "", fmt.Errorf("profile not found")
+	case "mfa":
+		return nil, "", new(credlib.ErrMfaRequired)
+	case "expiring":
+		return credentials.NewCredentials(p.expiring), "", nil
+	}
+	return p.creds, "us-east-2", nil
+}
+
+type mockCredProvider struct {
+	credentials.Expiry
+	ttl   time.Duration
+	count int32
+}
+
+func (p *mockCredProvider) Retrieve() (credentials.Value, error) {
+	atomic.AddInt32(&p.count, 1)
+	p.SetExpiration(time.Now().Add(p.ttl), 0)
+	return credentials.Value{AccessKeyID: "AKIAMOCK", SecretAccessKey: "MockSecret", SessionToken: "MockToken"}, nil
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// FileCacheType is the cache type for the FileCredentialCache, this is the default cache type
+	FileCacheType = "file"
+	// MemoryCacheType is the cache type for the MemoryCredentialCache
+	MemoryCacheType = "memory"
+	// EncryptedFileCacheType is the cache type for the EncryptedFileCredentialCache
+	EncryptedFileCacheType = "encrypted-file"
+	// ExternalCacheType is the cache type for the ExternalCredentialCache
+	ExternalCacheType = "external"
+	// PassphraseEnvVar is the environment variable to define the passphrase used for the encrypted file cache,
+	// if a key file is not configured
+	PassphraseEnvVar = "CREDENTIAL_CACHE_PASSPHRASE"
+)
+
+var (
+	memCache = make(map[string]*MemoryCredentialCache)
+	memLock  sync.Mutex
+)
+
+// Options contains the additional settings needed by some of the CredentialCacher implementations
+type Options struct {
+	// KeyFile is the path to a file whose contents are used as the secret for the encrypted file cache
+	KeyFile string
+	// Command is the command line for the external cache helper
+	Command string
+}
+
+// NewCredentialCacher returns the CredentialCacher implementation for the given cache type, using path as the location
+// of (or the key for) the cached credentials.  An empty cacheType will return a FileCredentialCache.  Memory caches
+// are shared within the process, so calling this method with the same path will return the same MemoryCredentialCache.
+func NewCredentialCacher(cacheType string, path string, opts *Options) (CredentialCacher, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+
+	switch strings.ToLower(cacheType) {
+	case "", FileCacheType:
+		return &FileCredentialCache{Path: path}, nil
+	case MemoryCacheType:
+		memLock.Lock()
+		defer memLock.Unlock()
+
+		c, ok := memCache[path]
+		if !ok {
+			c = new(MemoryCredentialCache)
+			memCache[path] = c
+		}
+		return c, nil
+	case EncryptedFileCacheType:
+		s, err := cacheSecret(opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &EncryptedFileCredentialCache{Path: path, Secret: s}, nil
+	case ExternalCacheType:
+		if len(opts.Command) < 1 {
+			return nil, fmt.Errorf("external credential cache requires a command")
+		}
+		return &ExternalCredentialCache{Command: opts.Command, Key: filepath.Base(path)}, nil
+	}
+
+	return nil, fmt.Errorf("invalid credential cache type: %s", cacheType)
+}
+
+func cacheSecret(keyFile string) ([]byte, error) {
+	if len(keyFile) > 0 {
+		s, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// a key file written with an editor will likely end with a newline, which is not part of the secret
+		s = bytes.TrimRight(s, " \t\r\n")
+		if len(s) < 1 {
+			return nil, fmt.Errorf("empty encryption secret in key file %s", keyFile)
+		}
+		return s, nil
+	}
+
+	if v, ok := os.LookupEnv(PassphraseEnvVar); ok && len(v) > 0 {
+		return []byte(v), nil
+	}
+
+	return nil, fmt.Errorf("encrypted credential cache requires a key file or the %s environment variable", PassphraseEnvVar)
+}
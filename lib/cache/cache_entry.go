@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AssumeRoleFilePrefix is the file name prefix for cached assume role credentials
+	AssumeRoleFilePrefix = ".aws_assume_role"
+	// SessionTokenFilePrefix is the file name prefix for cached session token credentials
+	SessionTokenFilePrefix = ".aws_session_token"
+	// AssumeRoleEntryType is the CacheEntry type for cached assume role credentials
+	AssumeRoleEntryType = "assume_role"
+	// SessionTokenEntryType is the CacheEntry type for cached session token credentials
+	SessionTokenEntryType = "session_token"
+)
+
+// CacheEntry describes a credential cache file found on the local system
+type CacheEntry struct {
+	Path    string `json:"path"`
+	Type    string `json:"type"`
+	Profile string `json:"profile"`
+	// RoleArn is not stored in the cache, it may be filled in by the caller from the profile configuration
+	RoleArn    string    `json:"role_arn,omitempty"`
+	Provider   string    `json:"provider,omitempty"`
+	Expiration time.Time `json:"expiration"`
+	Encrypted  bool      `json:"encrypted"`
+	// Readable is false if the cache file content could not be read, or decrypted
+	Readable bool `json:"readable"`
+}
+
+// Remaining returns the remaining lifetime of the cached credentials, a negative value means they have expired
+func (e *CacheEntry) Remaining() time.Duration {
+	return time.Until(e.Expiration)
+}
+
+// IsExpired returns true if the cached credentials have expired, or the expiration could not be determined
+func (e *CacheEntry) IsExpired() bool {
+	return !e.Readable || e.Remaining() <= 0
+}
+
+// Remove deletes the cache file.  The lock file for the cache is left in place, see fileLock.
+func (e *CacheEntry) Remove() error {
+	return os.Remove(e.Path)
+}
+
+// FindCacheEntries returns the list of credential cache files found in the provided directories, sorted by profile
+// name and type.  Files encrypted by the EncryptedFileCredentialCache are decrypted if the secret in opts (or the
+// passphrase environment variable) is available, otherwise the entry is returned with the Readable field set to false.
+func FindCacheEntries(opts *Options, dirs ...string) ([]*CacheEntry, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+	secret, _ := cacheSecret(opts.KeyFile)
+
+	entries := make([]*CacheEntry, 0)
+	seen := make(map[string]bool)
+	for _, d := range dirs {
+		files, err := ioutil.ReadDir(d)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		for _, f := range files {
+			p := filepath.Join(d, f.Name())
+			if !f.Mode().IsRegular() || seen[p] {
+				continue
+			}
+
+			if e := newCacheEntry(p, secret); e != nil {
+				entries = append(entries, e)
+				seen[p] = true
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Profile == entries[j].Profile {
+			return entries[i].Type < entries[j].Type
+		}
+		return entries[i].Profile < entries[j].Profile
+	})
+	return entries, nil
+}
+
+// returns nil if the file at path isn't a credential cache file
+func newCacheEntry(path string, secret []byte) *CacheEntry {
+	e := &CacheEntry{Path: path}
+
+	n := filepath.Base(path)
+	if strings.HasSuffix(n, ".lock") || isTempFile(n) {
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(n, AssumeRoleFilePrefix+"_"):
+		e.Type = AssumeRoleEntryType
+		e.Profile = strings.TrimPrefix(n, AssumeRoleFilePrefix+"_")
+	case strings.HasPrefix(n, SessionTokenFilePrefix+"_"):
+		e.Type = SessionTokenEntryType
+		e.Profile = strings.TrimPrefix(n, SessionTokenFilePrefix+"_")
+	default:
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return e
+	}
+
+	var c *CacheableCredentials
+	enc := new(encryptedCredentials)
+	if err := json.Unmarshal(data, enc); err == nil && len(enc.Nonce) > 0 {
+		e.Encrypted = true
+		if len(secret) > 0 {
+			c, _ = (&EncryptedFileCredentialCache{Path: path, Secret: secret}).Fetch()
+		}
+	} else {
+		c, _ = (&FileCredentialCache{Path: path}).Fetch()
+	}
+
+	if c != nil {
+		e.Readable = true
+		e.Provider = c.ProviderName
+		e.Expiration = time.Unix(c.Expiration, 0)
+	}
+	return e
+}
+
+// temp files created by writeCacheFile are named like <cache file>.tmp<random digits>
+func isTempFile(name string) bool {
+	i := strings.LastIndex(name, ".tmp")
+	if i < 0 {
+		return false
+	}
+
+	_, err := strconv.ParseUint(name[i+4:], 10, 64)
+	return err == nil
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindCacheEntries(t *testing.T) {
+	d := ".cache-entries"
+	defer os.RemoveAll(d)
+
+	cred := &CacheableCredentials{Expiration: time.Now().Add(1 * time.Hour).Unix()}
+	cred.ProviderName = "AssumeRoleProvider"
+
+	(&FileCredentialCache{Path: filepath.Join(d, ".aws_assume_role_admin")}).Store(cred)
+	(&FileCredentialCache{Path: filepath.Join(d, ".aws_session_token_default")}).Store(&CacheableCredentials{Expiration: 1})
+	(&EncryptedFileCredentialCache{Path: filepath.Join(d, ".aws_session_token_enc"), Secret: []byte("s3cr3t")}).Store(cred)
+	ioutil.WriteFile(filepath.Join(d, ".aws_assume_role_admin.lock"), []byte{}, 0600)
+	ioutil.WriteFile(filepath.Join(d, "credentials"), []byte{}, 0600)
+
+	t.Run("good", func(t *testing.T) {
+		e, err := FindCacheEntries(nil, d, "not-a-dir")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(e) != 3 {
+			t.Errorf("unexpected entry count: %d", len(e))
+			return
+		}
+
+		if e[0].Profile != "admin" || e[0].Type != AssumeRoleEntryType || e[0].Provider != "AssumeRoleProvider" || e[0].IsExpired() {
+			t.Errorf("bad assume role entry: %+v", e[0])
+		}
+
+		if e[1].Profile != "default" || e[1].Type != SessionTokenEntryType || !e[1].IsExpired() {
+			t.Errorf("bad session token entry: %+v", e[1])
+		}
+
+		if !e[2].Encrypted || e[2].Readable {
+			t.Errorf("bad encrypted entry: %+v", e[2])
+		}
+	})
+
+	t.Run("decrypt", func(t *testing.T) {
+		os.Setenv(PassphraseEnvVar, "s3cr3t")
+		defer os.Unsetenv(PassphraseEnvVar)
+
+		e, err := FindCacheEntries(nil, d)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if !e[2].Encrypted || !e[2].Readable || e[2].IsExpired() {
+			t.Errorf("bad encrypted entry: %+v", e[2])
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		e, _ := FindCacheEntries(nil, d)
+		if err := e[0].Remove(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if _, err := os.Stat(filepath.Join(d, ".aws_assume_role_admin.lock")); err != nil {
+			t.Error("lock file was removed")
+		}
+
+		e, _ = FindCacheEntries(nil, d)
+		if len(e) != 2 {
+			t.Errorf("unexpected entry count: %d", len(e))
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewCredentialCacher(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		c, err := NewCredentialCacher("", "path", nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if _, ok := c.(*FileCredentialCache); !ok {
+			t.Error("did not get a FileCredentialCache")
+		}
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		c, err := NewCredentialCacher(MemoryCacheType, "path", nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		c2, _ := NewCredentialCacher(MemoryCacheType, "path", nil)
+		if c != c2 {
+			t.Error("memory cache was not shared")
+		}
+	})
+
+	t.Run("encrypted passphrase", func(t *testing.T) {
+		os.Setenv(PassphraseEnvVar, "passphrase")
+		defer os.Unsetenv(PassphraseEnvVar)
+
+		c, err := NewCredentialCacher(EncryptedFileCacheType, "path", nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if string(c.(*EncryptedFileCredentialCache).Secret) != "passphrase" {
+			t.Error("secret mismatch")
+		}
+	})
+
+	t.Run("encrypted key file", func(t *testing.T) {
+		c, err := NewCredentialCacher(EncryptedFileCacheType, "path", &Options{KeyFile: "types.go"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(c.(*EncryptedFileCredentialCache).Secret) < 1 {
+			t.Error("empty secret")
+		}
+	})
+
+	t.Run("encrypted key file newline", func(t *testing.T) {
+		f := filepath.Join(os.TempDir(), "aws-runas-cache-key-test")
+		defer os.Remove(f)
+
+		if err := ioutil.WriteFile(f, []byte("secret key \n"), 0600); err != nil {
+			t.Error(err)
+			return
+		}
+
+		c, err := NewCredentialCacher(EncryptedFileCacheType, "path", &Options{KeyFile: f})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if string(c.(*EncryptedFileCredentialCache).Secret) != "secret key" {
+			t.Errorf("unexpected secret: %q", c.(*EncryptedFileCredentialCache).Secret)
+		}
+	})
+
+	t.Run("encrypted no secret", func(t *testing.T) {
+		if _, err := NewCredentialCacher(EncryptedFileCacheType, "path", nil); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("external", func(t *testing.T) {
+		c, err := NewCredentialCacher(ExternalCacheType, "/path/to/.aws_session_token_x", &Options{Command: "helper"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.(*ExternalCredentialCache).Key != ".aws_session_token_x" {
+			t.Error("bad cache key")
+		}
+	})
+
+	t.Run("external no command", func(t *testing.T) {
+		if _, err := NewCredentialCacher(ExternalCacheType, "path", nil); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := NewCredentialCacher("bogus", "path", nil); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
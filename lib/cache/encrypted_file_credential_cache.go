@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// Number of PBKDF2 iterations used to derive the encryption key from the secret
+	kdfIterations = 100000
+	kdfSaltLength = 16
+)
+
+// EncryptedFileCredentialCache is a CredentialCacher implementation which will cache credentials in a local file,
+// encrypted using AES-256-GCM.  The encryption key is derived from the Secret value (a passphrase, or the contents
+// of a key file) using PBKDF2-HMAC-SHA256, with a random salt which is stored alongside the encrypted data.
+type EncryptedFileCredentialCache struct {
+	Path   string
+	Secret []byte
+	lock   sync.Mutex
+	flock  fileLock
+}
+
+// the format of the data written to the cache file, []byte fields are serialized as base64 strings
+type encryptedCredentials struct {
+	Salt  []byte
+	Nonce []byte
+	Data  []byte
+}
+
+// Store the provided credentials to the file as an encrypted JSON representation
+func (c *EncryptedFileCredentialCache) Store(cred *CacheableCredentials) error {
+	if cred == nil {
+		return fmt.Errorf("nil credentials")
+	}
+
+	j, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+
+	e := &encryptedCredentials{Salt: make([]byte, kdfSaltLength)}
+	if _, err := io.ReadFull(rand.Reader, e.Salt); err != nil {
+		return err
+	}
+
+	gcm, err := c.cipher(e.Salt)
+	if err != nil {
+		return err
+	}
+
+	e.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, e.Nonce); err != nil {
+		return err
+	}
+	e.Data = gcm.Seal(nil, e.Nonce, j, c.additionalData())
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return writeCacheFile(c.Path, data)
+}
+
+// Fetch the cached credentials from the file, and decrypt them
+func (c *EncryptedFileCredentialCache) Fetch() (*CacheableCredentials, error) {
+	data, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	e := new(encryptedCredentials)
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+
+	gcm, err := c.cipher(e.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(e.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce in encrypted cache file")
+	}
+
+	j, err := gcm.Open(nil, e.Nonce, e.Data, c.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt cache file: %v", err)
+	}
+
+	cred := new(CacheableCredentials)
+	if err := json.Unmarshal(j, cred); err != nil {
+		return nil, err
+	}
+
+	return cred, nil
+}
+
+// Lock acquires an exclusive lock shared by all processes using the cache file
+func (c *EncryptedFileCredentialCache) Lock() error {
+	return c.flock.lock(c.Path)
+}
+
+// Unlock releases the lock acquired by Lock
+func (c *EncryptedFileCredentialCache) Unlock() error {
+	return c.flock.unlock()
+}
+
+func (c *EncryptedFileCredentialCache) cipher(salt []byte) (cipher.AEAD, error) {
+	if len(c.Secret) < 1 {
+		return nil, fmt.Errorf("empty encryption secret")
+	}
+
+	k, err := pbkdf2Key(c.Secret, salt, kdfIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(b)
+}
+
+// bind the encrypted data to the name of the cache file, so the contents of one cache file can't be swapped for another
+func (c *EncryptedFileCredentialCache) additionalData() []byte {
+	return []byte(filepath.Base(c.Path))
+}
+
+// PBKDF2 (RFC 8018) using HMAC-SHA256 as the pseudo-random function
+func pbkdf2Key(secret, salt []byte, iter, keyLen int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, string(secret), salt, iter, keyLen)
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedFileCredentialCache(t *testing.T) {
+	f := ".enc-cred-cache"
+	defer os.Remove(f)
+
+	cred := &CacheableCredentials{Expiration: 12345}
+	cred.AccessKeyID = "AKIAM0CK"
+	cred.SecretAccessKey = "s3cReTK3Y"
+
+	t.Run("good", func(t *testing.T) {
+		c := &EncryptedFileCredentialCache{Path: f, Secret: []byte("passphrase")}
+		if err := c.Store(cred); err != nil {
+			t.Error(err)
+			return
+		}
+
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if strings.Contains(string(data), cred.SecretAccessKey) {
+			t.Error("secret key stored in plaintext")
+		}
+
+		r, err := c.Fetch()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if r.AccessKeyID != cred.AccessKeyID || r.SecretAccessKey != cred.SecretAccessKey || r.Expiration != cred.Expiration {
+			t.Error("credential mismatch")
+		}
+	})
+
+	t.Run("bad secret", func(t *testing.T) {
+		c := &EncryptedFileCredentialCache{Path: f, Secret: []byte("wrong")}
+		if _, err := c.Fetch(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("empty secret", func(t *testing.T) {
+		c := &EncryptedFileCredentialCache{Path: f}
+		if err := c.Store(cred); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("nil-cred", func(t *testing.T) {
+		c := &EncryptedFileCredentialCache{Path: f, Secret: []byte("passphrase")}
+		if err := c.Store(nil); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("no file", func(t *testing.T) {
+		c := &EncryptedFileCredentialCache{Path: "this-is-not-a-file", Secret: []byte("passphrase")}
+		if _, err := c.Fetch(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
+
+func TestPbkdf2Key(t *testing.T) {
+	// RFC 7914 section 11 PBKDF2-HMAC-SHA256 test vector
+	k, err := pbkdf2Key([]byte("passwd"), []byte("salt"), 1, 64)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	e := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if hex.EncodeToString(k) != e {
+		t.Error("derived key mismatch")
+	}
+}
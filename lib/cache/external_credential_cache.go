@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const (
+	// ExternalCacheStoreAction is the value of the Action field sent to the external cache helper to store credentials
+	ExternalCacheStoreAction = "store"
+	// ExternalCacheFetchAction is the value of the Action field sent to the external cache helper to fetch credentials
+	ExternalCacheFetchAction = "fetch"
+)
+
+// ExternalCredentialCache is a CredentialCacher implementation which delegates the storage of credentials to an
+// external helper program.  The Command is executed using the system shell, and is sent a JSON document on stdin
+// containing the Action ("store" or "fetch"), the Key identifying the cached credentials, and for the store action,
+// the Credentials to cache (in the same format as the FileCredentialCache).  For the fetch action, the helper must
+// write the JSON representation of the cached credentials to stdout.  A non-zero exit status from the helper is
+// treated as an error, for the fetch action this will cause the credentials to be refreshed.
+type ExternalCredentialCache struct {
+	Command string
+	Key     string
+}
+
+// ExternalCacheRequest is the JSON document sent on stdin to the external cache helper
+type ExternalCacheRequest struct {
+	Action      string
+	Key         string
+	Credentials *CacheableCredentials `json:",omitempty"`
+}
+
+// Store the provided credentials using the external helper
+func (c *ExternalCredentialCache) Store(cred *CacheableCredentials) error {
+	if cred == nil {
+		return fmt.Errorf("nil credentials")
+	}
+
+	_, err := c.run(&ExternalCacheRequest{Action: ExternalCacheStoreAction, Key: c.Key, Credentials: cred})
+	return err
+}
+
+// Fetch the cached credentials using the external helper
+func (c *ExternalCredentialCache) Fetch() (*CacheableCredentials, error) {
+	out, err := c.run(&ExternalCacheRequest{Action: ExternalCacheFetchAction, Key: c.Key})
+	if err != nil {
+		return nil, err
+	}
+
+	cred := new(CacheableCredentials)
+	if err := json.Unmarshal(out, cred); err != nil {
+		return nil, err
+	}
+
+	return cred, nil
+}
+
+func (c *ExternalCredentialCache) run(req *ExternalCacheRequest) ([]byte, error) {
+	if len(strings.TrimSpace(c.Command)) < 1 {
+		return nil, fmt.Errorf("external cache command not set")
+	}
+
+	j, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd.exe", "/C", c.Command)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", c.Command)
+	}
+
+	out := new(bytes.Buffer)
+	cmd.Stdin = bytes.NewReader(j)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("external cache command failed: %v", err)
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Not a real test, this is the external cache helper invoked by the tests below
+func TestExternalHelperProcess(t *testing.T) {
+	f, ok := os.LookupEnv("EXTERNAL_CACHE_HELPER_FILE")
+	if !ok {
+		return
+	}
+	defer os.Exit(0)
+
+	req := new(ExternalCacheRequest)
+	if err := json.NewDecoder(os.Stdin).Decode(req); err != nil {
+		os.Exit(2)
+	}
+
+	switch req.Action {
+	case ExternalCacheStoreAction:
+		j, _ := json.Marshal(req.Credentials)
+		if err := ioutil.WriteFile(f+req.Key, j, 0600); err != nil {
+			os.Exit(1)
+		}
+	case ExternalCacheFetchAction:
+		j, err := ioutil.ReadFile(f + req.Key)
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Stdout.Write(j)
+	}
+}
+
+func TestExternalCredentialCache(t *testing.T) {
+	f := ".ext-cred-cache-"
+	os.Setenv("EXTERNAL_CACHE_HELPER_FILE", f)
+	defer os.Unsetenv("EXTERNAL_CACHE_HELPER_FILE")
+	defer os.Remove(f + "k")
+
+	cmd := fmt.Sprintf("%s -test.run=TestExternalHelperProcess", os.Args[0])
+
+	t.Run("good", func(t *testing.T) {
+		cred := &CacheableCredentials{Expiration: 12345}
+		cred.AccessKeyID = "AKIAM0CK"
+
+		c := &ExternalCredentialCache{Command: cmd, Key: "k"}
+		if err := c.Store(cred); err != nil {
+			t.Error(err)
+			return
+		}
+
+		r, err := c.Fetch()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if r.AccessKeyID != cred.AccessKeyID || r.Expiration != cred.Expiration {
+			t.Error("credential mismatch")
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		c := &ExternalCredentialCache{Command: cmd, Key: "missing"}
+		if _, err := c.Fetch(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("no command", func(t *testing.T) {
+		c := &ExternalCredentialCache{Key: "k"}
+		if _, err := c.Fetch(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("nil-cred", func(t *testing.T) {
+		c := &ExternalCredentialCache{Command: cmd, Key: "k"}
+		if err := c.Store(nil); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
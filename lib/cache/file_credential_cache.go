@@ -9,10 +9,12 @@ import (
 	"sync"
 )
 
-// FileCredentialCache is a CredentialCacher implementation which will cache credentials in a local file
+// FileCredentialCache is a CredentialCacher implementation which will cache credentials in a local file.  The cache
+// also implements the Locker interface, to coordinate credential refreshes between processes sharing the cache file.
 type FileCredentialCache struct {
-	Path string
-	lock sync.Mutex
+	Path  string
+	lock  sync.Mutex
+	flock fileLock
 }
 
 // Store the provided credentials to the file as a serialized JSON representation
@@ -22,10 +24,6 @@ func (c *FileCredentialCache) Store(cred *CacheableCredentials) error {
 		return fmt.Errorf("nil credentials")
 	}
 
-	if err := os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
-		return err
-	}
-
 	j, err := json.Marshal(cred)
 	if err != nil {
 		return err
@@ -33,7 +31,7 @@ func (c *FileCredentialCache) Store(cred *CacheableCredentials) error {
 
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	return ioutil.WriteFile(c.Path, j, 0600|os.ModeExclusive)
+	return writeCacheFile(c.Path, j)
 }
 
 // Fetch the cached credentials from the file
@@ -51,3 +49,47 @@ func (c *FileCredentialCache) Fetch() (*CacheableCredentials, error) {
 
 	return cred, nil
 }
+
+// Lock acquires an exclusive lock shared by all processes using the cache file
+func (c *FileCredentialCache) Lock() error {
+	return c.flock.lock(c.Path)
+}
+
+// Unlock releases the lock acquired by Lock
+func (c *FileCredentialCache) Unlock() error {
+	return c.flock.unlock()
+}
+
+// Write the data to a temp file in the same directory, then rename it to the final path so readers in other processes
+// will only ever see a complete file
+func writeCacheFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if fi, err := os.Stat(path); err == nil && !fi.Mode().IsRegular() {
+		// don't replace things like devices or named pipes, just write to them
+		return ioutil.WriteFile(path, data, 0600)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(f.Name(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
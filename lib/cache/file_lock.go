@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// lockTimeout is how long Lock waits for another process to release the lock before giving up
+	lockTimeout = 15 * time.Second
+	// lockRetryDelay is the time between attempts to acquire the lock
+	lockRetryDelay = 100 * time.Millisecond
+)
+
+// Locker is the interface implemented by credential caches which can be exclusively locked across processes.  Credential
+// providers will hold the lock while refreshing credentials, so concurrent processes wait for the refreshed credentials
+// to be stored in the cache, instead of each calling the AWS API (and prompting for an MFA code) to get their own.  Lock
+// returns an error if the lock is not acquired within a bounded time, so an abandoned process (like one waiting at an
+// MFA prompt) can't block other processes using the cache.
+type Locker interface {
+	Lock() error
+	Unlock() error
+}
+
+// fileLock is an advisory lock on a file alongside the cache file.  The lock file is never removed, since
+// removing it would allow another process to lock a new file while the old one is still locked.
+type fileLock struct {
+	f  *os.File
+	mu sync.Mutex
+}
+
+// lock acquires the exclusive lock on the lock file for the cache file at path, waiting up to lockTimeout for
+// the lock to be released if it's held by another process (or another cache in this process)
+func (l *fileLock) lock(path string) error {
+	lf := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lf), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(lf, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		if ok {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			f.Close()
+			return fmt.Errorf("timed out waiting for lock on %s", lf)
+		}
+		time.Sleep(lockRetryDelay)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.f = f
+	return nil
+}
+
+// unlock releases the lock
+func (l *fileLock) unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+
+	err := unlockFile(l.f)
+	l.f.Close()
+	l.f = nil
+	return err
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileCredentialCache_Lock(t *testing.T) {
+	f := ".lock-cred-cache"
+	defer os.Remove(f + ".lock")
+
+	c1 := &FileCredentialCache{Path: f}
+	c2 := &FileCredentialCache{Path: f}
+
+	if err := c1.Lock(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	ch := make(chan bool)
+	go func() {
+		if err := c2.Lock(); err != nil {
+			t.Error(err)
+		}
+		ch <- true
+		c2.Unlock()
+	}()
+
+	select {
+	case <-ch:
+		t.Error("acquired lock held by another cache")
+		return
+	case <-time.After(250 * time.Millisecond):
+	}
+
+	if err := c1.Unlock(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Error("lock was not released")
+	}
+}
+
+func TestFileCredentialCache_LockTimeout(t *testing.T) {
+	f := ".lock-timeout-cred-cache"
+	defer os.Remove(f + ".lock")
+
+	orig := lockTimeout
+	lockTimeout = 250 * time.Millisecond
+	defer func() { lockTimeout = orig }()
+
+	c1 := &FileCredentialCache{Path: f}
+	c2 := &FileCredentialCache{Path: f}
+
+	if err := c1.Lock(); err != nil {
+		t.Error(err)
+		return
+	}
+	defer c1.Unlock()
+
+	if err := c2.Lock(); err == nil {
+		c2.Unlock()
+		t.Error("did not receive expected error")
+	}
+}
+
+func TestFileCredentialCache_Unlock(t *testing.T) {
+	t.Run("not locked", func(t *testing.T) {
+		c := &FileCredentialCache{Path: ".lock-cred-cache"}
+		if err := c.Unlock(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestWriteCacheFile(t *testing.T) {
+	d := ".cache-dir"
+	f := filepath.Join(d, "cache")
+	defer os.RemoveAll(d)
+
+	t.Run("create", func(t *testing.T) {
+		if err := writeCacheFile(f, []byte("first")); err != nil {
+			t.Error(err)
+			return
+		}
+
+		fi, err := os.Stat(f)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if fi.Mode().Perm() != 0600 {
+			t.Errorf("bad file permissions: %v", fi.Mode().Perm())
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		if err := writeCacheFile(f, []byte("second")); err != nil {
+			t.Error(err)
+			return
+		}
+
+		files, _ := filepath.Glob(filepath.Join(d, "*"))
+		if len(files) != 1 {
+			t.Errorf("unexpected files in cache dir: %v", files)
+		}
+	})
+}
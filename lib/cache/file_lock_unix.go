@@ -0,0 +1,21 @@
+// +build !windows
+
+package cache
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLockFile attempts to acquire the exclusive lock on f without blocking, false is returned if the lock is held elsewhere
+func tryLockFile(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MemoryCredentialCache is a CredentialCacher implementation which will cache credentials in the memory of the running
+// process.  Credentials cached using this type are never written to disk, and are lost when the process exits.
+type MemoryCredentialCache struct {
+	creds *CacheableCredentials
+	lock  sync.RWMutex
+}
+
+// Store the provided credentials in memory
+func (c *MemoryCredentialCache) Store(cred *CacheableCredentials) error {
+	if cred == nil {
+		return fmt.Errorf("nil credentials")
+	}
+
+	// store a copy, so changes made by the caller after calling Store() aren't reflected in the cache
+	cc := *cred
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.creds = &cc
+	return nil
+}
+
+// Fetch the cached credentials from memory
+func (c *MemoryCredentialCache) Fetch() (*CacheableCredentials, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.creds == nil {
+		return nil, fmt.Errorf("credentials not found in cache")
+	}
+
+	cc := *c.creds
+	return &cc, nil
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryCredentialCache(t *testing.T) {
+	c := new(MemoryCredentialCache)
+
+	t.Run("empty", func(t *testing.T) {
+		if _, err := c.Fetch(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("nil-cred", func(t *testing.T) {
+		if err := c.Store(nil); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("good", func(t *testing.T) {
+		cred := &CacheableCredentials{Expiration: time.Now().Unix()}
+		cred.AccessKeyID = "AKIAM0CK"
+
+		if err := c.Store(cred); err != nil {
+			t.Error(err)
+			return
+		}
+		cred.AccessKeyID = "changed"
+
+		r, err := c.Fetch()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if r.AccessKeyID != "AKIAM0CK" {
+			t.Error("access key mismatch")
+		}
+
+		if r.Expiration != cred.Expiration {
+			t.Error("expiration mismatch")
+		}
+	})
+}
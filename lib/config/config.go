@@ -30,7 +30,30 @@ const (
 	ProfileEnvVar = "AWS_PROFILE"
 	// DefaultProfileEnvVar is the environment variable to define the name of the default AWS profile, if different from the SDK default 'default'
 	DefaultProfileEnvVar = "AWS_DEFAULT_PROFILE"
-	sourceProfileKey     = "source_profile"
+	// CacheTypeEnvVar is the environment variable to define the type of credential cache to use (file, memory, encrypted-file, external)
+	CacheTypeEnvVar = "CREDENTIAL_CACHE"
+	// CacheKeyFileEnvVar is the environment variable to define the path of the file containing the encrypted-file cache secret
+	CacheKeyFileEnvVar = "CREDENTIAL_CACHE_KEY_FILE"
+	// CacheCommandEnvVar is the environment variable to define the helper command used by the external credential cache
+	CacheCommandEnvVar = "CREDENTIAL_CACHE_COMMAND"
+	// WebIdentityTokenFileEnvVar is the environment variable to define the path of the file containing a web identity (OIDC) token
+	WebIdentityTokenFileEnvVar = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	// RoleArnEnvVar is the environment variable to define the ARN of the role to assume using the web identity token
+	RoleArnEnvVar = "AWS_ROLE_ARN"
+	// SamlAuthUrlEnvVar is the environment variable to define the SAML identity provider login URL
+	SamlAuthUrlEnvVar = "SAML_AUTH_URL"
+	// SamlUsernameEnvVar is the environment variable to define the user name used to log in to the SAML identity provider
+	SamlUsernameEnvVar = "SAML_USERNAME"
+	// MfaTokenProviderEnvVar is the environment variable to define how MFA codes are provided (stdin, tty, command, totp, askpass)
+	MfaTokenProviderEnvVar = "MFA_TOKEN_PROVIDER"
+	// MfaTokenCommandEnvVar is the environment variable to define the command used by the command and askpass MFA token providers
+	MfaTokenCommandEnvVar = "MFA_TOKEN_COMMAND"
+	// MfaTotpSecretFileEnvVar is the environment variable to define the path of the file containing the TOTP secret
+	MfaTotpSecretFileEnvVar = "MFA_TOTP_SECRET_FILE"
+	// MfaTotpSecretCommandEnvVar is the environment variable to define the command which prints the TOTP secret
+	MfaTotpSecretCommandEnvVar = "MFA_TOTP_SECRET_COMMAND"
+	sourceProfileKey           = "source_profile"
+	mfaSectionPrefix           = "mfa "
 )
 
 // ConfigResolver is the interface for retrieving AWS SDK configuration from a source
@@ -48,6 +71,95 @@ type AwsConfig struct {
 	RoleArn         string        `ini:"role_arn"`
 	ExternalID      string        `ini:"external_id"`
 	SourceProfile   string        `ini:"source_profile"`
+	CacheType       string        `ini:"credential_cache"`
+	CacheKeyFile    string        `ini:"credential_cache_key_file"`
+	CacheCommand    string        `ini:"credential_cache_command"`
+	// MfaSerials is the list of MFA devices allowed for the profile, used to select the device if MfaSerial is not set
+	MfaSerials []string `ini:"mfa_serials" delim:","`
+	// RoleAccounts is the list of AWS account IDs used to expand wildcard account IDs in role ARNs when listing roles
+	RoleAccounts []string `ini:"role_accounts" delim:","`
+	// AccountAliasFile is the path of a file mapping AWS account IDs to account aliases, used when listing roles
+	AccountAliasFile string `ini:"account_alias_file"`
+	// MfaDevices is the configuration of individual MFA devices, from the 'mfa <device>' sections of the config file
+	MfaDevices map[string]*MfaDevice `ini:"-"`
+	// MfaTokenProvider is the type of provider used to get MFA codes, see credentials.NewTokenProvider
+	MfaTokenProvider string `ini:"mfa_token_provider"`
+	// MfaTokenCommand is the command used by the command and askpass MFA token providers
+	MfaTokenCommand string `ini:"mfa_token_command"`
+	// MfaTotpSecretFile is the path of the file containing the base32 TOTP secret used by the totp MFA token provider
+	MfaTotpSecretFile string `ini:"mfa_totp_secret_file"`
+	// MfaTotpSecretCommand is the command which prints the base32 TOTP secret, used if MfaTotpSecretFile is not set
+	MfaTotpSecretCommand string `ini:"mfa_totp_secret_command"`
+	// CredentialSource is the source of the credentials used to assume the role, used in place of SourceProfile
+	CredentialSource string `ini:"credential_source"`
+	// WebIdentityTokenFile is the path to a file containing a web identity (OIDC) token used to assume the role
+	WebIdentityTokenFile string `ini:"web_identity_token_file"`
+	// SamlAuthUrl is the SAML identity provider login URL used to get the SAML assertion for assuming the role
+	SamlAuthUrl string `ini:"saml_auth_url"`
+	// SamlUsername is the user name used to log in to the SAML identity provider
+	SamlUsername string `ini:"saml_username"`
+	// SsoStartUrl is the AWS SSO user portal URL
+	SsoStartUrl string `ini:"sso_start_url"`
+	// SsoRegion is the AWS region hosting the AWS SSO service, if not set Region is used
+	SsoRegion string `ini:"sso_region"`
+	// SsoAccountID is the AWS account ID of the AWS SSO role
+	SsoAccountID string `ini:"sso_account_id"`
+	// SsoRoleName is the name of the AWS SSO role (permission set) to get credentials for
+	SsoRoleName string `ini:"sso_role_name"`
+	// Ec2InstanceID is the instance ID returned by the EC2 metadata service, a random ID is used if not set
+	Ec2InstanceID string `ini:"ec2_instance_id"`
+	// Ec2InstanceType is the instance type returned by the EC2 metadata service
+	Ec2InstanceType string `ini:"ec2_instance_type"`
+	// Ec2ImageID is the AMI ID returned by the EC2 metadata service, a random ID is used if not set
+	Ec2ImageID string `ini:"ec2_ami_id"`
+	// Ec2Hostname is the hostname returned by the EC2 metadata service, the local hostname is used if not set
+	Ec2Hostname string `ini:"ec2_hostname"`
+	// Ec2LocalIPv4 is the private IP address returned by the EC2 metadata service
+	Ec2LocalIPv4 string `ini:"ec2_local_ipv4"`
+	// RoleChain is the list of intermediate roles which must be assumed, in order, to get the credentials used to
+	// assume RoleArn.  It is populated when the source_profile of a profile is another role profile.
+	RoleChain []*AwsConfig `ini:"-"`
+}
+
+// MfaDevice is the MFA token provider configuration for a single MFA device, set in a config file section named
+// 'mfa <device>', where device is the device serial number (or ARN), or the name of a virtual MFA device (the last
+// part of the device ARN).  Settings in the device section override the MFA token provider settings of the profile.
+type MfaDevice struct {
+	MfaTokenProvider     string `ini:"mfa_token_provider"`
+	MfaTokenCommand      string `ini:"mfa_token_command"`
+	MfaTotpSecretFile    string `ini:"mfa_totp_secret_file"`
+	MfaTotpSecretCommand string `ini:"mfa_totp_secret_command"`
+}
+
+// MfaDeviceConfig returns a copy of the configuration with the MFA token provider settings for the MFA device with the
+// provided serial number applied.  If there's no configuration for the device, the copy has the profile's settings.
+func (c *AwsConfig) MfaDeviceConfig(serial string) *AwsConfig {
+	n := *c
+
+	d, ok := c.MfaDevices[serial]
+	if !ok {
+		d, ok = c.MfaDevices[serial[strings.LastIndex(serial, "/")+1:]]
+	}
+
+	if ok {
+		if len(d.MfaTokenProvider) > 0 {
+			n.MfaTokenProvider = d.MfaTokenProvider
+		}
+
+		if len(d.MfaTokenCommand) > 0 {
+			n.MfaTokenCommand = d.MfaTokenCommand
+		}
+
+		if len(d.MfaTotpSecretFile) > 0 {
+			n.MfaTotpSecretFile = d.MfaTotpSecretFile
+		}
+
+		if len(d.MfaTotpSecretCommand) > 0 {
+			n.MfaTotpSecretCommand = d.MfaTotpSecretCommand
+		}
+	}
+
+	return &n
 }
 
 type configResolver struct {
@@ -92,7 +204,7 @@ func (r *configResolver) WithLogger(l *simple_logger.Logger) *configResolver {
 func (r *configResolver) ListProfiles(roles bool) []string {
 	profiles := make([]string, 0)
 	for _, s := range r.file.Sections() {
-		if s.Name() == ini.DEFAULT_SECTION {
+		if s.Name() == ini.DEFAULT_SECTION || strings.HasPrefix(s.Name(), mfaSectionPrefix) {
 			continue
 		}
 
@@ -119,6 +231,8 @@ func (r *configResolver) ListProfiles(roles bool) []string {
 //   to provide a consolidated AwsConfig according to the following order of precedence (lowest to highest):
 //   - Default config section, source_profile configuration, profile configuration, environment variables, user-supplied config
 func (r *configResolver) ResolveConfig(profile string) (*AwsConfig, error) {
+	var roleChain []*AwsConfig
+
 	// config file may not exist and config could be baked fully through env vars, so don't barf on errors
 	r.ResolveDefaultConfig()
 
@@ -131,11 +245,25 @@ func (r *configResolver) ResolveConfig(profile string) (*AwsConfig, error) {
 		if err == nil {
 			src := p.Key(sourceProfileKey).String()
 			if len(src) > 0 {
-				r.debug("resolving source_profile %s", src)
-				// awscli allows a source_profile without a matching profile section in the config, in which case it will
-				// only reference that profile name for the section name in the credentials file.  Mimic that behavior
-				// by not error checking this call to ResolveProfileConfig()
-				r.sourceConfig, _ = r.ResolveProfileConfig(src)
+				chain, root, err := r.ResolveRoleChain(profile)
+				if err != nil {
+					return nil, err
+				}
+
+				if len(chain) > 0 {
+					// source_profile is a role, resolve the source config from the profile with the credentials
+					r.debug("resolved role chain for profile %s, credentials from %s", profile, root)
+					roleChain = chain
+					src = root
+				}
+
+				if len(src) > 0 {
+					r.debug("resolving source_profile %s", src)
+					// awscli allows a source_profile without a matching profile section in the config, in which case it will
+					// only reference that profile name for the section name in the credentials file.  Mimic that behavior
+					// by not error checking this call to ResolveProfileConfig()
+					r.sourceConfig, _ = r.ResolveProfileConfig(src)
+				}
 			}
 
 			_, err = r.ResolveProfileConfig(profile)
@@ -156,7 +284,43 @@ func (r *configResolver) ResolveConfig(profile string) (*AwsConfig, error) {
 		return nil, err
 	}
 
+	if p := r.profileConfig; p != nil && len(p.WebIdentityTokenFile) < 1 && (len(p.SourceProfile) > 0 || len(p.CredentialSource) > 0) {
+		// like the SDK, profiles with an explicit credential configuration take precedence over web identity env vars
+		r.envConfig.WebIdentityTokenFile = ""
+		r.envConfig.RoleArn = ""
+	}
+
 	c := MergeConfig(r.defaultConfig, r.sourceConfig, r.profileConfig, r.envConfig, r.userConfig)
+
+	if p := r.profileConfig; p != nil && len(p.SamlAuthUrl) < 1 && (len(p.SourceProfile) > 0 || len(p.CredentialSource) > 0 || len(p.WebIdentityTokenFile) > 0 || len(p.SsoStartUrl) > 0) {
+		// a saml_auth_url from the default section or environment doesn't apply to profiles with an explicit credential configuration
+		c.SamlAuthUrl = ""
+	}
+
+	if len(roleChain) > 0 {
+		// the session credentials come from the source_profile of the first role in the chain, not the source_profile
+		// of the profile (which is the last intermediate role in the chain)
+		c.RoleChain = roleChain
+		c.SourceProfile = roleChain[0].SourceProfile
+		c.CredentialSource = roleChain[0].CredentialSource
+		c.WebIdentityTokenFile = roleChain[0].WebIdentityTokenFile
+		c.SamlAuthUrl = roleChain[0].SamlAuthUrl
+
+		if len(roleChain[0].SamlUsername) > 0 {
+			c.SamlUsername = roleChain[0].SamlUsername
+		}
+	}
+
+	if len(c.CredentialSource) > 0 || len(c.WebIdentityTokenFile) > 0 || len(c.SamlAuthUrl) > 0 || len(c.SsoStartUrl) > 0 {
+		// don't use the source_profile inherited from the default section
+		c.SourceProfile = ""
+	}
+
+	c.MfaDevices, err = r.ResolveMfaDevices()
+	if err != nil {
+		return nil, err
+	}
+
 	if c.SessionDuration < 1 {
 		c.SessionDuration = credentials.SessionTokenDefaultDuration
 	}
@@ -169,11 +333,77 @@ func (r *configResolver) ResolveConfig(profile string) (*AwsConfig, error) {
 	return c, nil
 }
 
+// ResolveMfaDevices returns the configuration of the MFA devices set in the 'mfa <device>' sections of the config file,
+// keyed by the device name in the section name
+func (r *configResolver) ResolveMfaDevices() (map[string]*MfaDevice, error) {
+	devices := make(map[string]*MfaDevice)
+
+	for _, s := range r.file.Sections() {
+		if !strings.HasPrefix(s.Name(), mfaSectionPrefix) {
+			continue
+		}
+
+		d := new(MfaDevice)
+		if err := s.MapTo(d); err != nil {
+			return nil, err
+		}
+		devices[strings.TrimSpace(strings.TrimPrefix(s.Name(), mfaSectionPrefix))] = d
+	}
+
+	return devices, nil
+}
+
+// ResolveRoleChain follows the source_profile attribute of the named profile through any profiles which are also
+// configured with a role_arn, to support assuming a role using the credentials of another role.  The returned list
+// contains the configuration of each intermediate role, in the order they must be assumed, and does not include the
+// named profile.  The name of the first profile in the source_profile chain without a role_arn (the profile providing
+// the credentials for the chain) is also returned.  An error is returned if the chain references a profile more than once.
+func (r *configResolver) ResolveRoleChain(profile string) ([]*AwsConfig, string, error) {
+	chain := make([]*AwsConfig, 0)
+	names := []string{profile}
+	seen := map[string]bool{profile: true}
+
+	p, err := r.file.Profile(profile)
+	if err != nil {
+		return nil, "", err
+	}
+	src := p.Key(sourceProfileKey).String()
+
+	for len(src) > 0 {
+		names = append(names, src)
+		if seen[src] {
+			return nil, "", fmt.Errorf("source_profile loop detected: %s", strings.Join(names, " -> "))
+		}
+		seen[src] = true
+
+		s, err := r.file.Profile(src)
+		if err != nil || !s.HasKey("role_arn") {
+			// profile only found in the credentials file, or has no role, this is where the chain's credentials come from
+			break
+		}
+
+		c := new(AwsConfig)
+		if err := s.MapTo(c); err != nil {
+			return nil, "", err
+		}
+
+		if err := validateCredentialSource(src, c); err != nil {
+			return nil, "", err
+		}
+
+		chain = append([]*AwsConfig{c}, chain...)
+		src = c.SourceProfile
+	}
+
+	return chain, src, nil
+}
+
 // ResolveDefaultConfig will look up configuration information in the 'default' section of the AWS SDK configuration
 // file.  The default section name can be overridden by setting the AWS_DEFAULT_PROFILE environment variable.  The config
 // file location can be overridden by setting the AWS_CONFIG_FILE environment variable.  While any valid configuration
 // property may be specified in the default section, this method will only return the settings for the 'region',
-// 'session_token_duration', and 'credentials_duration' properties, to avoid possible conflict with role-specific configuration
+// 'session_token_duration', 'credentials_duration', credential cache, MFA token provider, 'mfa_serials' and SAML
+// properties, to avoid possible conflict with role-specific configuration
 func (r *configResolver) ResolveDefaultConfig() (*AwsConfig, error) {
 	p := config.DefaultProfileName
 	if v, ok := os.LookupEnv(DefaultProfileEnvVar); ok {
@@ -191,7 +421,11 @@ func (r *configResolver) ResolveDefaultConfig() (*AwsConfig, error) {
 	if err := s.MapTo(c); err != nil {
 		return nil, err
 	}
-	r.defaultConfig = &AwsConfig{Region: c.Region, SessionDuration: c.SessionDuration, RoleDuration: c.RoleDuration, SourceProfile: p}
+	r.defaultConfig = &AwsConfig{Region: c.Region, SessionDuration: c.SessionDuration, RoleDuration: c.RoleDuration, SourceProfile: p,
+		CacheType: c.CacheType, CacheKeyFile: c.CacheKeyFile, CacheCommand: c.CacheCommand, SamlAuthUrl: c.SamlAuthUrl,
+		SamlUsername: c.SamlUsername, MfaTokenProvider: c.MfaTokenProvider, MfaTokenCommand: c.MfaTokenCommand,
+		MfaTotpSecretFile: c.MfaTotpSecretFile, MfaTotpSecretCommand: c.MfaTotpSecretCommand, MfaSerials: c.MfaSerials,
+		RoleAccounts: c.RoleAccounts, AccountAliasFile: c.AccountAliasFile}
 
 	r.debug("DEFAULT CONFIG: %+v", *r.defaultConfig)
 	return r.defaultConfig, nil
@@ -212,6 +446,10 @@ func (r *configResolver) ResolveProfileConfig(profile string) (*AwsConfig, error
 	if err := s.MapTo(c); err != nil {
 		return nil, err
 	}
+
+	if err := validateCredentialSource(profile, c); err != nil {
+		return nil, err
+	}
 	r.profileConfig = c
 
 	r.debug("PROFILE '%s' CONFIG: %+v", profile, *r.profileConfig)
@@ -220,7 +458,9 @@ func (r *configResolver) ResolveProfileConfig(profile string) (*AwsConfig, error
 
 // Consult the following environment variables for setting configuration values:
 // AWS_DEFAULT_REGION, AWS_REGION (will override AWS_DEFAULT_REGION), MFA_SERIAL, EXTERNAL_ID,
-// SESSION_TOKEN_DURATION, CREDENTIALS_DURATION
+// SESSION_TOKEN_DURATION, CREDENTIALS_DURATION, CREDENTIAL_CACHE, CREDENTIAL_CACHE_KEY_FILE, CREDENTIAL_CACHE_COMMAND,
+// AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN (only used if both are set), SAML_AUTH_URL, SAML_USERNAME,
+// MFA_TOKEN_PROVIDER, MFA_TOKEN_COMMAND, MFA_TOTP_SECRET_FILE, MFA_TOTP_SECRET_COMMAND
 func (r *configResolver) ResolveEnvConfig() (*AwsConfig, error) {
 	c := new(AwsConfig)
 
@@ -240,6 +480,49 @@ func (r *configResolver) ResolveEnvConfig() (*AwsConfig, error) {
 		c.ExternalID = v
 	}
 
+	if v, ok := os.LookupEnv(CacheTypeEnvVar); ok {
+		c.CacheType = v
+	}
+
+	if v, ok := os.LookupEnv(CacheKeyFileEnvVar); ok {
+		c.CacheKeyFile = v
+	}
+
+	if v, ok := os.LookupEnv(CacheCommandEnvVar); ok {
+		c.CacheCommand = v
+	}
+
+	if f, ok := os.LookupEnv(WebIdentityTokenFileEnvVar); ok {
+		if a, ok := os.LookupEnv(RoleArnEnvVar); ok {
+			c.WebIdentityTokenFile = f
+			c.RoleArn = a
+		}
+	}
+
+	if v, ok := os.LookupEnv(SamlAuthUrlEnvVar); ok {
+		c.SamlAuthUrl = v
+	}
+
+	if v, ok := os.LookupEnv(SamlUsernameEnvVar); ok {
+		c.SamlUsername = v
+	}
+
+	if v, ok := os.LookupEnv(MfaTokenProviderEnvVar); ok {
+		c.MfaTokenProvider = v
+	}
+
+	if v, ok := os.LookupEnv(MfaTokenCommandEnvVar); ok {
+		c.MfaTokenCommand = v
+	}
+
+	if v, ok := os.LookupEnv(MfaTotpSecretFileEnvVar); ok {
+		c.MfaTotpSecretFile = v
+	}
+
+	if v, ok := os.LookupEnv(MfaTotpSecretCommandEnvVar); ok {
+		c.MfaTotpSecretCommand = v
+	}
+
 	if v, ok := os.LookupEnv(SessionDurationEnvVar); ok {
 		d, err := time.ParseDuration(v)
 		if err != nil {
@@ -281,6 +564,34 @@ func MergeConfig(conf ...*AwsConfig) *AwsConfig {
 				cfg.RoleArn = c.RoleArn
 			}
 
+			if len(c.MfaSerials) > 0 {
+				cfg.MfaSerials = c.MfaSerials
+			}
+
+			if len(c.RoleAccounts) > 0 {
+				cfg.RoleAccounts = c.RoleAccounts
+			}
+
+			if len(c.AccountAliasFile) > 0 {
+				cfg.AccountAliasFile = c.AccountAliasFile
+			}
+
+			if len(c.MfaTokenProvider) > 0 {
+				cfg.MfaTokenProvider = c.MfaTokenProvider
+			}
+
+			if len(c.MfaTokenCommand) > 0 {
+				cfg.MfaTokenCommand = c.MfaTokenCommand
+			}
+
+			if len(c.MfaTotpSecretFile) > 0 {
+				cfg.MfaTotpSecretFile = c.MfaTotpSecretFile
+			}
+
+			if len(c.MfaTotpSecretCommand) > 0 {
+				cfg.MfaTotpSecretCommand = c.MfaTotpSecretCommand
+			}
+
 			if len(c.ExternalID) > 0 {
 				cfg.MfaSerial = c.MfaSerial
 			}
@@ -293,6 +604,74 @@ func MergeConfig(conf ...*AwsConfig) *AwsConfig {
 				cfg.ExternalID = c.ExternalID
 			}
 
+			if len(c.CredentialSource) > 0 {
+				cfg.CredentialSource = c.CredentialSource
+			}
+
+			if len(c.WebIdentityTokenFile) > 0 {
+				cfg.WebIdentityTokenFile = c.WebIdentityTokenFile
+			}
+
+			if len(c.SamlAuthUrl) > 0 {
+				cfg.SamlAuthUrl = c.SamlAuthUrl
+			}
+
+			if len(c.SamlUsername) > 0 {
+				cfg.SamlUsername = c.SamlUsername
+			}
+
+			if len(c.SsoStartUrl) > 0 {
+				cfg.SsoStartUrl = c.SsoStartUrl
+			}
+
+			if len(c.SsoRegion) > 0 {
+				cfg.SsoRegion = c.SsoRegion
+			}
+
+			if len(c.SsoAccountID) > 0 {
+				cfg.SsoAccountID = c.SsoAccountID
+			}
+
+			if len(c.SsoRoleName) > 0 {
+				cfg.SsoRoleName = c.SsoRoleName
+			}
+
+			if len(c.Ec2InstanceID) > 0 {
+				cfg.Ec2InstanceID = c.Ec2InstanceID
+			}
+
+			if len(c.Ec2InstanceType) > 0 {
+				cfg.Ec2InstanceType = c.Ec2InstanceType
+			}
+
+			if len(c.Ec2ImageID) > 0 {
+				cfg.Ec2ImageID = c.Ec2ImageID
+			}
+
+			if len(c.Ec2Hostname) > 0 {
+				cfg.Ec2Hostname = c.Ec2Hostname
+			}
+
+			if len(c.Ec2LocalIPv4) > 0 {
+				cfg.Ec2LocalIPv4 = c.Ec2LocalIPv4
+			}
+
+			if len(c.CacheType) > 0 {
+				cfg.CacheType = c.CacheType
+			}
+
+			if len(c.CacheKeyFile) > 0 {
+				cfg.CacheKeyFile = c.CacheKeyFile
+			}
+
+			if len(c.CacheCommand) > 0 {
+				cfg.CacheCommand = c.CacheCommand
+			}
+
+			if len(c.RoleChain) > 0 {
+				cfg.RoleChain = c.RoleChain
+			}
+
 			if c.SessionDuration > 0 {
 				cfg.SessionDuration = c.SessionDuration
 			}
@@ -306,6 +685,23 @@ func MergeConfig(conf ...*AwsConfig) *AwsConfig {
 	return cfg
 }
 
+// the awscli treats setting both source_profile and credential_source in a profile as an error, do the same.  Also
+// don't allow web_identity_token_file, saml_auth_url or sso_start_url to be mixed with them, since it's ambiguous which
+// should be used
+func validateCredentialSource(profile string, c *AwsConfig) error {
+	n := 0
+	for _, v := range []string{c.SourceProfile, c.CredentialSource, c.WebIdentityTokenFile, c.SamlAuthUrl, c.SsoStartUrl} {
+		if len(v) > 0 {
+			n++
+		}
+	}
+
+	if n > 1 {
+		return fmt.Errorf("profile %s has more than one of source_profile, credential_source, web_identity_token_file, saml_auth_url or sso_start_url set, only one is allowed", profile)
+	}
+	return nil
+}
+
 func (r *configResolver) debug(f string, v ...interface{}) {
 	if r.log != nil {
 		r.log.Debugf(f, v...)
@@ -6,6 +6,7 @@ import (
 	"github.com/mmmorris1975/simple-logger"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -404,6 +405,23 @@ func TestConfigResolver_ResolveEnvConfig(t *testing.T) {
 		}
 	})
 
+	t.Run("credential cache", func(t *testing.T) {
+		os.Setenv(CacheTypeEnvVar, "encrypted-file")
+		os.Setenv(CacheKeyFileEnvVar, "/path/to/key")
+		defer os.Unsetenv(CacheTypeEnvVar)
+		defer os.Unsetenv(CacheKeyFileEnvVar)
+
+		c, err := r.ResolveEnvConfig()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.CacheType != "encrypted-file" || c.CacheKeyFile != "/path/to/key" || len(c.CacheCommand) > 0 {
+			t.Error("bad credential cache config")
+		}
+	})
+
 	t.Run("bad session duration", func(t *testing.T) {
 		os.Setenv(SessionDurationEnvVar, "ab")
 		defer os.Unsetenv(SessionDurationEnvVar)
@@ -464,9 +482,9 @@ func TestMergeConfig(t *testing.T) {
 		c := MergeConfig(
 			nil,
 			&AwsConfig{Region: "us-east-1"},
-			&AwsConfig{MfaSerial: "123456", ExternalID: "abcdefg"},
+			&AwsConfig{MfaSerial: "123456", ExternalID: "abcdefg", CacheType: "file"},
 			nil,
-			&AwsConfig{Region: "us-east-2", RoleArn: "my-role"})
+			&AwsConfig{Region: "us-east-2", RoleArn: "my-role", CacheType: "memory"})
 
 		if c == nil {
 			t.Error("unexpected nil config")
@@ -488,6 +506,10 @@ func TestMergeConfig(t *testing.T) {
 		if c.ExternalID != "abcdefg" {
 			t.Error("bad external ID")
 		}
+
+		if c.CacheType != "memory" {
+			t.Error("bad credential cache type")
+		}
 	})
 }
 
@@ -540,3 +562,412 @@ func Example_debug() {
 	// Output:
 	// DEBUG test
 }
+
+func TestConfigResolver_ResolveRoleChain(t *testing.T) {
+	os.Setenv(config.ConfigFileEnvVar, "test/config_chain")
+	defer os.Unsetenv(config.ConfigFileEnvVar)
+
+	r, err := NewConfigResolver(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	t.Run("no chain", func(t *testing.T) {
+		c, root, err := r.ResolveRoleChain("hub")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(c) > 0 || root != "source" {
+			t.Error("unexpected role chain")
+		}
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		c, root, err := r.ResolveRoleChain("leaf")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(c) != 2 || root != "source" {
+			t.Errorf("unexpected role chain: %d %s", len(c), root)
+			return
+		}
+
+		if c[0].RoleArn != "arn:aws:iam::111111111111:role/hub" || c[0].ExternalID != "hub-id" {
+			t.Error("bad first role in chain")
+		}
+
+		if c[1].RoleArn != "arn:aws:iam::222222222222:role/spoke" {
+			t.Error("bad second role in chain")
+		}
+	})
+
+	t.Run("loop", func(t *testing.T) {
+		_, _, err := r.ResolveRoleChain("loop1")
+		if err == nil || !strings.Contains(err.Error(), "loop1 -> loop2 -> loop1") {
+			t.Errorf("did not receive expected error: %v", err)
+		}
+	})
+
+	t.Run("bad profile", func(t *testing.T) {
+		if _, _, err := r.ResolveRoleChain("not-a-profile"); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("resolve config", func(t *testing.T) {
+		c, err := r.ResolveConfig("spoke")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(c.RoleChain) != 1 || c.RoleChain[0].RoleArn != "arn:aws:iam::111111111111:role/hub" {
+			t.Error("bad role chain")
+		}
+
+		if c.SourceProfile != "source" || c.MfaSerial != "ABCDEFG" {
+			t.Error("source profile config not resolved from the start of the chain")
+		}
+
+		if c.RoleArn != "arn:aws:iam::222222222222:role/spoke" {
+			t.Error("bad role arn")
+		}
+	})
+
+	t.Run("resolve config loop", func(t *testing.T) {
+		if _, err := r.ResolveConfig("loop2"); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
+
+func TestConfigResolver_CredentialSource(t *testing.T) {
+	os.Setenv(config.ConfigFileEnvVar, "test/config_chain")
+	defer os.Unsetenv(config.ConfigFileEnvVar)
+
+	r, err := NewConfigResolver(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	t.Run("profile", func(t *testing.T) {
+		c, err := r.ResolveConfig("ec2role")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.CredentialSource != "Ec2InstanceMetadata" || len(c.SourceProfile) > 0 {
+			t.Errorf("bad credential source config: '%s' '%s'", c.CredentialSource, c.SourceProfile)
+		}
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		c, err := r.ResolveConfig("ec2chain")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(c.RoleChain) != 1 || c.RoleChain[0].RoleArn != "arn:aws:iam::111111111111:role/ec2role" {
+			t.Error("bad role chain")
+			return
+		}
+
+		if c.CredentialSource != "Ec2InstanceMetadata" || len(c.SourceProfile) > 0 {
+			t.Errorf("bad credential source config: '%s' '%s'", c.CredentialSource, c.SourceProfile)
+		}
+	})
+
+	t.Run("both set", func(t *testing.T) {
+		_, err := r.ResolveConfig("bad-source")
+		if err == nil || !strings.Contains(err.Error(), "only one is allowed") {
+			t.Errorf("did not receive expected error: %v", err)
+		}
+	})
+}
+
+func TestConfigResolver_WebIdentity(t *testing.T) {
+	os.Setenv(config.ConfigFileEnvVar, "test/config_chain")
+	defer os.Unsetenv(config.ConfigFileEnvVar)
+
+	r, err := NewConfigResolver(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	t.Run("profile", func(t *testing.T) {
+		c, err := r.ResolveConfig("webid")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.WebIdentityTokenFile != "/var/run/secrets/token" || len(c.SourceProfile) > 0 {
+			t.Errorf("bad web identity config: '%s' '%s'", c.WebIdentityTokenFile, c.SourceProfile)
+		}
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		c, err := r.ResolveConfig("webchain")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(c.RoleChain) != 1 || c.WebIdentityTokenFile != "/var/run/secrets/token" || len(c.SourceProfile) > 0 {
+			t.Error("bad web identity role chain config")
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv(WebIdentityTokenFileEnvVar, "token-file")
+		os.Setenv(RoleArnEnvVar, "arn:aws:iam::111111111111:role/env")
+		defer os.Unsetenv(WebIdentityTokenFileEnvVar)
+		defer os.Unsetenv(RoleArnEnvVar)
+
+		// use new resolvers, since they hold the state of the last resolved profile
+		r, _ := NewConfigResolver(nil)
+		c, err := r.ResolveConfig("arn:aws:iam::111111111111:role/env")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.WebIdentityTokenFile != "token-file" || c.RoleArn != "arn:aws:iam::111111111111:role/env" {
+			t.Error("bad web identity env config")
+		}
+
+		// explicit profile credential config wins over the env vars
+		r, _ = NewConfigResolver(nil)
+		c, err = r.ResolveConfig("hub")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(c.WebIdentityTokenFile) > 0 || c.RoleArn != "arn:aws:iam::111111111111:role/hub" {
+			t.Error("web identity env config overrode profile config")
+		}
+	})
+}
+
+func TestConfigResolver_Saml(t *testing.T) {
+	os.Setenv(config.ConfigFileEnvVar, "test/config_chain")
+	defer os.Unsetenv(config.ConfigFileEnvVar)
+
+	t.Run("profile", func(t *testing.T) {
+		r, _ := NewConfigResolver(nil)
+		c, err := r.ResolveConfig("saml")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.SamlAuthUrl != "https://idp.example.com/saml" || c.SamlUsername != "bob" || len(c.SourceProfile) > 0 {
+			t.Error("bad SAML config")
+		}
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		r, _ := NewConfigResolver(nil)
+		c, err := r.ResolveConfig("samlchain")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(c.RoleChain) != 1 || c.SamlAuthUrl != "https://idp.example.com/saml" || c.SamlUsername != "bob" {
+			t.Error("bad SAML role chain config")
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv(SamlAuthUrlEnvVar, "https://idp.example.com/env")
+		os.Setenv(SamlUsernameEnvVar, "alice")
+		defer os.Unsetenv(SamlAuthUrlEnvVar)
+		defer os.Unsetenv(SamlUsernameEnvVar)
+
+		r, _ := NewConfigResolver(nil)
+		c, err := r.ResolveConfig("arn:aws:iam::111111111111:role/env")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.SamlAuthUrl != "https://idp.example.com/env" || c.SamlUsername != "alice" || len(c.SourceProfile) > 0 {
+			t.Error("bad SAML env config")
+		}
+
+		// profiles with a source_profile don't use SAML
+		r, _ = NewConfigResolver(nil)
+		c, err = r.ResolveConfig("hub")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(c.SamlAuthUrl) > 0 || c.SourceProfile != "source" {
+			t.Error("SAML env config overrode profile config")
+		}
+	})
+}
+
+func TestConfigResolver_Sso(t *testing.T) {
+	os.Setenv(config.ConfigFileEnvVar, "test/config_chain")
+	defer os.Unsetenv(config.ConfigFileEnvVar)
+
+	t.Run("profile", func(t *testing.T) {
+		r, _ := NewConfigResolver(nil)
+		c, err := r.ResolveConfig("sso")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.SsoStartUrl != "https://example.awsapps.com/start" || c.SsoRegion != "us-east-2" || c.SsoAccountID != "123456789012" ||
+			c.SsoRoleName != "Admin" || len(c.SourceProfile) > 0 || len(c.RoleArn) > 0 {
+			t.Error("bad SSO config")
+		}
+	})
+
+	t.Run("source profile", func(t *testing.T) {
+		r, _ := NewConfigResolver(nil)
+		c, err := r.ResolveConfig("ssochain")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.SsoStartUrl != "https://example.awsapps.com/start" || c.SsoRoleName != "Admin" || c.RoleArn != "arn:aws:iam::222222222222:role/ssochain" {
+			t.Error("bad SSO source profile config")
+		}
+	})
+}
+
+func TestConfigResolver_MfaTokenProvider(t *testing.T) {
+	os.Setenv(config.ConfigFileEnvVar, "test/config_chain")
+	defer os.Unsetenv(config.ConfigFileEnvVar)
+
+	t.Run("profile", func(t *testing.T) {
+		r, _ := NewConfigResolver(nil)
+		c, err := r.ResolveConfig("totp")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.MfaTokenProvider != "totp" || c.MfaTotpSecretFile != "/path/to/secret" || len(c.MfaTokenCommand) > 0 ||
+			c.MfaTotpSecretCommand != "vault read -field=seed secret/aws" {
+			t.Error("bad MFA token provider config")
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv(MfaTokenProviderEnvVar, "command")
+		os.Setenv(MfaTokenCommandEnvVar, "pass otp aws")
+		defer os.Unsetenv(MfaTokenProviderEnvVar)
+		defer os.Unsetenv(MfaTokenCommandEnvVar)
+
+		r, _ := NewConfigResolver(nil)
+		c, err := r.ResolveConfig("totp")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.MfaTokenProvider != "command" || c.MfaTokenCommand != "pass otp aws" {
+			t.Error("MFA token provider env vars not applied")
+		}
+	})
+}
+
+func TestConfigResolver_MfaDevices(t *testing.T) {
+	os.Setenv(config.ConfigFileEnvVar, "test/config_chain")
+	defer os.Unsetenv(config.ConfigFileEnvVar)
+
+	r, _ := NewConfigResolver(nil)
+	c, err := r.ResolveConfig("multimfa")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	t.Run("serials", func(t *testing.T) {
+		if len(c.MfaSerials) != 2 || c.MfaSerials[1] != "arn:aws:iam::123456789012:mfa/yubikey" {
+			t.Errorf("bad mfa serials: %v", c.MfaSerials)
+		}
+	})
+
+	t.Run("device config", func(t *testing.T) {
+		d := c.MfaDeviceConfig("arn:aws:iam::123456789012:mfa/yubikey")
+		if d.MfaTokenProvider != "command" || d.MfaTokenCommand != "ykman oath accounts code -s aws" {
+			t.Error("device token provider not applied")
+		}
+
+		if len(c.MfaTokenProvider) > 0 {
+			t.Error("device config modified the profile config")
+		}
+	})
+
+	t.Run("no device config", func(t *testing.T) {
+		if d := c.MfaDeviceConfig("arn:aws:iam::123456789012:mfa/phone"); len(d.MfaTokenProvider) > 0 {
+			t.Error("unexpected device token provider")
+		}
+	})
+
+	t.Run("not a profile", func(t *testing.T) {
+		for _, p := range r.ListProfiles(false) {
+			if strings.HasPrefix(p, "mfa ") {
+				t.Error("mfa section listed as a profile")
+			}
+		}
+	})
+}
+
+func TestConfigResolver_RoleDiscovery(t *testing.T) {
+	os.Setenv(config.ConfigFileEnvVar, "test/config_chain")
+	defer os.Unsetenv(config.ConfigFileEnvVar)
+
+	r, _ := NewConfigResolver(nil)
+	c, err := r.ResolveConfig("roleaccounts")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(c.RoleAccounts) != 2 || c.RoleAccounts[1] != "222222222222" {
+		t.Errorf("bad role accounts: %v", c.RoleAccounts)
+	}
+
+	if c.AccountAliasFile != "/path/to/aliases" {
+		t.Errorf("bad account alias file: %s", c.AccountAliasFile)
+	}
+}
+
+func TestConfigResolver_Ec2Instance(t *testing.T) {
+	os.Setenv(config.ConfigFileEnvVar, "test/config_chain")
+	defer os.Unsetenv(config.ConfigFileEnvVar)
+
+	r, _ := NewConfigResolver(nil)
+	c, err := r.ResolveConfig("ec2instance")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if c.Ec2InstanceID != "i-0123456789abcdef0" || c.Ec2InstanceType != "m5.large" || c.Ec2ImageID != "ami-0123456789abcdef0" {
+		t.Errorf("bad instance attributes: %s %s %s", c.Ec2InstanceID, c.Ec2InstanceType, c.Ec2ImageID)
+	}
+
+	if c.Ec2Hostname != "ip-10-0-1-2.ec2.internal" || c.Ec2LocalIPv4 != "10.0.1.2" {
+		t.Errorf("bad instance network attributes: %s %s", c.Ec2Hostname, c.Ec2LocalIPv4)
+	}
+}
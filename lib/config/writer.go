@@ -0,0 +1,123 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mmmorris1975/aws-config/config"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// MergeProfiles adds a profile section to the SDK config file ($HOME/.aws/config or value of AWS_CONFIG_FILE env var)
+// for each of the provided profiles.  Profiles whose name already exists in the file, or whose role_arn is already
+// configured in another profile, are skipped.  New sections are appended to the end of the file, so the existing
+// sections, comments and ordering in the file are left untouched.  If dryRun is true, the file is not changed and
+// a diff of the changes which would be made is written to w.  The names of the added profiles are returned.
+func MergeProfiles(profiles map[string]*AwsConfig, w io.Writer, dryRun bool) ([]string, error) {
+	f, err := config.NewAwsConfigFile(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	roles := make(map[string]bool)
+	for _, s := range f.Sections() {
+		names[strings.TrimPrefix(s.Name(), "profile ")] = true
+		if s.HasKey("role_arn") {
+			roles[s.Key("role_arn").String()] = true
+		}
+	}
+
+	keys := make([]string, 0)
+	for k := range profiles {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	added := make([]string, 0)
+	buf := new(bytes.Buffer)
+	for _, k := range keys {
+		p := profiles[k]
+		if p == nil || names[k] || roles[p.RoleArn] {
+			continue
+		}
+
+		buf.WriteString("\n")
+		buf.WriteString(ProfileSection(k, p))
+		added = append(added, k)
+	}
+
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		// file doesn't end with a newline, don't mangle the last line of the file
+		data = append(data, '\n')
+	}
+
+	if dryRun {
+		return added, writeDiff(w, f.Path, data, buf.Bytes())
+	}
+
+	if len(added) > 0 {
+		if err := ioutil.WriteFile(f.Path, append(data, buf.Bytes()...), 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	return added, nil
+}
+
+// ProfileSection returns the SDK config file section for the named profile.  Only attributes set in the AwsConfig
+// are included in the section.
+func ProfileSection(name string, c *AwsConfig) string {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "[profile %s]\n", name)
+
+	attrs := [][]string{
+		{"role_arn", c.RoleArn}, {"source_profile", c.SourceProfile}, {"mfa_serial", c.MfaSerial},
+		{"external_id", c.ExternalID}, {"region", c.Region},
+	}
+
+	for _, a := range attrs {
+		if len(a[1]) > 0 {
+			fmt.Fprintf(b, "%s = %s\n", a[0], a[1])
+		}
+	}
+
+	if c.SessionDuration > 0 {
+		fmt.Fprintf(b, "session_token_duration = %s\n", c.SessionDuration)
+	}
+
+	if c.RoleDuration > 0 {
+		fmt.Fprintf(b, "credentials_duration = %s\n", c.RoleDuration)
+	}
+
+	return b.String()
+}
+
+// Since MergeProfiles only appends data to the file, the diff will always be a single hunk at the end of the file
+func writeDiff(w io.Writer, path string, orig []byte, add []byte) error {
+	if len(add) < 1 {
+		return nil
+	}
+
+	n := bytes.Count(orig, []byte("\n"))
+	lines := strings.Split(strings.TrimSuffix(string(add), "\n"), "\n")
+
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n@@ -%d,0 +%d,%d @@\n", path, path, n, n+1, len(lines)); err != nil {
+		return err
+	}
+
+	for _, l := range lines {
+		if _, err := fmt.Fprintf(w, "+%s\n", l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
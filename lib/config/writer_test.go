@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"github.com/mmmorris1975/aws-config/config"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeProfiles(t *testing.T) {
+	orig, err := ioutil.ReadFile("test/config")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	f := ".merge-config"
+	os.Setenv(config.ConfigFileEnvVar, f)
+	defer os.Unsetenv(config.ConfigFileEnvVar)
+	defer os.Remove(f)
+
+	p := map[string]*AwsConfig{
+		"new":   {RoleArn: "arn:aws:iam::123456789012:role/new", SourceProfile: "default"},
+		"role1": {RoleArn: "arn:aws:iam::123456789012:role/x"},
+		"dup":   {RoleArn: "role2"},
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		if err := ioutil.WriteFile(f, orig, 0600); err != nil {
+			t.Error(err)
+			return
+		}
+
+		b := new(strings.Builder)
+		a, err := MergeProfiles(p, b, true)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if !reflect.DeepEqual(a, []string{"new"}) {
+			t.Errorf("unexpected profiles added: %v", a)
+		}
+
+		if !strings.Contains(b.String(), "+[profile new]\n+role_arn = arn:aws:iam::123456789012:role/new\n") {
+			t.Errorf("unexpected diff output:\n%s", b.String())
+		}
+
+		data, _ := ioutil.ReadFile(f)
+		if string(data) != string(orig) {
+			t.Error("dry run modified config file")
+		}
+	})
+
+	t.Run("write", func(t *testing.T) {
+		if err := ioutil.WriteFile(f, orig, 0600); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if _, err := MergeProfiles(p, nil, false); err != nil {
+			t.Error(err)
+			return
+		}
+
+		data, _ := ioutil.ReadFile(f)
+		if !strings.HasPrefix(string(data), string(orig)) {
+			t.Error("existing config file content was modified")
+		}
+
+		if !strings.HasSuffix(string(data), "\n[profile new]\nrole_arn = arn:aws:iam::123456789012:role/new\nsource_profile = default\n") {
+			t.Errorf("unexpected config file content:\n%s", data)
+		}
+	})
+
+	t.Run("nothing to add", func(t *testing.T) {
+		b := new(strings.Builder)
+		a, err := MergeProfiles(map[string]*AwsConfig{"role1": {RoleArn: "role1"}}, b, true)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(a) > 0 || b.Len() > 0 {
+			t.Error("unexpected changes to config file")
+		}
+	})
+}
+
+func ExampleProfileSection() {
+	c := &AwsConfig{RoleArn: "arn:aws:iam::123456789012:role/Admin", SourceProfile: "default", RoleDuration: 2 * time.Hour}
+	fmt.Print(ProfileSection("admin", c))
+	// Output:
+	// [profile admin]
+	// role_arn = arn:aws:iam::123456789012:role/Admin
+	// source_profile = default
+	// credentials_duration = 2h0m0s
+}
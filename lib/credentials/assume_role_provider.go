@@ -20,6 +20,9 @@ const (
 	AssumeRoleMaxDuration = 12 * time.Hour
 	// AssumeRoleDefaultDuration is a sensible default value for Assume Role credential duration
 	AssumeRoleDefaultDuration = 1 * time.Hour
+	// ChainedRoleMaxDuration is the maximum Assume Role credential duration allowed by the AWS API when the role is
+	// assumed using the credentials of another role (role chaining)
+	ChainedRoleMaxDuration = 1 * time.Hour
 )
 
 // AssumeRoleProvider is the type to provide settings to perform the Assume Role operation in the AWS API.
@@ -37,8 +40,11 @@ type AssumeRoleProvider struct {
 	SerialNumber    string
 	TokenCode       string
 	TokenProvider   func() (string, error)
-	ExpiryWindow    time.Duration
-	Cache           cache.CredentialCacher
+	// SerialNumberProvider is called to get the MFA device serial number if SerialNumber is not set, so the
+	// device is only looked up when credentials are fetched from AWS
+	SerialNumberProvider func() (string, error)
+	ExpiryWindow         time.Duration
+	Cache                cache.CredentialCacher
 }
 
 // NewAssumeRoleCredentials configures a default AssumeRoleProvider, and wraps it in an AWS credentials.Credentials object
@@ -71,58 +77,36 @@ func (p *AssumeRoleProvider) WithLogger(l aws.Logger) *AssumeRoleProvider {
 
 // Retrieve implements the AWS credentials.Provider interface to return a set of Assume Role credentials.
 // If the provider is configured to use a cache, it will be consulted to load the credentials.  If the credentials
-// are expired, the credentials will be refreshed, and stored back in the cache.
+// are expired, the credentials will be refreshed, and stored back in the cache.  Any MFA code is requested after
+// waiting for other processes refreshing the same credentials, so only one of them asks for a code.
 func (p *AssumeRoleProvider) Retrieve() (credentials.Value, error) {
-	var cc *cache.CacheableCredentials
-	var err error
+	var i *sts.AssumeRoleInput
 
-	if p.Cache != nil {
-		cc, err = p.Cache.Fetch()
-		if err != nil {
-			// Just mark as expired, and re-get the SessionToken creds from AWS
-			// May want to log/notify that a failure happened, for troubleshooting
-			p.Expiry.SetExpiration(time.Now(), SessionTokenMaxDuration)
-		} else {
-			p.debug("Found cached assume role credentials")
-			p.Expiry.SetExpiration(time.Unix(cc.Expiration, 0), p.ExpiryWindow)
-		}
+	prepare := func() (err error) {
+		i, err = p.assumeRoleInput()
+		return err
 	}
 
-	if p.IsExpired() {
-		p.debug("Detected expired or unset assume role credentials, refreshing")
-		c, err := p.assumeRole()
+	fetch := func() (*cache.CacheableCredentials, error) {
+		o, err := p.AssumeRole(i)
 		if err != nil {
-			return credentials.Value{}, err
-		}
-
-		cc = &cache.CacheableCredentials{
-			Value: credentials.Value{
-				AccessKeyID:     *c.AccessKeyId,
-				SecretAccessKey: *c.SecretAccessKey,
-				SessionToken:    *c.SessionToken,
-				ProviderName:    AssumeRoleProviderName,
-			},
-			Expiration: c.Expiration.Unix(),
-		}
-
-		if p.Cache != nil {
-			if err := p.Cache.Store(cc); err != nil {
-				p.debug("error caching credentials: %v", err)
-			}
+			return nil, err
 		}
+		return stsCredentials(o.Credentials, AssumeRoleProviderName)
 	}
 
-	if cc == nil {
-		// something's wacky, expire existing provider creds, and retry
-		p.SetExpiration(time.Unix(0, 0), 0)
-		return p.Retrieve()
+	cc, err := retrieveCredentials(&p.Expiry, p.ExpiryWindow, p.Cache, prepare, fetch, p.debug)
+	if err != nil {
+		return credentials.Value{}, err
 	}
 
 	p.debug("ASSUME ROLE CREDENTIALS: %+v", cc.Value)
 	return cc.Value, nil
 }
 
-func (p *AssumeRoleProvider) assumeRole() (*sts.Credentials, error) {
+// assumeRoleInput returns the AssumeRole API input for the provider, looking up the MFA device and prompting for
+// the MFA code, if required
+func (p *AssumeRoleProvider) assumeRoleInput() (*sts.AssumeRoleInput, error) {
 	i := new(sts.AssumeRoleInput).SetDurationSeconds(p.validateDuration(p.Duration)).SetRoleArn(p.RoleARN).
 		SetRoleSessionName(p.RoleSessionName)
 
@@ -130,6 +114,14 @@ func (p *AssumeRoleProvider) assumeRole() (*sts.Credentials, error) {
 		i.ExternalId = aws.String(p.ExternalID)
 	}
 
+	if len(p.SerialNumber) < 1 && p.SerialNumberProvider != nil {
+		sn, err := p.SerialNumberProvider()
+		if err != nil {
+			return nil, err
+		}
+		p.SerialNumber = sn
+	}
+
 	if len(p.SerialNumber) > 0 {
 		i.SerialNumber = aws.String(p.SerialNumber)
 
@@ -148,12 +140,7 @@ func (p *AssumeRoleProvider) assumeRole() (*sts.Credentials, error) {
 		}
 	}
 
-	o, err := p.AssumeRole(i)
-	if err != nil {
-		return nil, err
-	}
-	p.Expiry.SetExpiration(*o.Credentials.Expiration, p.ExpiryWindow)
-	return o.Credentials, nil
+	return i, nil
 }
 
 // AssumeRole implements the AssumeRoler interface, calling the AssumeRole method on the underlying client
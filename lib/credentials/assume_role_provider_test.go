@@ -200,6 +200,93 @@ func TestAssumeRoleProvider_Retrieve(t *testing.T) {
 			}
 		})
 
+		t.Run("locked refresh", func(t *testing.T) {
+			lc := new(mockLockingCredentialCache)
+			lc.CacheableCredentials = &cache.CacheableCredentials{Expiration: 1}
+
+			p := &AssumeRoleProvider{
+				client:       new(mockStsClient),
+				Duration:     AssumeRoleMinDuration,
+				ExpiryWindow: 1 * time.Minute,
+				Cache:        lc,
+			}
+
+			c, err := p.Retrieve()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if c.AccessKeyID != "locked" {
+				t.Error("did not use credentials refreshed while waiting for lock")
+			}
+
+			if lc.locked {
+				t.Error("cache was not unlocked")
+			}
+		})
+
+		t.Run("no mfa prompt after locked refresh", func(t *testing.T) {
+			lc := new(mockLockingCredentialCache)
+			lc.CacheableCredentials = &cache.CacheableCredentials{Expiration: 1}
+
+			p := &AssumeRoleProvider{
+				client:       new(mockStsClient),
+				Duration:     AssumeRoleMinDuration,
+				ExpiryWindow: 1 * time.Minute,
+				Cache:        lc,
+				SerialNumber: "mock-mfa",
+				TokenProvider: func() (string, error) {
+					t.Error("prompted for MFA code after another process refreshed the credentials")
+					return "123456", nil
+				},
+			}
+
+			c, err := p.Retrieve()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if c.AccessKeyID != "locked" {
+				t.Error("did not use credentials refreshed while waiting for lock")
+			}
+		})
+
+		t.Run("mfa prompt locked", func(t *testing.T) {
+			lc := &mockLockingCredentialCache{stale: true}
+			lc.CacheableCredentials = &cache.CacheableCredentials{Expiration: 1}
+
+			var prompted bool
+			p := &AssumeRoleProvider{
+				client:       new(mockStsClient),
+				Duration:     AssumeRoleMinDuration,
+				ExpiryWindow: 1 * time.Minute,
+				Cache:        lc,
+				SerialNumber: "mock-mfa",
+				TokenProvider: func() (string, error) {
+					prompted = true
+					if !lc.locked {
+						t.Error("cache not locked while prompting for MFA code")
+					}
+					return "123456", nil
+				},
+			}
+
+			if _, err := p.Retrieve(); err != nil {
+				t.Error(err)
+				return
+			}
+
+			if !prompted {
+				t.Error("MFA code was not requested")
+			}
+
+			if lc.locked {
+				t.Error("cache was not unlocked")
+			}
+		})
+
 		t.Run("valid", func(t *testing.T) {
 			cc.CacheableCredentials = &cache.CacheableCredentials{
 				Value: credentials.Value{
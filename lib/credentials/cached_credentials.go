@@ -0,0 +1,92 @@
+package credentials
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/mmmorris1975/aws-runas/lib/cache"
+	"time"
+)
+
+// retrieveCredentials is the Retrieve logic shared by the credential providers.  The unexpired credentials in the
+// cache c are returned if found, otherwise new credentials are fetched and stored in the cache.  If the cache is a
+// cache.Locker, it's locked and checked again before refreshing, so a process waits for another process refreshing the
+// same credentials (including any MFA prompt), and uses the credentials it stored instead of asking for another MFA
+// code.  The wait for the lock is bounded, so an abandoned prompt only delays the other processes.  The prepare
+// function (which may be nil) is called before fetching to gather any input requiring user interaction, like an MFA
+// code.  The expiration of e is set from the returned credentials, using window as the expiry window.
+func retrieveCredentials(e *credentials.Expiry, window time.Duration, c cache.CredentialCacher, prepare func() error,
+	fetch func() (*cache.CacheableCredentials, error), debug func(string, ...interface{})) (*cache.CacheableCredentials, error) {
+	if cc := cachedCredentials(e, window, c); cc != nil {
+		debug("Found cached credentials")
+		return cc, nil
+	}
+
+	debug("Detected expired or unset credentials, refreshing")
+	if l, ok := c.(cache.Locker); ok {
+		// wait for any other process refreshing these credentials, then check if they stored fresh credentials in the cache
+		if err := l.Lock(); err != nil {
+			debug("error locking credential cache: %v", err)
+		} else {
+			defer l.Unlock()
+			if cc := cachedCredentials(e, window, c); cc != nil {
+				debug("Found credentials refreshed by another process")
+				return cc, nil
+			}
+		}
+	}
+
+	if prepare != nil {
+		if err := prepare(); err != nil {
+			return nil, err
+		}
+	}
+
+	cc, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	e.SetExpiration(time.Unix(cc.Expiration, 0), window)
+
+	if c != nil {
+		if err := c.Store(cc); err != nil {
+			debug("error caching credentials: %v", err)
+		}
+	}
+	return cc, nil
+}
+
+// cachedCredentials returns the credentials in the cache c, if they are not expired
+func cachedCredentials(e *credentials.Expiry, window time.Duration, c cache.CredentialCacher) *cache.CacheableCredentials {
+	if c == nil {
+		return nil
+	}
+
+	cc, err := c.Fetch()
+	if err != nil || cc == nil {
+		return nil
+	}
+
+	e.SetExpiration(time.Unix(cc.Expiration, 0), window)
+	if e.IsExpired() {
+		return nil
+	}
+	return cc
+}
+
+// stsCredentials returns the credentials from an STS API call as CacheableCredentials from the named provider
+func stsCredentials(c *sts.Credentials, provider string) (*cache.CacheableCredentials, error) {
+	if c == nil {
+		return nil, fmt.Errorf("no credentials returned from %s", provider)
+	}
+
+	return &cache.CacheableCredentials{
+		Value: credentials.Value{
+			AccessKeyID:     *c.AccessKeyId,
+			SecretAccessKey: *c.SecretAccessKey,
+			SessionToken:    *c.SessionToken,
+			ProviderName:    provider,
+		},
+		Expiration: c.Expiration.Unix(),
+	}, nil
+}
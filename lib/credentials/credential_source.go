@@ -0,0 +1,43 @@
+package credentials
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"os"
+)
+
+const (
+	// EnvironmentCredentialSource is the credential_source value to use the credentials set in the AWS environment variables
+	EnvironmentCredentialSource = "Environment"
+	// Ec2MetadataCredentialSource is the credential_source value to use the EC2 instance profile credentials
+	Ec2MetadataCredentialSource = "Ec2InstanceMetadata"
+	// EcsContainerCredentialSource is the credential_source value to use the ECS container credentials
+	EcsContainerCredentialSource = "EcsContainer"
+
+	ecsRelativeURIEnvVar = "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"
+	ecsFullURIEnvVar     = "AWS_CONTAINER_CREDENTIALS_FULL_URI"
+)
+
+// NewCredentialSourceCredentials returns the credentials for the given credential_source profile setting, which will be
+// used in place of the credentials from a source_profile to assume a role.  The configuration of the provided session
+// is used to configure the credential provider.  An error is returned if the credential source is not valid.
+func NewCredentialSourceCredentials(s *session.Session, source string) (*credentials.Credentials, error) {
+	switch source {
+	case EnvironmentCredentialSource:
+		return credentials.NewEnvCredentials(), nil
+	case Ec2MetadataCredentialSource:
+		return ec2rolecreds.NewCredentialsWithClient(ec2metadata.New(s)), nil
+	case EcsContainerCredentialSource:
+		if len(os.Getenv(ecsRelativeURIEnvVar)) < 1 && len(os.Getenv(ecsFullURIEnvVar)) < 1 {
+			return nil, fmt.Errorf("credential_source %s requires the %s or %s environment variable",
+				source, ecsRelativeURIEnvVar, ecsFullURIEnvVar)
+		}
+		return credentials.NewCredentials(defaults.RemoteCredProvider(*s.Config, s.Handlers)), nil
+	}
+
+	return nil, fmt.Errorf("invalid credential_source: %s", source)
+}
@@ -0,0 +1,73 @@
+package credentials
+
+import (
+	"github.com/aws/aws-sdk-go/aws/session"
+	"os"
+	"testing"
+)
+
+func TestNewCredentialSourceCredentials(t *testing.T) {
+	s := session.Must(session.NewSession())
+
+	t.Run("environment", func(t *testing.T) {
+		os.Setenv("AWS_ACCESS_KEY_ID", "AKIAMOCK")
+		os.Setenv("AWS_SECRET_ACCESS_KEY", "MockSecret")
+		defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+		defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+		c, err := NewCredentialSourceCredentials(s, EnvironmentCredentialSource)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		v, err := c.Get()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if v.AccessKeyID != "AKIAMOCK" {
+			t.Error("bad access key")
+		}
+	})
+
+	t.Run("ec2", func(t *testing.T) {
+		c, err := NewCredentialSourceCredentials(s, Ec2MetadataCredentialSource)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c == nil {
+			t.Error("nil credentials")
+		}
+	})
+
+	t.Run("ecs", func(t *testing.T) {
+		os.Setenv(ecsRelativeURIEnvVar, "/v2/credentials/mock")
+		defer os.Unsetenv(ecsRelativeURIEnvVar)
+
+		c, err := NewCredentialSourceCredentials(s, EcsContainerCredentialSource)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c == nil {
+			t.Error("nil credentials")
+		}
+	})
+
+	t.Run("ecs no env", func(t *testing.T) {
+		if _, err := NewCredentialSourceCredentials(s, EcsContainerCredentialSource); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := NewCredentialSourceCredentials(s, "Bogus"); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package credentials
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// StdinTokenProviderType is the mfa_token_provider value to read the MFA code from stdin, this is the default
+	StdinTokenProviderType = "stdin"
+	// TtyTokenProviderType is the mfa_token_provider value to read the MFA code from the controlling terminal
+	TtyTokenProviderType = "tty"
+	// CommandTokenProviderType is the mfa_token_provider value to use the output of an external command as the MFA code
+	CommandTokenProviderType = "command"
+	// TotpTokenProviderType is the mfa_token_provider value to generate the MFA code from a stored TOTP secret
+	TotpTokenProviderType = "totp"
+	// AskpassTokenProviderType is the mfa_token_provider value to get the MFA code using an SSH_ASKPASS style helper
+	AskpassTokenProviderType = "askpass"
+	// AskpassEnvVar is the environment variable consulted for the askpass helper program, if no command is configured
+	AskpassEnvVar = "SSH_ASKPASS"
+
+	mfaPrompt = "Enter MFA Code: "
+)
+
+// TokenProviderOptions contains the additional settings needed by some of the MFA token providers
+type TokenProviderOptions struct {
+	// Command is the command line for the command token provider, or the program for the askpass token provider
+	Command string
+	// SecretFile is the path to the file containing the base32 encoded secret for the TOTP token provider
+	SecretFile string
+	// SecretCommand is the command line which prints the base32 encoded secret for the TOTP token provider, used if
+	// SecretFile is not set
+	SecretCommand string
+	// StateDir is the directory where the TOTP token provider records the time window of the last code it generated,
+	// so the code isn't reused by another process.  If not set, codes are only tracked within the current process.
+	StateDir string
+}
+
+// TokenProviderFactory returns an MFA token provider configured using the provided options
+type TokenProviderFactory func(opts *TokenProviderOptions) (func() (string, error), error)
+
+var (
+	tokenProviders = map[string]TokenProviderFactory{
+		StdinTokenProviderType:   func(*TokenProviderOptions) (func() (string, error), error) { return StdinTokenProvider, nil },
+		TtyTokenProviderType:     func(*TokenProviderOptions) (func() (string, error), error) { return TtyTokenProvider, nil },
+		CommandTokenProviderType: newCommandTokenProvider,
+		TotpTokenProviderType:    newTotpTokenProvider,
+		AskpassTokenProviderType: newAskpassTokenProvider,
+	}
+	tokenProviderLock sync.Mutex
+)
+
+// RegisterTokenProvider adds (or replaces) the MFA token provider factory for the given provider type, making it
+// available to NewTokenProvider
+func RegisterTokenProvider(providerType string, f TokenProviderFactory) {
+	tokenProviderLock.Lock()
+	defer tokenProviderLock.Unlock()
+	tokenProviders[strings.ToLower(providerType)] = f
+}
+
+// TokenProviderTypes returns the sorted list of registered MFA token provider types
+func TokenProviderTypes() []string {
+	tokenProviderLock.Lock()
+	defer tokenProviderLock.Unlock()
+
+	t := make([]string, 0, len(tokenProviders))
+	for k := range tokenProviders {
+		t = append(t, k)
+	}
+	sort.Strings(t)
+	return t
+}
+
+// NewTokenProvider returns the MFA token provider registered for the given provider type, which can be used as the
+// TokenProvider of the SessionTokenProvider and AssumeRoleProvider.  An empty providerType will return the
+// StdinTokenProvider.  An error is returned if the provider type is unknown, or the options are invalid for the type.
+func NewTokenProvider(providerType string, opts *TokenProviderOptions) (func() (string, error), error) {
+	if opts == nil {
+		opts = new(TokenProviderOptions)
+	}
+
+	if len(providerType) < 1 {
+		providerType = StdinTokenProviderType
+	}
+
+	tokenProviderLock.Lock()
+	f, ok := tokenProviders[strings.ToLower(providerType)]
+	tokenProviderLock.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("invalid mfa token provider: %s, valid values are %s", providerType,
+			strings.Join(TokenProviderTypes(), ", "))
+	}
+	return f(opts)
+}
+
+// the command is executed using the system shell, and the MFA code is the first line of its output
+func newCommandTokenProvider(opts *TokenProviderOptions) (func() (string, error), error) {
+	if len(strings.TrimSpace(opts.Command)) < 1 {
+		return nil, fmt.Errorf("command mfa token provider requires a command")
+	}
+
+	return func() (string, error) {
+		return runTokenCommand(shellCommand(opts.Command))
+	}, nil
+}
+
+func shellCommand(c string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd.exe", "/C", c)
+	}
+	return exec.Command("/bin/sh", "-c", c)
+}
+
+// like SSH_ASKPASS, the program is executed with the prompt as its only argument, and prints the response to stdout
+func newAskpassTokenProvider(opts *TokenProviderOptions) (func() (string, error), error) {
+	p := opts.Command
+	if len(p) < 1 {
+		p = os.Getenv(AskpassEnvVar)
+	}
+
+	if len(p) < 1 {
+		return nil, fmt.Errorf("askpass mfa token provider requires a command or the %s environment variable", AskpassEnvVar)
+	}
+
+	return func() (string, error) {
+		return runTokenCommand(exec.Command(p, mfaPrompt))
+	}, nil
+}
+
+func runTokenCommand(cmd *exec.Cmd) (string, error) {
+	out := new(bytes.Buffer)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("mfa token command failed: %v", err)
+	}
+
+	t := strings.TrimSpace(strings.SplitN(out.String(), "\n", 2)[0])
+	if len(t) < 1 {
+		return "", fmt.Errorf("mfa token command returned an empty code")
+	}
+	return t, nil
+}
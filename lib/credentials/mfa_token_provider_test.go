@@ -0,0 +1,175 @@
+package credentials
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestNewTokenProvider(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		p, err := NewTokenProvider("", nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if fmt.Sprintf("%p", p) != fmt.Sprintf("%p", StdinTokenProvider) {
+			t.Error("did not get stdin token provider")
+		}
+	})
+
+	t.Run("tty", func(t *testing.T) {
+		p, err := NewTokenProvider("TTY", nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if fmt.Sprintf("%p", p) != fmt.Sprintf("%p", TtyTokenProvider) {
+			t.Error("did not get tty token provider")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := NewTokenProvider("bogus", nil); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("command without command", func(t *testing.T) {
+		if _, err := NewTokenProvider(CommandTokenProviderType, nil); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("totp without secret file", func(t *testing.T) {
+		if _, err := NewTokenProvider(TotpTokenProviderType, nil); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("askpass without command", func(t *testing.T) {
+		os.Unsetenv(AskpassEnvVar)
+		if _, err := NewTokenProvider(AskpassTokenProviderType, nil); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("registered", func(t *testing.T) {
+		RegisterTokenProvider("Mock", func(*TokenProviderOptions) (func() (string, error), error) {
+			return func() (string, error) { return "654321", nil }, nil
+		})
+
+		p, err := NewTokenProvider("mock", nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c, _ := p(); c != "654321" {
+			t.Error("did not get registered token provider")
+		}
+	})
+}
+
+func TestCommandTokenProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses unix shell commands")
+	}
+
+	t.Run("good", func(t *testing.T) {
+		p, err := NewTokenProvider(CommandTokenProviderType, &TokenProviderOptions{Command: "printf '123456\\nextra\\n'"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		c, err := p()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c != "123456" {
+			t.Errorf("bad mfa code: %s", c)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		p, _ := NewTokenProvider(CommandTokenProviderType, &TokenProviderOptions{Command: "exit 1"})
+		if _, err := p(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("empty output", func(t *testing.T) {
+		p, _ := NewTokenProvider(CommandTokenProviderType, &TokenProviderOptions{Command: "true"})
+		if _, err := p(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
+
+func TestAskpassTokenProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses unix shell commands")
+	}
+
+	d, err := ioutil.TempDir("", "askpass")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(d)
+
+	// echo the prompt arg back, so we know it was passed to the helper
+	f := filepath.Join(d, "askpass")
+	if err := ioutil.WriteFile(f, []byte("#!/bin/sh\necho \"$1\"\n"), 0700); err != nil {
+		t.Error(err)
+		return
+	}
+
+	os.Setenv(AskpassEnvVar, f)
+	defer os.Unsetenv(AskpassEnvVar)
+
+	p, err := NewTokenProvider(AskpassTokenProviderType, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	c, err := p()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if c != "Enter MFA Code:" {
+		t.Errorf("unexpected askpass output: %s", c)
+	}
+}
+
+func TestTotpTokenProvider(t *testing.T) {
+	f := totpSecretFile(t, 0600)
+	defer os.Remove(f)
+
+	p, err := NewTokenProvider(TotpTokenProviderType, &TokenProviderOptions{SecretFile: f})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	c, err := p()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(c) != 6 {
+		t.Errorf("bad totp code: %s", c)
+	}
+}
@@ -0,0 +1,147 @@
+package credentials
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/mmmorris1975/aws-runas/lib/cache"
+	"github.com/mmmorris1975/aws-runas/lib/saml"
+	"time"
+)
+
+// SamlRoleProviderName is the name given to this AWS credential provider
+const SamlRoleProviderName = "SamlRoleProvider"
+
+// SamlRoler is the interface for the AWS API call to assume a role using a SAML assertion
+type SamlRoler interface {
+	AssumeRoleWithSAML(*sts.AssumeRoleWithSAMLInput) (*sts.AssumeRoleWithSAMLOutput, error)
+}
+
+// SamlRoleProvider is the type to provide settings to perform the Assume Role With SAML operation in the AWS API,
+// using the SAML assertion retrieved from an identity provider by the configured saml.Client.  The identity provider
+// is only contacted when the credentials need to be refreshed.  An optional Cache allows the ability to cache the
+// credentials in order to limit API calls.
+type SamlRoleProvider struct {
+	credentials.Expiry
+	client       SamlRoler
+	cfg          *aws.Config
+	log          aws.Logger
+	RoleARN      string
+	SamlClient   saml.Client
+	Duration     time.Duration
+	ExpiryWindow time.Duration
+	Cache        cache.CredentialCacher
+}
+
+// NewSamlRoleCredentials configures a default SamlRoleProvider, and wraps it in an AWS credentials.Credentials object
+// to allow Assume Role With SAML credential fetching.  The default SamlRoleProvider uses the specified
+// client.ConfigProvider to create a new sts.STS client, the provided roleArn as the role to assume, and samlClient
+// to get the SAML assertion.  The credential duration is set to AssumeRoleDefaultDuration, and the ExpiryWindow is set
+// to 10% of the duration value.  A list of options can be provided to add configuration to the SamlRoleProvider.
+func NewSamlRoleCredentials(c client.ConfigProvider, roleArn string, samlClient saml.Client, options ...func(*SamlRoleProvider)) *credentials.Credentials {
+	p := &SamlRoleProvider{
+		// the AssumeRoleWithSAML API call is not signed, the SAML assertion is the credential
+		client:       sts.New(c, new(aws.Config).WithCredentials(credentials.AnonymousCredentials)),
+		cfg:          c.ClientConfig("sts").Config,
+		RoleARN:      roleArn,
+		SamlClient:   samlClient,
+		Duration:     AssumeRoleDefaultDuration,
+		ExpiryWindow: AssumeRoleDefaultDuration / 10,
+	}
+
+	for _, o := range options {
+		o(p)
+	}
+
+	return credentials.NewCredentials(p)
+}
+
+// WithLogger configures a conforming Logger
+func (p *SamlRoleProvider) WithLogger(l aws.Logger) *SamlRoleProvider {
+	p.log = l
+	return p
+}
+
+// Retrieve implements the AWS credentials.Provider interface to return a set of Assume Role With SAML credentials.
+// If the provider is configured to use a cache, it will be consulted to load the credentials.  If the credentials
+// are expired, the credentials will be refreshed, and stored back in the cache.  The SAML assertion is retrieved
+// from the identity provider, which may prompt for a password or MFA code, after waiting for other processes
+// refreshing the same credentials.
+func (p *SamlRoleProvider) Retrieve() (credentials.Value, error) {
+	var i *sts.AssumeRoleWithSAMLInput
+
+	prepare := func() (err error) {
+		i, err = p.assumeRoleWithSamlInput()
+		return err
+	}
+
+	fetch := func() (*cache.CacheableCredentials, error) {
+		o, err := p.client.AssumeRoleWithSAML(i)
+		if err != nil {
+			return nil, err
+		}
+		return stsCredentials(o.Credentials, SamlRoleProviderName)
+	}
+
+	cc, err := retrieveCredentials(&p.Expiry, p.ExpiryWindow, p.Cache, prepare, fetch, p.debug)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	p.debug("SAML ROLE CREDENTIALS: %+v", cc.Value)
+	return cc.Value, nil
+}
+
+// assumeRoleWithSamlInput returns the AssumeRoleWithSAML API input, using a SAML assertion from the identity provider
+func (p *SamlRoleProvider) assumeRoleWithSamlInput() (*sts.AssumeRoleWithSAMLInput, error) {
+	if p.SamlClient == nil {
+		return nil, fmt.Errorf("no SAML client configured")
+	}
+
+	a, err := p.SamlClient.AwsSaml()
+	if err != nil {
+		return nil, err
+	}
+
+	// the principal is the SAML provider in AWS which is allowed to assume the role, as sent by the identity provider
+	pa, err := a.Principal(p.RoleARN)
+	if err != nil {
+		return nil, err
+	}
+
+	// the identity provider may limit the credential duration, asking for longer credentials fails the API call
+	d := p.Duration
+	if max, err := a.SessionDuration(); err != nil {
+		p.debug("Error reading SAML session duration: %v", err)
+	} else if max > 0 && d > max {
+		p.debug("SAML role duration limited to %s by the identity provider", max)
+		d = max
+	}
+
+	return new(sts.AssumeRoleWithSAMLInput).SetDurationSeconds(p.validateDuration(d)).SetRoleArn(p.RoleARN).
+		SetPrincipalArn(pa).SetSAMLAssertion(string(a)), nil
+}
+
+func (p *SamlRoleProvider) debug(f string, v ...interface{}) {
+	if p.cfg != nil && p.cfg.LogLevel.AtLeast(aws.LogDebug) && p.log != nil {
+		p.log.Log(fmt.Sprintf(f, v...))
+	}
+}
+
+func (p *SamlRoleProvider) validateDuration(d time.Duration) int64 {
+	s := int64(d.Seconds())
+
+	if d < AssumeRoleMinDuration {
+		p.debug("SAML role duration too short")
+		s = int64(AssumeRoleMinDuration.Seconds())
+	}
+
+	if d > AssumeRoleMaxDuration {
+		p.debug("SAML role duration too long")
+		s = int64(AssumeRoleMaxDuration.Seconds())
+	}
+
+	return s
+}
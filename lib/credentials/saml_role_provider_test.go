@@ -0,0 +1,159 @@
+package credentials
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/mmmorris1975/aws-runas/lib/saml"
+	"testing"
+	"time"
+)
+
+const samlRoleArn = "arn:aws:iam::123456789012:role/Admin"
+
+type mockSamlStsClient struct{}
+
+func (c *mockSamlStsClient) AssumeRoleWithSAML(in *sts.AssumeRoleWithSAMLInput) (*sts.AssumeRoleWithSAMLOutput, error) {
+	if *in.RoleArn != samlRoleArn || *in.PrincipalArn != "arn:aws:iam::123456789012:saml-provider/idp" {
+		return nil, fmt.Errorf("invalid role or principal")
+	}
+	return &sts.AssumeRoleWithSAMLOutput{Credentials: buildCreds(*in.DurationSeconds)}, nil
+}
+
+type mockSamlClient struct {
+	calls    int
+	err      error
+	duration time.Duration
+}
+
+func (c *mockSamlClient) AwsSaml() (saml.Assertion, error) {
+	c.calls++
+	if c.err != nil {
+		return "", c.err
+	}
+
+	attrs := fmt.Sprintf(`<Attribute Name="%s"><AttributeValue>%s,%s</AttributeValue></Attribute>`,
+		saml.RoleAttribute, samlRoleArn, "arn:aws:iam::123456789012:saml-provider/idp")
+	if c.duration > 0 {
+		attrs += fmt.Sprintf(`<Attribute Name="%s"><AttributeValue>%d</AttributeValue></Attribute>`,
+			saml.SessionDurationAttribute, int64(c.duration.Seconds()))
+	}
+
+	doc := fmt.Sprintf(`<Response>%s</Response>`, attrs)
+	return saml.Assertion(base64.StdEncoding.EncodeToString([]byte(doc))), nil
+}
+
+func TestNewSamlRoleCredentials(t *testing.T) {
+	t.Run("good", func(t *testing.T) {
+		s := session.Must(session.NewSession())
+		c := NewSamlRoleCredentials(s, samlRoleArn, new(mockSamlClient), func(p *SamlRoleProvider) {
+			p.Duration = AssumeRoleMaxDuration
+		})
+
+		if !c.IsExpired() {
+			t.Error("expected expired credentials")
+		}
+	})
+
+	t.Run("nil_config", func(t *testing.T) {
+		defer func() {
+			if x := recover(); x == nil {
+				t.Errorf("Did not receive expected panic calling NewSamlRoleCredentials with nil config")
+			}
+		}()
+		NewSamlRoleCredentials(nil, "", nil)
+	})
+}
+
+func TestSamlRoleProvider_Retrieve(t *testing.T) {
+	t.Run("good", func(t *testing.T) {
+		p := &SamlRoleProvider{client: new(mockSamlStsClient), RoleARN: samlRoleArn, SamlClient: new(mockSamlClient)}
+
+		c, err := p.Retrieve()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.ProviderName != SamlRoleProviderName {
+			t.Error("provider name mismatch")
+		}
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		sc := new(mockSamlClient)
+		p := &SamlRoleProvider{client: new(mockSamlStsClient), RoleARN: samlRoleArn, SamlClient: sc, Cache: new(mockCredentialCache)}
+
+		if _, err := p.Retrieve(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if _, err := p.Retrieve(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if sc.calls != 1 {
+			t.Errorf("identity provider called %d times", sc.calls)
+		}
+	})
+
+	t.Run("expire without cache", func(t *testing.T) {
+		sc := new(mockSamlClient)
+		c := credentials.NewCredentials(&SamlRoleProvider{client: new(mockSamlStsClient), RoleARN: samlRoleArn,
+			SamlClient: sc, ExpiryWindow: 1 * time.Minute})
+
+		if _, err := c.Get(); err != nil {
+			t.Error(err)
+			return
+		}
+		c.Expire()
+
+		if _, err := c.Get(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if sc.calls != 2 {
+			t.Errorf("identity provider called %d times", sc.calls)
+		}
+	})
+
+	t.Run("identity provider duration", func(t *testing.T) {
+		p := &SamlRoleProvider{client: new(mockSamlStsClient), RoleARN: samlRoleArn, Duration: AssumeRoleMaxDuration,
+			SamlClient: &mockSamlClient{duration: 2 * time.Hour}}
+
+		if _, err := p.Retrieve(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if exp := p.ExpiresAt(); exp.After(time.Now().Add(2 * time.Hour)) {
+			t.Errorf("credential duration not limited by identity provider: %s", exp)
+		}
+	})
+
+	t.Run("role not in assertion", func(t *testing.T) {
+		p := &SamlRoleProvider{client: new(mockSamlStsClient), RoleARN: "arn:aws:iam::123456789012:role/Other", SamlClient: new(mockSamlClient)}
+		if _, err := p.Retrieve(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("saml error", func(t *testing.T) {
+		p := &SamlRoleProvider{client: new(mockSamlStsClient), RoleARN: samlRoleArn, SamlClient: &mockSamlClient{err: fmt.Errorf("login failed")}}
+		if _, err := p.Retrieve(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("no saml client", func(t *testing.T) {
+		p := &SamlRoleProvider{client: new(mockSamlStsClient), RoleARN: samlRoleArn}
+		if _, err := p.Retrieve(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
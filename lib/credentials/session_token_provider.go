@@ -46,8 +46,11 @@ type SessionTokenProvider struct {
 	SerialNumber  string
 	TokenCode     string
 	TokenProvider func() (string, error)
-	ExpiryWindow  time.Duration
-	Cache         cache.CredentialCacher
+	// SerialNumberProvider is called to get the MFA device serial number if SerialNumber is not set, so the
+	// device is only looked up when credentials are fetched from AWS
+	SerialNumberProvider func() (string, error)
+	ExpiryWindow         time.Duration
+	Cache                cache.CredentialCacher
 }
 
 // NewSessionCredentials configures a default SessionTokenProvider, and wraps it in an AWS credentials.Credentials object
@@ -78,62 +81,45 @@ func (s *SessionTokenProvider) WithLogger(l aws.Logger) *SessionTokenProvider {
 
 // Retrieve implements the AWS credentials.Provider interface to return a set of Session Token credentials.
 // If the provider is configured to use a cache, it will be consulted to load the credentials.  If the credentials
-// are expired, the credentials will be refreshed, and stored back in the cache.
+// are expired, the credentials will be refreshed, and stored back in the cache.  Any MFA code is requested after
+// waiting for other processes refreshing the same credentials, so only one of them asks for a code.
 func (s *SessionTokenProvider) Retrieve() (credentials.Value, error) {
-	var cc *cache.CacheableCredentials
-	var err error
+	var i *sts.GetSessionTokenInput
 
-	if s.Cache != nil {
-		cc, err = s.Cache.Fetch()
-		if err != nil {
-			// Just mark as expired, and re-get the SessionToken creds from AWS
-			// May want to log/notify that a failure happened, for troubleshooting
-			s.Expiry.SetExpiration(time.Now(), SessionTokenMaxDuration)
-		} else {
-			s.debug("Found cached session token credentials")
-			s.Expiry.SetExpiration(time.Unix(cc.Expiration, 0), s.ExpiryWindow)
-		}
+	prepare := func() (err error) {
+		i, err = s.sessionTokenInput()
+		return err
 	}
 
-	// This isn't the same thing as cred.IsExpired(), which just forces a call to our Retrieve() function
-	// This IsExpired() is still based on the lifetime of the initial creds we retrieved, with a window to
-	// re-get the creds before they actually expire.
-	if s.IsExpired() {
-		s.debug("Detected expired or unset session token credentials, refreshing")
-		c, err := s.getSessionToken()
+	fetch := func() (*cache.CacheableCredentials, error) {
+		o, err := s.client.GetSessionToken(i)
 		if err != nil {
-			return credentials.Value{}, err
-		}
-
-		cc = &cache.CacheableCredentials{
-			Value: credentials.Value{
-				AccessKeyID:     *c.AccessKeyId,
-				SecretAccessKey: *c.SecretAccessKey,
-				SessionToken:    *c.SessionToken,
-				ProviderName:    SessionTokenProviderName,
-			},
-			Expiration: c.Expiration.Unix(),
-		}
-
-		if s.Cache != nil {
-			if err := s.Cache.Store(cc); err != nil {
-				s.debug("error caching credentials: %v", err)
-			}
+			return nil, err
 		}
+		return stsCredentials(o.Credentials, SessionTokenProviderName)
 	}
 
-	if cc == nil {
-		// something's wacky, expire existing provider creds, and retry
-		s.SetExpiration(time.Unix(0, 0), 0)
-		return s.Retrieve()
+	cc, err := retrieveCredentials(&s.Expiry, s.ExpiryWindow, s.Cache, prepare, fetch, s.debug)
+	if err != nil {
+		return credentials.Value{}, err
 	}
 
 	s.debug("SESSION TOKEN CREDENTIALS: %+v", cc.Value)
 	return cc.Value, nil
 }
 
-func (s *SessionTokenProvider) getSessionToken() (*sts.Credentials, error) {
+// sessionTokenInput returns the GetSessionToken API input for the provider, looking up the MFA device and prompting
+// for the MFA code, if required
+func (s *SessionTokenProvider) sessionTokenInput() (*sts.GetSessionTokenInput, error) {
 	i := new(sts.GetSessionTokenInput).SetDurationSeconds(s.validateSessionDuration(s.Duration))
+	if len(s.SerialNumber) < 1 && s.SerialNumberProvider != nil {
+		sn, err := s.SerialNumberProvider()
+		if err != nil {
+			return nil, err
+		}
+		s.SerialNumber = sn
+	}
+
 	if len(s.SerialNumber) > 0 {
 		i.SerialNumber = &s.SerialNumber
 
@@ -152,13 +138,7 @@ func (s *SessionTokenProvider) getSessionToken() (*sts.Credentials, error) {
 		}
 	}
 
-	o, err := s.client.GetSessionToken(i)
-	if err != nil {
-		return nil, err
-	}
-	s.Expiry.SetExpiration(*o.Credentials.Expiration, s.ExpiryWindow)
-
-	return o.Credentials, nil
+	return i, nil
 }
 
 func (s *SessionTokenProvider) debug(f string, v ...interface{}) {
@@ -78,6 +78,32 @@ func (c *mockCredentialCache) Store(creds *cache.CacheableCredentials) error {
 	return nil
 }
 
+// mockLockingCredentialCache simulates another process refreshing the credentials while this one waits for the lock,
+// unless stale is set
+type mockLockingCredentialCache struct {
+	mockCredentialCache
+	locked bool
+	stale  bool
+}
+
+func (c *mockLockingCredentialCache) Lock() error {
+	c.locked = true
+	if c.stale {
+		return nil
+	}
+
+	c.CacheableCredentials = &cache.CacheableCredentials{
+		Value:      credentials.Value{AccessKeyID: "locked"},
+		Expiration: time.Now().Add(1 * time.Hour).Unix(),
+	}
+	return nil
+}
+
+func (c *mockLockingCredentialCache) Unlock() error {
+	c.locked = false
+	return nil
+}
+
 func TestNewSessionCredentials(t *testing.T) {
 	t.Run("good", func(t *testing.T) {
 		s := session.Must(session.NewSession())
@@ -199,6 +225,38 @@ func TestSessionTokenProvider_Retrieve(t *testing.T) {
 		})
 	})
 
+	t.Run("serial number provider", func(t *testing.T) {
+		var tokenCalled bool
+		p := &SessionTokenProvider{
+			client:               new(mockStsClient),
+			SerialNumberProvider: func() (string, error) { return "MFAtime", nil },
+			TokenProvider: func() (string, error) {
+				tokenCalled = true
+				return "123456", nil
+			},
+		}
+
+		if _, err := p.Retrieve(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if p.SerialNumber != "MFAtime" || !tokenCalled {
+			t.Error("serial number provider not used")
+		}
+	})
+
+	t.Run("serial number provider error", func(t *testing.T) {
+		p := &SessionTokenProvider{
+			client:               new(mockStsClient),
+			SerialNumberProvider: func() (string, error) { return "", fmt.Errorf("an error") },
+		}
+
+		if _, err := p.Retrieve(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
 	t.Run("cache", func(t *testing.T) {
 		cc := new(mockCredentialCache)
 
@@ -266,6 +324,32 @@ func TestSessionTokenProvider_Retrieve(t *testing.T) {
 			}
 		})
 
+		t.Run("locked refresh", func(t *testing.T) {
+			lc := new(mockLockingCredentialCache)
+			lc.CacheableCredentials = &cache.CacheableCredentials{Expiration: 1}
+
+			p := &SessionTokenProvider{
+				client:       new(mockStsClient),
+				Duration:     SessionTokenMinDuration,
+				ExpiryWindow: 1 * time.Minute,
+				Cache:        lc,
+			}
+
+			c, err := p.Retrieve()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if c.AccessKeyID != "locked" {
+				t.Error("did not use credentials refreshed while waiting for lock")
+			}
+
+			if lc.locked {
+				t.Error("cache was not unlocked")
+			}
+		})
+
 		t.Run("valid", func(t *testing.T) {
 			cc.CacheableCredentials = &cache.CacheableCredentials{
 				Value: credentials.Value{
@@ -0,0 +1,112 @@
+package credentials
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/mmmorris1975/aws-runas/lib/cache"
+	"github.com/mmmorris1975/aws-runas/lib/sso"
+	"time"
+)
+
+// SsoRoleProviderName is the name given to this AWS credential provider
+const SsoRoleProviderName = "SsoRoleProvider"
+
+// SsoRoleClient is the interface for getting the AWS credentials of an AWS SSO account and role
+type SsoRoleClient interface {
+	RoleCredentials(accountId, roleName string) (*sso.RoleCredentials, error)
+}
+
+// ssoTokenClient is implemented by SSO clients which may need the user to log in before getting role credentials
+type ssoTokenClient interface {
+	Token() (*sso.Token, error)
+}
+
+// SsoRoleProvider is the type to provide settings to get the credentials for an AWS SSO account and role.  An
+// optional Cache allows the ability to cache the credentials in order to limit API calls.
+type SsoRoleProvider struct {
+	credentials.Expiry
+	cfg          *aws.Config
+	log          aws.Logger
+	Client       SsoRoleClient
+	AccountID    string
+	RoleName     string
+	ExpiryWindow time.Duration
+	Cache        cache.CredentialCacher
+}
+
+// NewSsoRoleCredentials configures a default SsoRoleProvider, and wraps it in an AWS credentials.Credentials object
+// to allow SSO role credential fetching.  The provided client.ConfigProvider is only used for logging configuration,
+// the credentials are retrieved using ssoClient.  The ExpiryWindow is set to 10% of AssumeRoleDefaultDuration.  A list
+// of options can be provided to add configuration to the SsoRoleProvider.
+func NewSsoRoleCredentials(c client.ConfigProvider, accountId, roleName string, ssoClient SsoRoleClient, options ...func(*SsoRoleProvider)) *credentials.Credentials {
+	p := &SsoRoleProvider{
+		cfg:          c.ClientConfig("sso").Config,
+		Client:       ssoClient,
+		AccountID:    accountId,
+		RoleName:     roleName,
+		ExpiryWindow: AssumeRoleDefaultDuration / 10,
+	}
+
+	for _, o := range options {
+		o(p)
+	}
+
+	return credentials.NewCredentials(p)
+}
+
+// WithLogger configures a conforming Logger
+func (p *SsoRoleProvider) WithLogger(l aws.Logger) *SsoRoleProvider {
+	p.log = l
+	return p
+}
+
+// Retrieve implements the AWS credentials.Provider interface to return a set of SSO role credentials.
+// If the provider is configured to use a cache, it will be consulted to load the credentials.  If the credentials
+// are expired, the credentials will be refreshed, and stored back in the cache.  If the SSO client requires the user
+// to log in, it's done after waiting for other processes refreshing the same credentials.
+func (p *SsoRoleProvider) Retrieve() (credentials.Value, error) {
+	prepare := func() error {
+		if p.Client == nil {
+			return fmt.Errorf("no SSO client configured")
+		}
+
+		if c, ok := p.Client.(ssoTokenClient); ok {
+			_, err := c.Token()
+			return err
+		}
+		return nil
+	}
+
+	fetch := func() (*cache.CacheableCredentials, error) {
+		c, err := p.Client.RoleCredentials(p.AccountID, p.RoleName)
+		if err != nil {
+			return nil, err
+		}
+
+		return &cache.CacheableCredentials{
+			Value: credentials.Value{
+				AccessKeyID:     c.AccessKeyID,
+				SecretAccessKey: c.SecretAccessKey,
+				SessionToken:    c.SessionToken,
+				ProviderName:    SsoRoleProviderName,
+			},
+			Expiration: c.Expiration.Unix(),
+		}, nil
+	}
+
+	cc, err := retrieveCredentials(&p.Expiry, p.ExpiryWindow, p.Cache, prepare, fetch, p.debug)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	p.debug("SSO ROLE CREDENTIALS: %+v", cc.Value)
+	return cc.Value, nil
+}
+
+func (p *SsoRoleProvider) debug(f string, v ...interface{}) {
+	if p.cfg != nil && p.cfg.LogLevel.AtLeast(aws.LogDebug) && p.log != nil {
+		p.log.Log(fmt.Sprintf(f, v...))
+	}
+}
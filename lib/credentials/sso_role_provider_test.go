@@ -0,0 +1,155 @@
+package credentials
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/mmmorris1975/aws-runas/lib/cache"
+	"github.com/mmmorris1975/aws-runas/lib/sso"
+	"testing"
+	"time"
+)
+
+type mockSsoClient struct {
+	calls int
+}
+
+func (c *mockSsoClient) RoleCredentials(accountId, roleName string) (*sso.RoleCredentials, error) {
+	c.calls++
+	if accountId != "123456789012" || roleName != "Admin" {
+		return nil, fmt.Errorf("no access")
+	}
+
+	return &sso.RoleCredentials{
+		AccessKeyID:     fmt.Sprintf("ASIAM0CK%d", time.Now().UnixNano()),
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(1 * time.Hour),
+	}, nil
+}
+
+type mockSsoTokenClient struct {
+	mockSsoClient
+	logins int
+}
+
+func (c *mockSsoTokenClient) Token() (*sso.Token, error) {
+	c.logins++
+	return new(sso.Token), nil
+}
+
+func TestNewSsoRoleCredentials(t *testing.T) {
+	s := session.Must(session.NewSession())
+	c := NewSsoRoleCredentials(s, "123456789012", "Admin", new(mockSsoClient), func(p *SsoRoleProvider) {
+		p.ExpiryWindow = 1 * time.Minute
+	})
+
+	if !c.IsExpired() {
+		t.Error("expected expired credentials")
+	}
+}
+
+func TestSsoRoleProvider_Retrieve(t *testing.T) {
+	t.Run("good", func(t *testing.T) {
+		p := &SsoRoleProvider{Client: new(mockSsoClient), AccountID: "123456789012", RoleName: "Admin"}
+
+		c, err := p.Retrieve()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.ProviderName != SsoRoleProviderName || p.IsExpired() {
+			t.Error("bad SSO role credentials")
+		}
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		sc := new(mockSsoClient)
+		p := &SsoRoleProvider{Client: sc, AccountID: "123456789012", RoleName: "Admin", Cache: new(mockCredentialCache)}
+
+		c1, err := p.Retrieve()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		c2, err := p.Retrieve()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if sc.calls != 1 || c1.AccessKeyID != c2.AccessKeyID {
+			t.Error("credentials were not cached")
+		}
+	})
+
+	t.Run("expire without cache", func(t *testing.T) {
+		sc := new(mockSsoClient)
+		p := &SsoRoleProvider{Client: sc, AccountID: "123456789012", RoleName: "Admin", ExpiryWindow: 1 * time.Minute}
+		c := credentials.NewCredentials(p)
+
+		if _, err := c.Get(); err != nil {
+			t.Error(err)
+			return
+		}
+		c.Expire()
+
+		v, err := c.Get()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if sc.calls != 2 || v.ProviderName != SsoRoleProviderName {
+			t.Error("credentials were not refreshed")
+		}
+	})
+
+	t.Run("no login after locked refresh", func(t *testing.T) {
+		lc := new(mockLockingCredentialCache)
+		lc.CacheableCredentials = &cache.CacheableCredentials{Expiration: 1}
+
+		sc := new(mockSsoTokenClient)
+		p := &SsoRoleProvider{Client: sc, AccountID: "123456789012", RoleName: "Admin", Cache: lc}
+
+		c, err := p.Retrieve()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if sc.logins > 0 || c.AccessKeyID != "locked" {
+			t.Error("did not use credentials refreshed while waiting for lock")
+		}
+	})
+
+	t.Run("login", func(t *testing.T) {
+		sc := new(mockSsoTokenClient)
+		p := &SsoRoleProvider{Client: sc, AccountID: "123456789012", RoleName: "Admin"}
+
+		if _, err := p.Retrieve(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if sc.logins != 1 {
+			t.Error("SSO login was not checked")
+		}
+	})
+
+	t.Run("bad role", func(t *testing.T) {
+		p := &SsoRoleProvider{Client: new(mockSsoClient), AccountID: "123456789012", RoleName: "Other"}
+		if _, err := p.Retrieve(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("no client", func(t *testing.T) {
+		p := &SsoRoleProvider{AccountID: "123456789012", RoleName: "Admin"}
+		if _, err := p.Retrieve(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
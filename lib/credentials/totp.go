@@ -0,0 +1,177 @@
+package credentials
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TotpPeriod is the lifetime of a TOTP code, as used by AWS virtual MFA devices
+	TotpPeriod = 30 * time.Second
+	totpDigits = 6
+)
+
+// totpGenerator generates the codes for a virtual MFA device.  AWS rejects an MFA code which has already been used,
+// so the generator never returns the code for the same time window twice, instead waiting for the next window.
+type totpGenerator struct {
+	SecretFile    string
+	SecretCommand string
+	StateDir      string
+	now           func() time.Time
+	sleep         func(time.Duration)
+	last          map[string]int64
+	mu            sync.Mutex
+}
+
+// the secret is read each time a code is needed, so the secret isn't held in memory between uses
+func newTotpTokenProvider(opts *TokenProviderOptions) (func() (string, error), error) {
+	if len(opts.SecretFile) < 1 && len(strings.TrimSpace(opts.SecretCommand)) < 1 {
+		return nil, fmt.Errorf("totp mfa token provider requires a secret file or secret command")
+	}
+
+	g := &totpGenerator{SecretFile: opts.SecretFile, SecretCommand: opts.SecretCommand, StateDir: opts.StateDir,
+		now: time.Now, sleep: time.Sleep, last: make(map[string]int64)}
+	return g.Code, nil
+}
+
+// Code returns the TOTP code for the current time window, or the next window if the current window's code was
+// already used
+func (g *totpGenerator) Code() (string, error) {
+	s, err := g.secret()
+	if err != nil {
+		return "", err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	k := fmt.Sprintf("%x", sha256.Sum256(s))[:16]
+	step := totpStep(g.now())
+	if last := g.lastStep(k); step <= last {
+		step = last + 1
+		g.sleep(time.Unix(step*int64(TotpPeriod.Seconds()), 0).Sub(g.now()))
+	}
+	g.saveStep(k, step)
+
+	return totpStepCode(s, step), nil
+}
+
+func (g *totpGenerator) secret() ([]byte, error) {
+	if len(g.SecretFile) > 0 {
+		if err := checkSecretFile(g.SecretFile); err != nil {
+			return nil, err
+		}
+
+		b, err := ioutil.ReadFile(g.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		return decodeTotpSecret(string(b))
+	}
+
+	out := new(bytes.Buffer)
+	cmd := shellCommand(g.SecretCommand)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("totp secret command failed: %v", err)
+	}
+	return decodeTotpSecret(out.String())
+}
+
+// the time window of the last code is kept in memory, and in a file in StateDir (if set) for other processes
+func (g *totpGenerator) lastStep(key string) int64 {
+	last := g.last[key]
+
+	if f := g.stateFile(key); len(f) > 0 {
+		if b, err := ioutil.ReadFile(f); err == nil {
+			if v, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64); err == nil && v > last {
+				last = v
+			}
+		}
+	}
+	return last
+}
+
+func (g *totpGenerator) saveStep(key string, step int64) {
+	g.last[key] = step
+
+	if f := g.stateFile(key); len(f) > 0 {
+		// best effort, the worst case is a rejected code if another process generates a code in the same window
+		ioutil.WriteFile(f, []byte(strconv.FormatInt(step, 10)), 0600)
+	}
+}
+
+// the state file name is derived from the secret, so each MFA device has its own state
+func (g *totpGenerator) stateFile(key string) string {
+	if len(g.StateDir) < 1 {
+		return ""
+	}
+	return filepath.Join(g.StateDir, fmt.Sprintf(".aws_runas_totp_%s", key))
+}
+
+// checkSecretFile returns an error if the TOTP secret file is readable by all users.  File permissions are not checked
+// on Windows, which does not use the unix permission bits.
+func checkSecretFile(f string) error {
+	fi, err := os.Stat(f)
+	if err != nil {
+		return err
+	}
+
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0004 != 0 {
+		return fmt.Errorf("totp secret file %s must not be world-readable", f)
+	}
+	return nil
+}
+
+// decodeTotpSecret decodes the base32 encoded secret of a virtual MFA device.  Whitespace, lower case characters,
+// and missing padding (as commonly found in the secrets shown by authenticator apps) are allowed.
+func decodeTotpSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.Join(strings.Fields(s), ""))
+	s = strings.TrimRight(s, "=")
+	if len(s) < 1 {
+		return nil, fmt.Errorf("empty totp secret")
+	}
+
+	b, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid totp secret: %v", err)
+	}
+	return b, nil
+}
+
+// totpCode returns the RFC 6238 TOTP code for the secret at time t
+func totpCode(secret []byte, t time.Time) string {
+	return totpStepCode(secret, totpStep(t))
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(TotpPeriod.Seconds())
+}
+
+func totpStepCode(secret []byte, step int64) string {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(step))
+
+	h := hmac.New(sha1.New, secret)
+	h.Write(b)
+	sum := h.Sum(nil)
+
+	o := sum[len(sum)-1] & 0xf
+	c := binary.BigEndian.Uint32(sum[o:o+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, c%1000000)
+}
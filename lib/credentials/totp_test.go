@@ -0,0 +1,156 @@
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTotpCode(t *testing.T) {
+	// RFC 6238 SHA1 test vectors, truncated to 6 digits
+	s, err := decodeTotpSecret("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tests := map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 20000000000: "353130"}
+	for k, v := range tests {
+		if c := totpCode(s, time.Unix(k, 0)); c != v {
+			t.Errorf("bad totp code for %d: %s", k, c)
+		}
+	}
+}
+
+func TestDecodeTotpSecret(t *testing.T) {
+	t.Run("unpadded lower case", func(t *testing.T) {
+		b, err := decodeTotpSecret("gezd gnbv gy3t qojq\n")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if string(b) != "1234567890" {
+			t.Error("bad secret")
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if _, err := decodeTotpSecret(" \n"); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := decodeTotpSecret("not-base32!"); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
+
+func TestTotpGenerator_Code(t *testing.T) {
+	f := totpSecretFile(t, 0600)
+	defer os.Remove(f)
+
+	t.Run("reused window", func(t *testing.T) {
+		var slept time.Duration
+		now := time.Unix(1111111109, 0)
+		g := &totpGenerator{SecretFile: f, now: func() time.Time { return now }, sleep: func(d time.Duration) { slept = d },
+			last: make(map[string]int64)}
+
+		c, err := g.Code()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c != "081804" || slept > 0 {
+			t.Errorf("bad first code: %s", c)
+			return
+		}
+
+		c, err = g.Code()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		// 1111111109 is 29s into its window, so the next window starts 1s later
+		if c == "081804" || slept != 1*time.Second {
+			t.Errorf("code reused, or bad wait time: %s %v", c, slept)
+		}
+	})
+
+	t.Run("state dir", func(t *testing.T) {
+		d, err := ioutil.TempDir("", "totp")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer os.RemoveAll(d)
+
+		var slept time.Duration
+		now := func() time.Time { return time.Unix(1111111109, 0) }
+		sleep := func(d time.Duration) { slept = d }
+
+		g1 := &totpGenerator{SecretFile: f, StateDir: d, now: now, sleep: sleep, last: make(map[string]int64)}
+		if _, err := g1.Code(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		// a new generator (another process) must see the window used by the first
+		g2 := &totpGenerator{SecretFile: f, StateDir: d, now: now, sleep: sleep, last: make(map[string]int64)}
+		if c, _ := g2.Code(); c == "081804" || slept < 1 {
+			t.Error("code reused by another generator")
+		}
+	})
+
+	t.Run("world readable", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("file permissions not checked on windows")
+		}
+
+		wf := totpSecretFile(t, 0644)
+		defer os.Remove(wf)
+
+		g := &totpGenerator{SecretFile: wf, now: time.Now, sleep: time.Sleep, last: make(map[string]int64)}
+		if _, err := g.Code(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("secret command", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("test uses unix shell commands")
+		}
+
+		g := &totpGenerator{SecretCommand: "echo GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", now: func() time.Time { return time.Unix(59, 0) },
+			sleep: time.Sleep, last: make(map[string]int64)}
+		c, err := g.Code()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c != "287082" {
+			t.Errorf("bad totp code: %s", c)
+		}
+	})
+}
+
+func totpSecretFile(t *testing.T, mode os.FileMode) string {
+	f, err := ioutil.TempFile("", "totp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.WriteString("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ\n")
+	if err := f.Chmod(mode); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
@@ -0,0 +1,38 @@
+package credentials
+
+import (
+	"fmt"
+	"github.com/mmmorris1975/aws-runas/internal/tty"
+	"io"
+)
+
+// TtyTokenProvider will print a prompt to the controlling terminal for a user to enter the MFA code, and read the code
+// from the terminal with echo disabled.  Unlike StdinTokenProvider, stdin and stdout are not used, so this provider is usable when stdout is
+// reserved for program output (like the credential_process JSON document), or stdin is not connected to a terminal.
+func TtyTokenProvider() (string, error) {
+	in, out, err := tty.Open()
+	if err != nil {
+		return "", fmt.Errorf("unable to open terminal for MFA prompt: %v", err)
+	}
+	defer in.Close()
+	defer out.Close()
+
+	restore, err := tty.DisableEcho(in)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	t, err := ttyTokenProvider(in, out)
+	fmt.Fprintln(out)
+	return t, err
+}
+
+func ttyTokenProvider(in io.Reader, out io.Writer) (string, error) {
+	var mfaCode string
+	if _, err := fmt.Fprint(out, mfaPrompt); err != nil {
+		return "", err
+	}
+	_, err := fmt.Fscanln(in, &mfaCode)
+	return mfaCode, err
+}
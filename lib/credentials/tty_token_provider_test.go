@@ -0,0 +1,31 @@
+package credentials
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTtyTokenProvider(t *testing.T) {
+	t.Run("good", func(t *testing.T) {
+		out := new(strings.Builder)
+		c, err := ttyTokenProvider(strings.NewReader("123456\n"), out)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c != "123456" {
+			t.Error("bad mfa code")
+		}
+
+		if out.String() != "Enter MFA Code: " {
+			t.Error("bad prompt")
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if _, err := ttyTokenProvider(strings.NewReader(""), new(strings.Builder)); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
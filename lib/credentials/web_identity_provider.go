@@ -0,0 +1,129 @@
+package credentials
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/mmmorris1975/aws-runas/lib/cache"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// WebIdentityProviderName is the name given to this AWS credential provider
+const WebIdentityProviderName = "WebIdentityRoleProvider"
+
+// WebIdentityRoler is the interface for the AWS API call to assume a role using a web identity (OIDC) token
+type WebIdentityRoler interface {
+	AssumeRoleWithWebIdentity(*sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error)
+}
+
+// WebIdentityRoleProvider is the type to provide settings to perform the Assume Role With Web Identity operation in
+// the AWS API, using a JWT token read from TokenFile.  This is similar to the AWS SDK WebIdentityRoleProvider, with
+// the addition of an optional Cache to allow the ability to cache the credentials in order to limit API calls.
+type WebIdentityRoleProvider struct {
+	credentials.Expiry
+	client          WebIdentityRoler
+	cfg             *aws.Config
+	log             aws.Logger
+	RoleARN         string
+	RoleSessionName string
+	TokenFile       string
+	Duration        time.Duration
+	ExpiryWindow    time.Duration
+	Cache           cache.CredentialCacher
+}
+
+// NewWebIdentityRoleCredentials configures a default WebIdentityRoleProvider, and wraps it in an AWS credentials.Credentials
+// object to allow Assume Role With Web Identity credential fetching.  The default WebIdentityRoleProvider uses the
+// specified client.ConfigProvider to create a new sts.STS client, the provided roleArn as the role to assume, and
+// tokenFile as the path to the file containing the web identity token.  The credential duration is set to
+// AssumeRoleDefaultDuration, and the ExpiryWindow is set to 10% of the duration value.  A list of options can be provided
+// to add configuration to the WebIdentityRoleProvider, such as overriding the Duration, ExpiryWindow and RoleSessionName.
+func NewWebIdentityRoleCredentials(c client.ConfigProvider, roleArn string, tokenFile string, options ...func(*WebIdentityRoleProvider)) *credentials.Credentials {
+	p := &WebIdentityRoleProvider{
+		// the AssumeRoleWithWebIdentity API call is not signed, the token is the credential
+		client:       sts.New(c, new(aws.Config).WithCredentials(credentials.AnonymousCredentials)),
+		cfg:          c.ClientConfig("sts").Config,
+		RoleARN:      roleArn,
+		TokenFile:    tokenFile,
+		Duration:     AssumeRoleDefaultDuration,
+		ExpiryWindow: AssumeRoleDefaultDuration / 10,
+	}
+
+	for _, o := range options {
+		o(p)
+	}
+
+	return credentials.NewCredentials(p)
+}
+
+// WithLogger configures a conforming Logger
+func (p *WebIdentityRoleProvider) WithLogger(l aws.Logger) *WebIdentityRoleProvider {
+	p.log = l
+	return p
+}
+
+// Retrieve implements the AWS credentials.Provider interface to return a set of Assume Role With Web Identity credentials.
+// If the provider is configured to use a cache, it will be consulted to load the credentials.  If the credentials
+// are expired, the credentials will be refreshed using the current contents of the token file, and stored back in the cache.
+func (p *WebIdentityRoleProvider) Retrieve() (credentials.Value, error) {
+	cc, err := retrieveCredentials(&p.Expiry, p.ExpiryWindow, p.Cache, nil, p.assumeRoleWithWebIdentity, p.debug)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	p.debug("WEB IDENTITY CREDENTIALS: %+v", cc.Value)
+	return cc.Value, nil
+}
+
+func (p *WebIdentityRoleProvider) assumeRoleWithWebIdentity() (*cache.CacheableCredentials, error) {
+	// token files are regularly rotated by the token issuer, so always read the current value
+	b, err := ioutil.ReadFile(p.TokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read web identity token file: %v", err)
+	}
+
+	t := strings.TrimSpace(string(b))
+	if len(t) < 1 {
+		return nil, fmt.Errorf("web identity token file %s is empty", p.TokenFile)
+	}
+
+	n := p.RoleSessionName
+	if len(n) < 1 {
+		n = fmt.Sprintf("aws-runas-%d", time.Now().UnixNano())
+	}
+
+	i := new(sts.AssumeRoleWithWebIdentityInput).SetDurationSeconds(p.validateDuration(p.Duration)).
+		SetRoleArn(p.RoleARN).SetRoleSessionName(n).SetWebIdentityToken(t)
+
+	o, err := p.client.AssumeRoleWithWebIdentity(i)
+	if err != nil {
+		return nil, err
+	}
+	return stsCredentials(o.Credentials, WebIdentityProviderName)
+}
+
+func (p *WebIdentityRoleProvider) debug(f string, v ...interface{}) {
+	if p.cfg != nil && p.cfg.LogLevel.AtLeast(aws.LogDebug) && p.log != nil {
+		p.log.Log(fmt.Sprintf(f, v...))
+	}
+}
+
+func (p *WebIdentityRoleProvider) validateDuration(d time.Duration) int64 {
+	s := int64(d.Seconds())
+
+	if d < AssumeRoleMinDuration {
+		p.debug("Web identity role duration too short")
+		s = int64(AssumeRoleMinDuration.Seconds())
+	}
+
+	if d > AssumeRoleMaxDuration {
+		p.debug("Web identity role duration too long")
+		s = int64(AssumeRoleMaxDuration.Seconds())
+	}
+
+	return s
+}
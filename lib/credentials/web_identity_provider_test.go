@@ -0,0 +1,148 @@
+package credentials
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+type mockWebIdentityClient struct{}
+
+func (c *mockWebIdentityClient) AssumeRoleWithWebIdentity(in *sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	if *in.WebIdentityToken != "my.jwt.token" {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	if in.RoleSessionName == nil || len(*in.RoleSessionName) < 1 {
+		return nil, fmt.Errorf("missing role session name")
+	}
+	return &sts.AssumeRoleWithWebIdentityOutput{Credentials: buildCreds(*in.DurationSeconds)}, nil
+}
+
+func writeTokenFile(t *testing.T, token string) string {
+	f, err := ioutil.TempFile("", "web-identity-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(token); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestNewWebIdentityRoleCredentials(t *testing.T) {
+	t.Run("good", func(t *testing.T) {
+		s := session.Must(session.NewSession())
+		c := NewWebIdentityRoleCredentials(s, "myRole", "token-file", func(p *WebIdentityRoleProvider) {
+			p.Duration = AssumeRoleMaxDuration
+		})
+
+		if !c.IsExpired() {
+			t.Error("expected expired credentials")
+		}
+	})
+
+	t.Run("nil_config", func(t *testing.T) {
+		defer func() {
+			if x := recover(); x == nil {
+				t.Errorf("Did not receive expected panic calling NewWebIdentityRoleCredentials with nil config")
+			}
+		}()
+		NewWebIdentityRoleCredentials(nil, "", "")
+	})
+}
+
+func TestWebIdentityRoleProvider_Retrieve(t *testing.T) {
+	f := writeTokenFile(t, "my.jwt.token\n")
+	defer os.Remove(f)
+
+	t.Run("good", func(t *testing.T) {
+		p := &WebIdentityRoleProvider{client: new(mockWebIdentityClient), TokenFile: f, Duration: 1 * time.Minute}
+
+		c, err := p.Retrieve()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.ProviderName != WebIdentityProviderName {
+			t.Error("provider name mismatch")
+		}
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		cc := new(mockCredentialCache)
+		p := &WebIdentityRoleProvider{client: new(mockWebIdentityClient), TokenFile: f, Cache: cc, RoleSessionName: "ci"}
+
+		c1, err := p.Retrieve()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		c2, err := p.Retrieve()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c1.AccessKeyID != c2.AccessKeyID {
+			t.Error("credentials were not cached")
+		}
+	})
+
+	t.Run("expire without cache", func(t *testing.T) {
+		p := &WebIdentityRoleProvider{client: new(mockWebIdentityClient), TokenFile: f, ExpiryWindow: 1 * time.Minute}
+		c := credentials.NewCredentials(p)
+
+		if _, err := c.Get(); err != nil {
+			t.Error(err)
+			return
+		}
+		c.Expire()
+
+		v, err := c.Get()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if v.ProviderName != WebIdentityProviderName {
+			t.Error("provider name mismatch")
+		}
+	})
+
+	t.Run("bad token", func(t *testing.T) {
+		bf := writeTokenFile(t, "bad.jwt.token")
+		defer os.Remove(bf)
+
+		p := &WebIdentityRoleProvider{client: new(mockWebIdentityClient), TokenFile: bf}
+		if _, err := p.Retrieve(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("empty token", func(t *testing.T) {
+		ef := writeTokenFile(t, "")
+		defer os.Remove(ef)
+
+		p := &WebIdentityRoleProvider{client: new(mockWebIdentityClient), TokenFile: ef}
+		if _, err := p.Retrieve(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("missing token file", func(t *testing.T) {
+		p := &WebIdentityRoleProvider{client: new(mockWebIdentityClient), TokenFile: "not-a-file"}
+		if _, err := p.Retrieve(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package metadata
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// EC2MetadataPath is the base path of the instance metadata in the metadata service
+	EC2MetadataPath = "/latest/meta-data/"
+	// EC2DynamicDataPath is the base path of the instance dynamic data (like the instance identity document)
+	EC2DynamicDataPath = "/latest/dynamic/"
+
+	defaultRegion = "us-east-1"
+)
+
+// InstanceMetadata is the emulated EC2 instance data returned by the metadata service.  Empty values are replaced with
+// generated values when the service starts.  The region comes from the active profile.
+type InstanceMetadata struct {
+	InstanceID   string
+	InstanceType string
+	ImageID      string
+	Hostname     string
+	LocalIPv4    string
+}
+
+// instanceIdentityDocument is the document returned by the /latest/dynamic/instance-identity/document endpoint
+type instanceIdentityDocument struct {
+	AccountID        string `json:"accountId"`
+	Architecture     string `json:"architecture"`
+	AvailabilityZone string `json:"availabilityZone"`
+	ImageID          string `json:"imageId"`
+	InstanceID       string `json:"instanceId"`
+	InstanceType     string `json:"instanceType"`
+	PendingTime      string `json:"pendingTime"`
+	PrivateIP        string `json:"privateIp"`
+	Region           string `json:"region"`
+	Version          string `json:"version"`
+}
+
+// iamInfo is the document returned by the /latest/meta-data/iam/info endpoint
+type iamInfo struct {
+	Code               string
+	LastUpdated        string
+	InstanceProfileArn string
+	InstanceProfileId  string
+}
+
+var (
+	instance          *InstanceMetadata
+	instanceProfileID = "AIPA" + strings.ToUpper(randomHex(17))
+	startTime         = time.Now()
+
+	// the entries of the metadata "directories", a trailing / means the entry is another directory
+	metadataListings = map[string][]string{
+		EC2MetadataPath: {"ami-id", "hostname", "iam/", "instance-id", "instance-type", "local-hostname", "local-ipv4",
+			"placement/"},
+		EC2MetadataPath + "iam/":                  {"info", "security-credentials/"},
+		EC2MetadataPath + "placement/":            {"availability-zone", "region"},
+		EC2DynamicDataPath:                        {"instance-identity/"},
+		EC2DynamicDataPath + "instance-identity/": {"document"},
+	}
+)
+
+// newInstanceMetadata returns a copy of m, with generated values in place of any empty values
+func newInstanceMetadata(m *InstanceMetadata) *InstanceMetadata {
+	i := new(InstanceMetadata)
+	if m != nil {
+		*i = *m
+	}
+
+	if len(i.InstanceID) < 1 {
+		i.InstanceID = "i-" + randomHex(17)
+	}
+
+	if len(i.InstanceType) < 1 {
+		i.InstanceType = "t3.micro"
+	}
+
+	if len(i.ImageID) < 1 {
+		i.ImageID = "ami-" + randomHex(17)
+	}
+
+	if len(i.Hostname) < 1 {
+		h, err := os.Hostname()
+		if err != nil {
+			h = "localhost"
+		}
+		i.Hostname = h
+	}
+
+	if len(i.LocalIPv4) < 1 {
+		i.LocalIPv4 = "127.0.0.1"
+	}
+
+	return i
+}
+
+// instanceMetadataHandler serves the emulated instance metadata, and the listings of the metadata paths
+func instanceMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeResponse(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if l, ok := metadataListings[r.URL.Path]; ok {
+		writeResponse(w, r, strings.Join(l, "\n"), http.StatusOK)
+		return
+	}
+
+	var body string
+	switch r.URL.Path {
+	case EC2MetadataPath + "ami-id":
+		body = instance.ImageID
+	case EC2MetadataPath + "hostname", EC2MetadataPath + "local-hostname":
+		body = instance.Hostname
+	case EC2MetadataPath + "instance-id":
+		body = instance.InstanceID
+	case EC2MetadataPath + "instance-type":
+		body = instance.InstanceType
+	case EC2MetadataPath + "local-ipv4":
+		body = instance.LocalIPv4
+	case EC2MetadataPath + "placement/region":
+		body = instanceRegion()
+	case EC2MetadataPath + "placement/availability-zone":
+		body = instanceRegion() + "a"
+	case EC2MetadataPath + "iam/info":
+		if role != nil {
+			w.Header().Set("Content-Type", "application/json")
+			body = jsonString(&iamInfo{
+				Code:               "Success",
+				LastUpdated:        time.Now().UTC().Format(time.RFC3339),
+				InstanceProfileArn: fmt.Sprintf("arn:aws:iam::%s:instance-profile/%s", instanceAccount(), profile),
+				InstanceProfileId:  instanceProfileID,
+			})
+		}
+	case EC2DynamicDataPath + "instance-identity/document":
+		w.Header().Set("Content-Type", "application/json")
+		body = jsonString(&instanceIdentityDocument{
+			AccountID:        instanceAccount(),
+			Architecture:     instanceArchitecture(),
+			AvailabilityZone: instanceRegion() + "a",
+			ImageID:          instance.ImageID,
+			InstanceID:       instance.InstanceID,
+			InstanceType:     instance.InstanceType,
+			PendingTime:      startTime.UTC().Format(time.RFC3339),
+			PrivateIP:        instance.LocalIPv4,
+			Region:           instanceRegion(),
+			Version:          "2017-09-30",
+		})
+	}
+
+	if len(body) < 1 {
+		writeResponse(w, r, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	writeResponse(w, r, body, http.StatusOK)
+}
+
+// the region of the active profile
+func instanceRegion() string {
+	if role != nil && len(role.Region) > 0 {
+		return role.Region
+	}
+	return defaultRegion
+}
+
+// the account of the active profile's role, or the account of the user if it's unknown
+func instanceAccount() string {
+	if role != nil {
+		if a, err := arn.Parse(role.RoleArn); err == nil {
+			return a.AccountID
+		}
+
+		if len(role.SsoAccountID) > 0 {
+			return role.SsoAccountID
+		}
+	}
+
+	if usr != nil && usr.Identity != nil && usr.Identity.Account != nil {
+		return *usr.Identity.Account
+	}
+	return ""
+}
+
+func instanceArchitecture() string {
+	if runtime.GOARCH == "arm64" {
+		return "arm64"
+	}
+	return "x86_64"
+}
+
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("error building metadata document: %v", err)
+		return ""
+	}
+	return string(b)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, (n+1)/2)
+	if _, err := rand.Read(b); err != nil {
+		return strings.Repeat("0", n)
+	}
+	return hex.EncodeToString(b)[:n]
+}
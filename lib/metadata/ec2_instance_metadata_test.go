@@ -0,0 +1,103 @@
+package metadata
+
+import (
+	"encoding/json"
+	"github.com/mmmorris1975/aws-runas/lib/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewInstanceMetadata(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		i := newInstanceMetadata(nil)
+		if !strings.HasPrefix(i.InstanceID, "i-") || len(i.InstanceID) != 19 {
+			t.Errorf("bad instance id: %s", i.InstanceID)
+		}
+
+		if !strings.HasPrefix(i.ImageID, "ami-") || len(i.InstanceType) < 1 || len(i.Hostname) < 1 || len(i.LocalIPv4) < 1 {
+			t.Errorf("missing default values: %+v", i)
+		}
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		i := newInstanceMetadata(&InstanceMetadata{InstanceID: "i-0123456789abcdef0"})
+		if i.InstanceID != "i-0123456789abcdef0" {
+			t.Error("configured instance id not used")
+		}
+	})
+}
+
+func TestInstanceMetadataHandler(t *testing.T) {
+	instance = newInstanceMetadata(&InstanceMetadata{InstanceID: "i-0123456789abcdef0"})
+	origRole := role
+	role = &config.AwsConfig{Region: "eu-west-1", RoleArn: "arn:aws:iam::123456789012:role/Admin"}
+	defer func() { role = origRole }()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		instanceMetadataHandler(w, r)
+		return w
+	}
+
+	t.Run("listing", func(t *testing.T) {
+		w := get(EC2MetadataPath)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "instance-id\n") {
+			t.Errorf("bad listing: %s", w.Body.String())
+		}
+	})
+
+	t.Run("instance id", func(t *testing.T) {
+		if w := get(EC2MetadataPath + "instance-id"); w.Body.String() != "i-0123456789abcdef0" {
+			t.Error("bad instance id")
+		}
+	})
+
+	t.Run("region", func(t *testing.T) {
+		if w := get(EC2MetadataPath + "placement/region"); w.Body.String() != "eu-west-1" {
+			t.Error("bad region")
+		}
+	})
+
+	t.Run("availability zone", func(t *testing.T) {
+		if w := get(EC2MetadataPath + "placement/availability-zone"); w.Body.String() != "eu-west-1a" {
+			t.Error("bad availability zone")
+		}
+	})
+
+	t.Run("iam info", func(t *testing.T) {
+		w := get(EC2MetadataPath + "iam/info")
+		if !strings.Contains(w.Body.String(), ":123456789012:instance-profile/") {
+			t.Errorf("bad iam info: %s", w.Body.String())
+		}
+	})
+
+	t.Run("identity document", func(t *testing.T) {
+		w := get(EC2DynamicDataPath + "instance-identity/document")
+
+		d := new(instanceIdentityDocument)
+		if err := json.Unmarshal(w.Body.Bytes(), d); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if d.AccountID != "123456789012" || d.Region != "eu-west-1" || d.InstanceID != "i-0123456789abcdef0" {
+			t.Errorf("bad identity document: %+v", d)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if w := get(EC2MetadataPath + "not-a-path"); w.Code != http.StatusNotFound {
+			t.Errorf("bad response code: %d", w.Code)
+		}
+	})
+
+	t.Run("default region", func(t *testing.T) {
+		role = nil
+		if w := get(EC2MetadataPath + "placement/region"); w.Body.String() != defaultRegion {
+			t.Error("bad region")
+		}
+	})
+}
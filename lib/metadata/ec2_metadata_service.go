@@ -11,6 +11,7 @@ import (
 	"github.com/mmmorris1975/aws-runas/lib/cache"
 	"github.com/mmmorris1975/aws-runas/lib/config"
 	credlib "github.com/mmmorris1975/aws-runas/lib/credentials"
+	"github.com/mmmorris1975/aws-runas/lib/sso"
 	"github.com/mmmorris1975/simple-logger"
 	"github.com/syndtr/gocapability/capability"
 	"html/template"
@@ -55,6 +56,7 @@ var (
 	usr      *credlib.AwsIdentity
 	log      *simple_logger.Logger
 	cacheDir string
+	ecsToken string
 
 	sigCh = make(chan os.Signal, 3)
 	srv   = new(http.Server)
@@ -102,6 +104,13 @@ type EC2MetadataInput struct {
 	SessionCacheDir string
 	// User is the AwsIdentity of the callers AWS credentials.
 	User *credlib.AwsIdentity
+	// ECSReady is called with the credentials endpoint URL and authorization token of the ECS credential service, once
+	// the service is listening, so they can be provided to the programs using the service
+	ECSReady func(url, token string)
+	// Instance is the emulated EC2 instance data, generated values are used for any unset fields
+	Instance *InstanceMetadata
+	// TokenRequired rejects EC2 metadata requests without an IMDSv2 session token, if false IMDSv1 requests are allowed
+	TokenRequired bool
 }
 
 // NewEC2MetadataService starts an HTTP server which will listen on the EC2 metadata service path for handling
@@ -143,14 +152,57 @@ func NewEC2MetadataService(opts *EC2MetadataInput) error {
 		log.Fatalf("Error dropping privileges, will not continue: %v", err)
 	}
 
+	registerHandlers()
+	http.HandleFunc(EC2MetadataTokenPath, tokenHandler)
+	http.HandleFunc(EC2MetadataCredentialPath, requireToken(credHandler))
+	http.HandleFunc(EC2MetadataPath, requireToken(instanceMetadataHandler))
+	http.HandleFunc(EC2DynamicDataPath, requireToken(instanceMetadataHandler))
+
+	return serve(l, fmt.Sprintf("EC2 Metadata Service ready on http://%s", hp))
+}
+
+// NewECSMetadataService starts an HTTP server on a random localhost port, which provides the role credentials using the
+// ECS container credentials format, at the ECSCredentialPath endpoint.  Unlike the EC2 metadata service, no special
+// privileges are needed, since the SDKs find the endpoint using the AWS_CONTAINER_CREDENTIALS_FULL_URI environment
+// variable.  Requests for credentials must send the random authorization token in the AWS_CONTAINER_AUTHORIZATION_TOKEN
+// environment variable.  The endpoint URL and token are passed to opts.ECSReady, once the service is listening.
+func NewECSMetadataService(opts *EC2MetadataInput) error {
+	if err := handleOptions(opts); err != nil {
+		return err
+	}
+
+	t, err := newAuthToken()
+	if err != nil {
+		return err
+	}
+	ecsToken = t
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+
+	registerHandlers()
+	http.HandleFunc(ECSCredentialPath, ecsCredHandler)
+
+	u := fmt.Sprintf("http://%s", l.Addr().String())
+	if opts.ECSReady != nil {
+		opts.ECSReady(u+ECSCredentialPath, t)
+	}
+
+	return serve(l, fmt.Sprintf("ECS Credential Service ready on %s", u))
+}
+
+// the web interface, and the endpoints used by it to manage the active profile
+func registerHandlers() {
 	http.HandleFunc("/", homeHandler)
 	http.HandleFunc(MfaPath, mfaHandler)
 	http.HandleFunc(ProfilePath, profileHandler)
-	http.HandleFunc(EC2MetadataCredentialPath, credHandler)
 	http.HandleFunc(ListRolesPath, listRoleHandler)
 	http.HandleFunc(RefreshPath, refreshHandler)
+}
 
-	msg := fmt.Sprintf("EC2 Metadata Service ready on http://%s", hp)
+func serve(l net.Listener, msg string) error {
 	if len(profile) < 1 {
 		msg = msg + " without an initial profile, set one via the web interface"
 	} else {
@@ -191,6 +243,8 @@ func handleOptions(opts *EC2MetadataInput) error {
 	usr = opts.User
 	role = opts.Config
 	profile = opts.InitialProfile
+	tokenRequired = opts.TokenRequired
+	instance = newInstanceMetadata(opts.Instance)
 
 	cacheDir = opts.SessionCacheDir
 	if len(cacheDir) < 1 {
@@ -273,6 +327,10 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 	d["profile_ep"] = ProfilePath
 	d["mfa_ep"] = MfaPath
 	d["refresh_ep"] = RefreshPath
+	d["service"] = "EC2 Metadata Service"
+	if len(ecsToken) > 0 {
+		d["service"] = "ECS Credential Service"
+	}
 
 	b := new(strings.Builder)
 	if err := homeTemplate.Execute(b, d); err != nil {
@@ -301,15 +359,23 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		role = p
-		cred = credlib.NewSessionCredentials(s, func(pv *credlib.SessionTokenProvider) {
-			pv.Duration = role.SessionDuration
-			pv.SerialNumber = role.MfaSerial
-
-			cf := cacheFile(role.SourceProfile)
-			if len(cf) > 0 {
-				pv.Cache = &cache.FileCredentialCache{Path: cf}
+		if len(role.SsoStartUrl) > 0 {
+			c, err := ssoCredentials(role)
+			if err != nil {
+				log.Error(err)
+				writeResponse(w, r, "Error configuring AWS SSO", http.StatusInternalServerError)
+				return
 			}
-		})
+			cred = c
+		} else {
+			cred = credlib.NewSessionCredentials(s, func(pv *credlib.SessionTokenProvider) {
+				pv.Duration = role.SessionDuration
+				pv.SerialNumber = role.MfaSerial
+				pv.TokenProvider = mfaTokenProvider(role)
+
+				pv.Cache = credentialCache(role.SourceProfile)
+			})
+		}
 
 		_, err := cred.Get()
 		if err != nil {
@@ -336,6 +402,42 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ssoCredentials returns the AWS SSO role credentials for profile configuration c.  The SSO token is shared with
+// the aws-runas command and the AWS CLI, so a device login is only needed if the cached token has expired.
+func ssoCredentials(c *config.AwsConfig) (*credentials.Credentials, error) {
+	r := c.SsoRegion
+	if len(r) < 1 {
+		r = c.Region
+	}
+
+	sc, err := sso.NewClient(c.SsoStartUrl, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return credlib.NewSsoRoleCredentials(s, c.SsoAccountID, c.SsoRoleName, sc.WithLogger(log)), nil
+}
+
+// mfaTokenProvider returns the MFA token provider configured for the MFA device of profile configuration c (or the
+// profile, if there's no device configuration), so the MFA code doesn't need to be entered in the browser.  The stdin
+// and tty token providers aren't usable by the metadata service, so a nil value is returned if one of those is
+// configured (or none is configured).
+func mfaTokenProvider(c *config.AwsConfig) func() (string, error) {
+	c = c.MfaDeviceConfig(c.MfaSerial)
+	switch strings.ToLower(c.MfaTokenProvider) {
+	case "", credlib.StdinTokenProviderType, credlib.TtyTokenProviderType:
+		return nil
+	}
+
+	p, err := credlib.NewTokenProvider(c.MfaTokenProvider, &credlib.TokenProviderOptions{Command: c.MfaTokenCommand,
+		SecretFile: c.MfaTotpSecretFile, SecretCommand: c.MfaTotpSecretCommand, StateDir: cacheDir})
+	if err != nil {
+		log.Errorf("error configuring MFA token provider: %v", err)
+		return nil
+	}
+	return p
+}
+
 func getProfileConfig(r io.Reader) (*config.AwsConfig, *handlerError) {
 	if r == nil {
 		return nil, newHandlerError("nil reader", http.StatusInternalServerError)
@@ -375,10 +477,7 @@ func mfaHandler(w http.ResponseWriter, r *http.Request) {
 		pv.SerialNumber = role.MfaSerial
 		pv.TokenCode = mfa
 
-		cf := cacheFile(role.SourceProfile)
-		if len(cf) > 0 {
-			pv.Cache = &cache.FileCredentialCache{Path: cf}
-		}
+		pv.Cache = credentialCache(role.SourceProfile)
 	})
 
 	if _, err := cred.Get(); err != nil {
@@ -457,18 +556,83 @@ func credHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func assumeRole() ([]byte, error) {
+	v, err := roleCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return credentialOutput(v)
+}
+
+// roleCredentials returns the credentials of the active role
+func roleCredentials() (credentials.Value, error) {
 	log.Debugf("ROLE ARN: %s", role.RoleArn)
-	ar := credlib.NewAssumeRoleCredentials(s.Copy(new(aws.Config).WithCredentials(cred)), role.RoleArn, func(p *credlib.AssumeRoleProvider) {
+	if len(role.RoleArn) < 1 && len(role.SsoStartUrl) > 0 {
+		// the SSO role credentials are the profile's role credentials
+		return cred.Get()
+	}
+
+	rs := s.Copy(new(aws.Config).WithCredentials(cred))
+
+	// assume any intermediate roles needed to get the credentials to assume the profile's role
+	for _, r := range role.RoleChain {
+		log.Debugf("ROLE CHAIN: %s", r.RoleArn)
+		c := credlib.NewAssumeRoleCredentials(rs, r.RoleArn, func(p *credlib.AssumeRoleProvider) {
+			p.Duration = credlib.ChainedRoleMaxDuration
+			p.ExternalID = r.ExternalID
+			p.RoleSessionName = roleSessionName()
+		})
+		rs = rs.Copy(new(aws.Config).WithCredentials(c))
+	}
+
+	ar := credlib.NewAssumeRoleCredentials(rs, role.RoleArn, func(p *credlib.AssumeRoleProvider) {
 		p.Duration = credlib.AssumeRoleDefaultDuration
 		p.ExternalID = role.ExternalID
-		p.RoleSessionName = usr.UserName
+		p.RoleSessionName = roleSessionName()
 	})
 
-	v, err := ar.Get()
+	return ar.Get()
+}
+
+// the identity of the source profile may be unknown for SSO profiles, which don't use the source profile credentials
+func roleSessionName() string {
+	if usr != nil {
+		return usr.UserName
+	}
+	return fmt.Sprintf("aws-runas-%d", time.Now().UnixNano())
+}
+
+// ecsCredHandler returns the role credentials in the ECS container credentials format, if the request has the
+// authorization token of the ECS credential service
+func ecsCredHandler(w http.ResponseWriter, r *http.Request) {
+	if code := checkAuthToken(r, ecsToken); code != http.StatusOK {
+		writeResponse(w, r, http.StatusText(code), code)
+		return
+	}
+
+	if role == nil {
+		writeResponse(w, r, "No profile set, set one via the web interface", http.StatusNotFound)
+		return
+	}
+
+	v, err := roleCredentials()
 	if err != nil {
-		return nil, err
+		log.Errorf("AssumeRole: %v", err)
+		writeResponse(w, r, "Error getting role credentials", http.StatusInternalServerError)
+		return
+	}
+
+	// the same fixed expiration used for the EC2 metadata credentials
+	b, err := ecsOutput(v, time.Now().Add(credlib.AssumeRoleMinDuration).Add(1*time.Second))
+	if err != nil {
+		writeResponse(w, r, "Error building credentials", http.StatusInternalServerError)
+		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	writeResponse(w, r, string(b), http.StatusOK)
+}
+
+func credentialOutput(v credentials.Value) ([]byte, error) {
 	// 1 second more than the minimum Assume Role credential duration is the absolute minimum Expiration time so that
 	// the default awscli logic won't think our credentials are expired, and send a duplicate request.
 	output := ec2MetadataOutput{
@@ -516,7 +680,17 @@ func refreshHandler(w http.ResponseWriter, r *http.Request) {
 		if role != nil {
 			cf := cacheFile(role.SourceProfile)
 			if len(cf) > 0 {
-				if err := os.Remove(cf); err != nil {
+				var err error
+				switch role.CacheType {
+				case cache.MemoryCacheType, cache.ExternalCacheType:
+					if c := credentialCache(role.SourceProfile); c != nil {
+						err = c.Store(new(cache.CacheableCredentials))
+					}
+				default:
+					err = os.Remove(cf)
+				}
+
+				if err != nil {
 					log.Debugf("Error removing cached credentials: %v", err)
 				}
 			}
@@ -525,6 +699,22 @@ func refreshHandler(w http.ResponseWriter, r *http.Request) {
 	writeResponse(w, r, "success", http.StatusOK)
 }
 
+// credentialCache returns the CredentialCacher configured for the active role to cache the session token credentials
+// of source profile p.  A nil value is returned if no cache file can be determined, or the cache is not configured properly
+func credentialCache(p string) cache.CredentialCacher {
+	cf := cacheFile(p)
+	if len(cf) < 1 {
+		return nil
+	}
+
+	c, err := cache.NewCredentialCacher(role.CacheType, cf, &cache.Options{KeyFile: role.CacheKeyFile, Command: role.CacheCommand})
+	if err != nil {
+		log.Errorf("error configuring credential cache: %v", err)
+		return nil
+	}
+	return c
+}
+
 func cacheFile(p string) string {
 	if len(cacheDir) > 0 && len(p) > 0 {
 		return filepath.Join(cacheDir, fmt.Sprintf(".aws_session_token_%s", p))
@@ -661,7 +851,7 @@ option {
 <body>
 <div id="content">
   <div id = "title">
-  <h2>EC2 Metadata Service Role Selector</h2>
+  <h2>{{.service}} Role Selector</h2>
   </div>
 
   <div id="form">
@@ -2,6 +2,7 @@ package metadata
 
 import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/mmmorris1975/aws-runas/lib/config"
 	"github.com/mmmorris1975/simple-logger"
 	"io/ioutil"
@@ -310,6 +311,54 @@ func TestCredHandler(t *testing.T) {
 	}
 }
 
+func TestEcsCredHandler(t *testing.T) {
+	ecsToken = "mock-token"
+	origRole, origCred := role, cred
+	defer func() { ecsToken = ""; role = origRole; cred = origCred }()
+
+	t.Run("no token", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, ECSCredentialPath, nil)
+		w := httptest.NewRecorder()
+		ecsCredHandler(w, r)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("bad response code: %d", w.Code)
+		}
+	})
+
+	t.Run("no profile", func(t *testing.T) {
+		role = nil
+		r := httptest.NewRequest(http.MethodGet, ECSCredentialPath, nil)
+		r.Header.Set("Authorization", ecsToken)
+		w := httptest.NewRecorder()
+		ecsCredHandler(w, r)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("bad response code: %d", w.Code)
+		}
+	})
+
+	t.Run("good", func(t *testing.T) {
+		// SSO role credentials don't call out to AWS to assume a role
+		role = &config.AwsConfig{SsoStartUrl: "https://example.awsapps.com/start"}
+		cred = credentials.NewCredentials(new(mockProvider))
+
+		r := httptest.NewRequest(http.MethodGet, ECSCredentialPath, nil)
+		r.Header.Set("Authorization", ecsToken)
+		w := httptest.NewRecorder()
+		ecsCredHandler(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("bad response code: %d", w.Code)
+			return
+		}
+
+		if !strings.Contains(w.Body.String(), `"Expiration"`) || w.Header().Get("Content-Type") != "application/json" {
+			t.Error("bad response")
+		}
+	})
+}
+
 func TestRefreshHandler(t *testing.T) {
 	cred = credentials.NewCredentials(new(mockProvider))
 
@@ -406,6 +455,52 @@ func TestCacheFile(t *testing.T) {
 	})
 }
 
+func TestSsoCredentials(t *testing.T) {
+	s = session.Must(session.NewSession())
+	defer func() { s = nil }()
+
+	t.Run("good", func(t *testing.T) {
+		c, err := ssoCredentials(&config.AwsConfig{SsoStartUrl: "https://example.awsapps.com/start", Region: "us-east-1",
+			SsoAccountID: "123456789012", SsoRoleName: "Admin"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c == nil {
+			t.Error("nil SSO credentials")
+			return
+		}
+	})
+
+	t.Run("no region", func(t *testing.T) {
+		if _, err := ssoCredentials(&config.AwsConfig{SsoStartUrl: "https://example.awsapps.com/start"}); err == nil {
+			t.Error("did not receive expected error")
+			return
+		}
+	})
+}
+
+func TestMfaTokenProvider(t *testing.T) {
+	t.Run("interactive", func(t *testing.T) {
+		if p := mfaTokenProvider(&config.AwsConfig{MfaTokenProvider: "tty"}); p != nil {
+			t.Error("received token provider for tty type")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if p := mfaTokenProvider(&config.AwsConfig{MfaTokenProvider: "totp"}); p != nil {
+			t.Error("received token provider for invalid configuration")
+		}
+	})
+
+	t.Run("command", func(t *testing.T) {
+		if p := mfaTokenProvider(&config.AwsConfig{MfaTokenProvider: "command", MfaTokenCommand: "echo 123456"}); p == nil {
+			t.Error("nil token provider")
+		}
+	})
+}
+
 func TestHandleOptions(t *testing.T) {
 	err := handleOptions(new(EC2MetadataInput))
 	if err != nil {
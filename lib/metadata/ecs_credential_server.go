@@ -0,0 +1,188 @@
+package metadata
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	credlib "github.com/mmmorris1975/aws-runas/lib/credentials"
+	"github.com/mmmorris1975/simple-logger"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// ECSCredentialsUriEnvVar is the environment variable the AWS SDKs use to find the container credentials endpoint
+	ECSCredentialsUriEnvVar = "AWS_CONTAINER_CREDENTIALS_FULL_URI"
+	// ECSAuthTokenEnvVar is the environment variable with the value the AWS SDKs send in the Authorization header
+	// of container credentials requests
+	ECSAuthTokenEnvVar = "AWS_CONTAINER_AUTHORIZATION_TOKEN"
+	// ECSCredentialPath is the path of the credentials endpoint
+	ECSCredentialPath = "/credentials"
+)
+
+// ecsCredentialOutput is the JSON document returned by the ECS container credentials endpoint
+type ecsCredentialOutput struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      string
+}
+
+// ECSCredentialServer is an HTTP server on a random localhost port, which provides credentials to the AWS SDKs using
+// the ECS container credentials format.  Requests must have the Token value in the Authorization header, so other
+// users on the system can't get the credentials.  The credentials are refreshed by their provider as needed, so a
+// long-running program can keep getting valid credentials.
+type ECSCredentialServer struct {
+	// Credentials are the credentials returned by the endpoint
+	Credentials *credentials.Credentials
+	// Token is the authorization token required in requests to the endpoint
+	Token    string
+	listener net.Listener
+	srv      *http.Server
+	log      *simple_logger.Logger
+}
+
+// NewECSCredentialServer creates an ECSCredentialServer for credentials c, listening on a random localhost port with a
+// random authorization token.  A list of options can be provided to override the default server configuration.
+func NewECSCredentialServer(c *credentials.Credentials, options ...func(*ECSCredentialServer)) (*ECSCredentialServer, error) {
+	t, err := newAuthToken()
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ECSCredentialServer{Credentials: c, Token: t, listener: l}
+	s.srv = &http.Server{Handler: s}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s, nil
+}
+
+// WithLogger configures the provided logger in the server
+func (s *ECSCredentialServer) WithLogger(l *simple_logger.Logger) *ECSCredentialServer {
+	s.log = l
+	return s
+}
+
+// URL returns the value for the AWS_CONTAINER_CREDENTIALS_FULL_URI environment variable
+func (s *ECSCredentialServer) URL() string {
+	return fmt.Sprintf("http://%s%s", s.listener.Addr().String(), ECSCredentialPath)
+}
+
+// Serve handles requests until Close() is called
+func (s *ECSCredentialServer) Serve() error {
+	if err := s.srv.Serve(s.listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Close stops the server
+func (s *ECSCredentialServer) Close() error {
+	return s.srv.Close()
+}
+
+// ServeHTTP is the implementation of the http.Handler interface for the credentials endpoint
+func (s *ECSCredentialServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != ECSCredentialPath {
+		s.writeResponse(w, r, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		s.writeResponse(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if code := checkAuthToken(r, s.Token); code != http.StatusOK {
+		s.writeResponse(w, r, http.StatusText(code), code)
+		return
+	}
+
+	b, err := ecsCredentials(s.Credentials)
+	if err != nil {
+		s.debug("error getting credentials: %v", err)
+		s.writeResponse(w, r, "Error getting credentials", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	s.writeResponse(w, r, string(b), http.StatusOK)
+}
+
+func (s *ECSCredentialServer) writeResponse(w http.ResponseWriter, r *http.Request, body string, code int) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if len(w.Header().Get("Content-Type")) < 1 {
+		w.Header().Set("Content-Type", "text/plain")
+	}
+	w.WriteHeader(code)
+
+	if _, err := w.Write([]byte(body)); err != nil {
+		s.debug("error writing response: %v", err)
+	}
+	s.debug("%s %s %s %d", r.Method, r.URL.Path, r.Proto, code)
+}
+
+func (s *ECSCredentialServer) debug(f string, v ...interface{}) {
+	if s.log != nil {
+		s.log.Debugf(f, v...)
+	}
+}
+
+// checkAuthToken returns the HTTP status code for the Authorization header of request r, which must match token
+func checkAuthToken(r *http.Request, token string) int {
+	a := r.Header.Get("Authorization")
+	if len(a) < 1 {
+		return http.StatusUnauthorized
+	}
+
+	if subtle.ConstantTimeCompare([]byte(a), []byte(token)) != 1 {
+		return http.StatusForbidden
+	}
+	return http.StatusOK
+}
+
+// ecsCredentials returns the ECS container credentials JSON document for credentials c, which are refreshed if expired
+func ecsCredentials(c *credentials.Credentials) ([]byte, error) {
+	v, err := c.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	exp, err := c.ExpiresAt()
+	if err != nil {
+		// credentials without an expiration time, have the SDK check back after the minimum role credential lifetime
+		exp = time.Now().Add(credlib.AssumeRoleMinDuration)
+	}
+
+	return ecsOutput(v, exp)
+}
+
+func ecsOutput(v credentials.Value, exp time.Time) ([]byte, error) {
+	return json.Marshal(&ecsCredentialOutput{
+		AccessKeyId:     v.AccessKeyID,
+		SecretAccessKey: v.SecretAccessKey,
+		Token:           v.SessionToken,
+		Expiration:      exp.UTC().Format(time.RFC3339),
+	})
+}
+
+func newAuthToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,115 @@
+package metadata
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestECSCredentialServer(t *testing.T) {
+	s, err := NewECSCredentialServer(credentials.NewStaticCredentials("AKIAMOCK", "MockSecret", "MockToken"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer s.Close()
+
+	t.Run("url", func(t *testing.T) {
+		if !strings.HasPrefix(s.URL(), "http://127.0.0.1:") || !strings.HasSuffix(s.URL(), ECSCredentialPath) {
+			t.Errorf("bad url: %s", s.URL())
+		}
+	})
+
+	t.Run("token", func(t *testing.T) {
+		if len(s.Token) != 64 {
+			t.Error("bad token")
+		}
+	})
+
+	t.Run("good", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, ECSCredentialPath, nil)
+		r.Header.Set("Authorization", s.Token)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("unexpected status: %d", w.Code)
+			return
+		}
+
+		o := new(ecsCredentialOutput)
+		if err := json.Unmarshal(w.Body.Bytes(), o); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if o.AccessKeyId != "AKIAMOCK" || o.SecretAccessKey != "MockSecret" || o.Token != "MockToken" {
+			t.Errorf("unexpected credentials: %+v", o)
+		}
+
+		if e, err := time.Parse(time.RFC3339, o.Expiration); err != nil || e.Before(time.Now()) {
+			t.Error("bad expiration")
+		}
+	})
+
+	t.Run("serve", func(t *testing.T) {
+		go s.Serve()
+
+		r, err := http.NewRequest(http.MethodGet, s.URL(), nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		r.Header.Set("Authorization", s.Token)
+
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("unexpected status: %d", res.StatusCode)
+		}
+	})
+
+	t.Run("no auth", func(t *testing.T) {
+		if c := ecsRequest(s, http.MethodGet, ECSCredentialPath, ""); c != http.StatusUnauthorized {
+			t.Errorf("unexpected status: %d", c)
+		}
+	})
+
+	t.Run("bad auth", func(t *testing.T) {
+		if c := ecsRequest(s, http.MethodGet, ECSCredentialPath, "bad"); c != http.StatusForbidden {
+			t.Errorf("unexpected status: %d", c)
+		}
+	})
+
+	t.Run("bad method", func(t *testing.T) {
+		if c := ecsRequest(s, http.MethodPost, ECSCredentialPath, s.Token); c != http.StatusMethodNotAllowed {
+			t.Errorf("unexpected status: %d", c)
+		}
+	})
+
+	t.Run("bad path", func(t *testing.T) {
+		if c := ecsRequest(s, http.MethodGet, "/", s.Token); c != http.StatusNotFound {
+			t.Errorf("unexpected status: %d", c)
+		}
+	})
+}
+
+func ecsRequest(s http.Handler, method, path, auth string) int {
+	r := httptest.NewRequest(method, path, nil)
+	if len(auth) > 0 {
+		r.Header.Set("Authorization", auth)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w.Code
+}
@@ -0,0 +1,96 @@
+package metadata
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// EC2MetadataTokenPath is the endpoint for getting IMDSv2 session tokens
+	EC2MetadataTokenPath = "/latest/api/token"
+	// EC2MetadataTokenHeader is the request header with the IMDSv2 session token
+	EC2MetadataTokenHeader = "X-aws-ec2-metadata-token"
+	// EC2MetadataTokenTtlHeader is the header with the lifetime of the IMDSv2 session token, in seconds
+	EC2MetadataTokenTtlHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	// EC2MetadataTokenMaxTtl is the maximum lifetime of an IMDSv2 session token allowed by AWS
+	EC2MetadataTokenMaxTtl = 6 * time.Hour
+)
+
+var (
+	// imdsTokens holds the issued IMDSv2 session tokens, and their expiration time
+	imdsTokens = &tokenStore{tokens: make(map[string]time.Time)}
+	// tokenRequired rejects requests without an IMDSv2 session token
+	tokenRequired bool
+)
+
+type tokenStore struct {
+	tokens map[string]time.Time
+	mu     sync.Mutex
+}
+
+// add a token which expires after ttl, and remove any expired tokens
+func (s *tokenStore) add(token string, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, v := range s.tokens {
+		if time.Now().After(v) {
+			delete(s.tokens, k)
+		}
+	}
+	s.tokens[token] = time.Now().Add(ttl)
+}
+
+func (s *tokenStore) valid(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.tokens[token]
+	return ok && time.Now().Before(exp)
+}
+
+// tokenHandler issues IMDSv2 session tokens, with the same responses as the EC2 metadata service: only PUT requests
+// are allowed, the TTL header is required, and requests which went through a proxy are rejected
+func tokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeResponse(w, r, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if len(r.Header.Get("X-Forwarded-For")) > 0 {
+		writeResponse(w, r, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	ttl, err := strconv.Atoi(r.Header.Get(EC2MetadataTokenTtlHeader))
+	if err != nil || ttl < 1 || ttl > int(EC2MetadataTokenMaxTtl.Seconds()) {
+		writeResponse(w, r, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	t, err := newAuthToken()
+	if err != nil {
+		log.Errorf("error creating metadata token: %v", err)
+		writeResponse(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	imdsTokens.add(t, time.Duration(ttl)*time.Second)
+
+	w.Header().Set(EC2MetadataTokenTtlHeader, strconv.Itoa(ttl))
+	writeResponse(w, r, t, http.StatusOK)
+}
+
+// requireToken wraps handler h with the check for a valid IMDSv2 session token.  Requests with an invalid or expired
+// token are rejected.  Requests without a token (IMDSv1) are rejected if tokenRequired is true.
+func requireToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := r.Header.Get(EC2MetadataTokenHeader)
+		if (len(t) > 0 && !imdsTokens.valid(t)) || (len(t) < 1 && tokenRequired) {
+			writeResponse(w, r, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,127 @@
+package metadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenHandler(t *testing.T) {
+	t.Run("good", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPut, EC2MetadataTokenPath, nil)
+		r.Header.Set(EC2MetadataTokenTtlHeader, "60")
+		w := httptest.NewRecorder()
+		tokenHandler(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("bad response code: %d", w.Code)
+			return
+		}
+
+		if w.Header().Get(EC2MetadataTokenTtlHeader) != "60" {
+			t.Error("bad ttl header")
+		}
+
+		if !imdsTokens.valid(w.Body.String()) {
+			t.Error("token not valid")
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, EC2MetadataTokenPath, nil)
+		r.Header.Set(EC2MetadataTokenTtlHeader, "60")
+		w := httptest.NewRecorder()
+		tokenHandler(w, r)
+
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("bad response code: %d", w.Code)
+		}
+	})
+
+	t.Run("missing ttl", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPut, EC2MetadataTokenPath, nil)
+		w := httptest.NewRecorder()
+		tokenHandler(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("bad response code: %d", w.Code)
+		}
+	})
+
+	t.Run("ttl too long", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPut, EC2MetadataTokenPath, nil)
+		r.Header.Set(EC2MetadataTokenTtlHeader, "21601")
+		w := httptest.NewRecorder()
+		tokenHandler(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("bad response code: %d", w.Code)
+		}
+	})
+
+	t.Run("forwarded", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPut, EC2MetadataTokenPath, nil)
+		r.Header.Set(EC2MetadataTokenTtlHeader, "60")
+		r.Header.Set("X-Forwarded-For", "10.0.0.1")
+		w := httptest.NewRecorder()
+		tokenHandler(w, r)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("bad response code: %d", w.Code)
+		}
+	})
+}
+
+func TestRequireToken(t *testing.T) {
+	imdsTokens.add("good-token", 1*time.Minute)
+	imdsTokens.add("expired-token", -1*time.Minute)
+	h := requireToken(func(w http.ResponseWriter, r *http.Request) { writeResponse(w, r, "ok", http.StatusOK) })
+
+	request := func(token string) int {
+		r := httptest.NewRequest(http.MethodGet, EC2MetadataCredentialPath, nil)
+		if len(token) > 0 {
+			r.Header.Set(EC2MetadataTokenHeader, token)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w.Code
+	}
+
+	t.Run("v1 optional", func(t *testing.T) {
+		if c := request(""); c != http.StatusOK {
+			t.Errorf("bad response code: %d", c)
+		}
+	})
+
+	t.Run("v1 required", func(t *testing.T) {
+		tokenRequired = true
+		defer func() { tokenRequired = false }()
+
+		if c := request(""); c != http.StatusUnauthorized {
+			t.Errorf("bad response code: %d", c)
+		}
+	})
+
+	t.Run("valid token", func(t *testing.T) {
+		tokenRequired = true
+		defer func() { tokenRequired = false }()
+
+		if c := request("good-token"); c != http.StatusOK {
+			t.Errorf("bad response code: %d", c)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		if c := request("expired-token"); c != http.StatusUnauthorized {
+			t.Errorf("bad response code: %d", c)
+		}
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		if c := request(strings.Repeat("x", 64)); c != http.StatusUnauthorized {
+			t.Errorf("bad response code: %d", c)
+		}
+	})
+}
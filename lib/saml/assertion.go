@@ -0,0 +1,148 @@
+// Package saml provides the means to authenticate with a SAML 2.0 identity provider and retrieve the SAML assertion
+// used to get AWS credentials for the roles the identity provider grants access to.
+package saml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// RoleAttribute is the name of the SAML attribute containing the AWS role and principal ARNs
+	RoleAttribute = "https://aws.amazon.com/SAML/Attributes/Role"
+	// SessionDurationAttribute is the name of the SAML attribute containing the maximum role credential duration, in seconds
+	SessionDurationAttribute = "https://aws.amazon.com/SAML/Attributes/SessionDuration"
+)
+
+// RolePrincipal is an AWS IAM role and the SAML provider (principal) allowed to assume the role
+type RolePrincipal struct {
+	RoleArn      string
+	PrincipalArn string
+}
+
+// Assertion is the base64 encoded SAMLResponse document returned by the identity provider
+type Assertion string
+
+// Decode returns the XML document of the SAML assertion
+func (a Assertion) Decode() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(a)))
+}
+
+// Roles returns the list of roles and principals found in the Role attribute of the assertion
+func (a Assertion) Roles() ([]*RolePrincipal, error) {
+	v, err := a.attribute(RoleAttribute)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]*RolePrincipal, 0)
+	for _, s := range v {
+		// the role and principal arn values may be in either order
+		r := new(RolePrincipal)
+		for _, f := range strings.Split(s, ",") {
+			f = strings.TrimSpace(f)
+			if strings.Contains(f, ":saml-provider/") {
+				r.PrincipalArn = f
+			} else {
+				r.RoleArn = f
+			}
+		}
+
+		if len(r.RoleArn) > 0 && len(r.PrincipalArn) > 0 {
+			roles = append(roles, r)
+		}
+	}
+
+	return roles, nil
+}
+
+// Principal returns the ARN of the principal allowed to assume the provided role, or an error if the role is not
+// found in the assertion
+func (a Assertion) Principal(roleArn string) (string, error) {
+	roles, err := a.Roles()
+	if err != nil {
+		return "", err
+	}
+
+	for _, r := range roles {
+		if r.RoleArn == roleArn {
+			return r.PrincipalArn, nil
+		}
+	}
+
+	return "", fmt.Errorf("role %s not found in SAML assertion", roleArn)
+}
+
+// SessionDuration returns the value of the SessionDuration attribute of the assertion, or 0 if it is not set
+func (a Assertion) SessionDuration() (time.Duration, error) {
+	v, err := a.attribute(SessionDurationAttribute)
+	if err != nil || len(v) < 1 {
+		return 0, err
+	}
+
+	i, err := strconv.Atoi(v[0])
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(i) * time.Second, nil
+}
+
+// return all of the AttributeValues for the named Attribute.  Element namespaces are not consistent across identity
+// providers, so only the local element names are checked
+func (a Assertion) attribute(name string) ([]string, error) {
+	b, err := a.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	vals := make([]string, 0)
+	inAttr := false
+	var val *bytes.Buffer
+
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch e := t.(type) {
+		case xml.StartElement:
+			if e.Name.Local == "Attribute" {
+				inAttr = attrValue(e.Attr, "Name") == name
+			} else if e.Name.Local == "AttributeValue" && inAttr {
+				val = new(bytes.Buffer)
+			}
+		case xml.CharData:
+			if val != nil {
+				val.Write(e)
+			}
+		case xml.EndElement:
+			if e.Name.Local == "Attribute" {
+				inAttr = false
+			} else if e.Name.Local == "AttributeValue" && val != nil {
+				vals = append(vals, strings.TrimSpace(val.String()))
+				val = nil
+			}
+		}
+	}
+
+	return vals, nil
+}
+
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
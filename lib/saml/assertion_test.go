@@ -0,0 +1,113 @@
+package saml
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const assertionTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<saml2p:Response xmlns:saml2p="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion">
+  <saml2:Assertion>
+    <saml2:AttributeStatement>
+      <saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">%s</saml2:Attribute>
+      <saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/RoleSessionName">
+        <saml2:AttributeValue>bob@example.com</saml2:AttributeValue>
+      </saml2:Attribute>
+      <saml2:Attribute Name="https://aws.amazon.com/SAML/Attributes/SessionDuration">
+        <saml2:AttributeValue>43200</saml2:AttributeValue>
+      </saml2:Attribute>
+    </saml2:AttributeStatement>
+  </saml2:Assertion>
+</saml2p:Response>`
+
+// build a base64 encoded assertion document with the provided Role attribute values
+func testAssertion(roles ...string) Assertion {
+	v := make([]string, len(roles))
+	for i, r := range roles {
+		v[i] = fmt.Sprintf("<saml2:AttributeValue>%s</saml2:AttributeValue>", r)
+	}
+	return Assertion(base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(assertionTemplate, strings.Join(v, "")))))
+}
+
+func TestAssertion_Roles(t *testing.T) {
+	t.Run("good", func(t *testing.T) {
+		a := testAssertion(
+			"arn:aws:iam::123456789012:role/Admin,arn:aws:iam::123456789012:saml-provider/idp",
+			"arn:aws:iam::210987654321:saml-provider/idp,arn:aws:iam::210987654321:role/ReadOnly",
+		)
+
+		r, err := a.Roles()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(r) != 2 {
+			t.Errorf("unexpected role count: %d", len(r))
+			return
+		}
+
+		if r[1].RoleArn != "arn:aws:iam::210987654321:role/ReadOnly" || r[1].PrincipalArn != "arn:aws:iam::210987654321:saml-provider/idp" {
+			t.Error("bad role/principal for reversed attribute value")
+		}
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		r, err := testAssertion("arn:aws:iam::123456789012:role/Admin").Roles()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(r) > 0 {
+			t.Error("found role without principal")
+		}
+	})
+
+	t.Run("bad encoding", func(t *testing.T) {
+		if _, err := Assertion("not base64!").Roles(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("bad xml", func(t *testing.T) {
+		a := Assertion(base64.StdEncoding.EncodeToString([]byte("<Response><Attribute>")))
+		if _, err := a.Roles(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
+
+func TestAssertion_Principal(t *testing.T) {
+	a := testAssertion("arn:aws:iam::123456789012:role/Admin,arn:aws:iam::123456789012:saml-provider/idp")
+
+	t.Run("good", func(t *testing.T) {
+		p, err := a.Principal("arn:aws:iam::123456789012:role/Admin")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if p != "arn:aws:iam::123456789012:saml-provider/idp" {
+			t.Error("bad principal")
+		}
+	})
+
+	t.Run("missing role", func(t *testing.T) {
+		if _, err := a.Principal("arn:aws:iam::123456789012:role/Other"); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
+
+func TestAssertion_Attributes(t *testing.T) {
+	a := testAssertion()
+
+	d, err := a.SessionDuration()
+	if err != nil || d != 12*time.Hour {
+		t.Errorf("bad session duration: %s, %v", d, err)
+	}
+}
@@ -0,0 +1,232 @@
+package saml
+
+import (
+	"fmt"
+	"github.com/mmmorris1975/simple-logger"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// SamlResponseField is the name of the form field the identity provider uses to POST the SAML assertion to AWS
+	SamlResponseField = "SAMLResponse"
+	// DefaultMaxSteps is the default number of pages the client will process before giving up on finding the assertion
+	DefaultMaxSteps = 10
+	// PasswordEnvVar is the environment variable used to provide the identity provider password non-interactively
+	PasswordEnvVar = "SAML_PASSWORD"
+)
+
+// Client is the interface for retrieving a SAML assertion from an identity provider
+type Client interface {
+	AwsSaml() (Assertion, error)
+}
+
+// FormLoginClient is a Client which authenticates with an identity provider by completing the HTML forms returned
+// by the provider's login URL, like a browser would.  This allows the client to work with most identity providers
+// (Okta, Keycloak, ADFS, etc) which use a username and password login form, optionally followed by a form to enter
+// an MFA code.  Any forms without user input fields are submitted unchanged, until a form containing the SAMLResponse
+// field is found.
+type FormLoginClient struct {
+	// URL is the identity provider login URL which starts the SAML authentication for AWS
+	URL string
+	// Username is the user to authenticate with at the identity provider
+	Username string
+	// Password is the (optional) password for Username, if not set PasswordProvider is used to get the password
+	Password string
+	// PasswordProvider is a function called to get the password if the Password field is not set
+	PasswordProvider func() (string, error)
+	// MfaTokenProvider is a function called to get the MFA code, if the identity provider requests one
+	MfaTokenProvider func() (string, error)
+	// MaxSteps is the maximum number of pages processed before giving up
+	MaxSteps int
+	client   *http.Client
+	log      *simple_logger.Logger
+}
+
+// NewFormLoginClient creates a FormLoginClient for the provided identity provider URL.  A list of options can be
+// provided to set the Username and other client configuration.  An error is returned if the URL is invalid.
+func NewFormLoginClient(u string, options ...func(*FormLoginClient)) (*FormLoginClient, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if pu.Scheme != "https" && pu.Scheme != "http" {
+		return nil, fmt.Errorf("invalid SAML auth url: %s", u)
+	}
+
+	// a cookie jar is required, since most providers use cookies to track the login session across the forms
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &FormLoginClient{
+		URL:      pu.String(),
+		MaxSteps: DefaultMaxSteps,
+		client:   &http.Client{Jar: jar, Timeout: 30 * time.Second},
+	}
+
+	for _, o := range options {
+		o(c)
+	}
+
+	return c, nil
+}
+
+// WithLogger configures the provided logger in the client
+func (c *FormLoginClient) WithLogger(l *simple_logger.Logger) *FormLoginClient {
+	c.log = l
+	return c
+}
+
+// AwsSaml authenticates with the identity provider and returns the SAML assertion for AWS.  SAML assertions are only
+// valid for a few minutes, so every call gets a new assertion from the provider.  The provider's session cookies are
+// kept by the client, so the provider may not ask for the password or MFA code again while its session is valid.
+func (c *FormLoginClient) AwsSaml() (Assertion, error) {
+	res, err := c.client.Get(c.URL)
+	if err != nil {
+		return "", err
+	}
+
+	loginSent := false
+	mfaSent := false
+	for i := 0; i < c.MaxSteps; i++ {
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return "", err
+		}
+
+		if res.StatusCode >= 400 {
+			return "", fmt.Errorf("identity provider returned HTTP status %d for %s", res.StatusCode, res.Request.URL)
+		}
+
+		forms := parseForms(body)
+		f, err := c.nextForm(forms)
+		if err != nil {
+			return "", err
+		}
+
+		if v, ok := f.value(SamlResponseField); ok {
+			c.debug("found SAML assertion")
+			return Assertion(v), nil
+		}
+
+		var data url.Values
+		switch {
+		case f.isLogin():
+			if loginSent {
+				return "", fmt.Errorf("authentication failed for user %s", c.Username)
+			}
+			c.debug("submitting login form")
+
+			if data, err = c.loginValues(f); err != nil {
+				return "", err
+			}
+			loginSent = true
+		case f.isMfa():
+			if mfaSent {
+				return "", fmt.Errorf("MFA authentication failed for user %s", c.Username)
+			}
+			c.debug("submitting MFA form")
+
+			if data, err = c.mfaValues(f); err != nil {
+				return "", err
+			}
+			mfaSent = true
+		default:
+			c.debug("submitting form with no user input")
+			data = f.values(func(*formInput) string { return "" })
+		}
+
+		if res, err = c.submit(res.Request.URL, f, data); err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("SAML assertion not found after %d steps", c.MaxSteps)
+}
+
+// select the form to process from the page, forms with the SAMLResponse field are preferred over login forms, which
+// are preferred over MFA forms, and then any form without user input
+func (c *FormLoginClient) nextForm(forms []*htmlForm) (*htmlForm, error) {
+	checks := []func(*htmlForm) bool{
+		func(f *htmlForm) bool { _, ok := f.value(SamlResponseField); return ok },
+		(*htmlForm).isLogin,
+		(*htmlForm).isMfa,
+		(*htmlForm).isAutoSubmit,
+	}
+
+	for _, chk := range checks {
+		for _, f := range forms {
+			if chk(f) {
+				return f, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no usable form found in identity provider response")
+}
+
+func (c *FormLoginClient) loginValues(f *htmlForm) (url.Values, error) {
+	if len(c.Password) < 1 && c.PasswordProvider != nil {
+		p, err := c.PasswordProvider()
+		if err != nil {
+			return nil, err
+		}
+		c.Password = p
+	}
+
+	return f.values(func(i *formInput) string {
+		if i.kind == "password" {
+			return c.Password
+		} else if userFieldRe.MatchString(i.name) {
+			return c.Username
+		}
+		return i.value
+	}), nil
+}
+
+func (c *FormLoginClient) mfaValues(f *htmlForm) (url.Values, error) {
+	if c.MfaTokenProvider == nil {
+		return nil, fmt.Errorf("identity provider requested an MFA code, but no MFA token provider is configured")
+	}
+
+	t, err := c.MfaTokenProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	m := f.mfaField()
+	return f.values(func(i *formInput) string {
+		if i == m {
+			return t
+		}
+		return i.value
+	}), nil
+}
+
+// submit the form data, the form action is resolved relative to the URL of the page the form was found on
+func (c *FormLoginClient) submit(page *url.URL, f *htmlForm, data url.Values) (*http.Response, error) {
+	u, err := page.Parse(f.action)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.method == "GET" {
+		u.RawQuery = data.Encode()
+		return c.client.Get(u.String())
+	}
+	return c.client.Post(u.String(), "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
+
+func (c *FormLoginClient) debug(f string, v ...interface{}) {
+	if c.log != nil {
+		c.log.Debugf(f, v...)
+	}
+}
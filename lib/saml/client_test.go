@@ -0,0 +1,244 @@
+package saml
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	mockUser     = "bob"
+	mockPassword = "p@ssw0rd"
+	mockMfaCode  = "123456"
+)
+
+var mockAssertion = testAssertion("arn:aws:iam::123456789012:role/Admin,arn:aws:iam::123456789012:saml-provider/idp")
+
+// mockIdp simulates an identity provider with a login form, an optional MFA form, and an intermediate auto-submit
+// form before returning the form with the SAMLResponse.  Login state is tracked with a cookie.
+func mockIdp(mfa bool) *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `<html><head><script>var x = 1 < 2;</script></head><body>
+<form id="search" action="/search"><input type="text" name="q"></form>
+<form method="post" action="/login">
+  <input type="hidden" name="csrf" value="abc123">
+  <input type="text" name="username">
+  <input type="password" name="password">
+  <input type="checkbox" name="remember">
+  <input type="submit" name="login" value="Sign In">
+  <input type="submit" name="cancel" value="Cancel">
+</form></body></html>`)
+			return
+		}
+
+		r.ParseForm()
+		if r.Form.Get("csrf") != "abc123" || r.Form.Get("login") != "Sign In" || len(r.Form.Get("cancel")) > 0 ||
+			r.Form.Get("username") != mockUser || r.Form.Get("password") != mockPassword {
+			// bad login, show the form again
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "1", Path: "/"})
+		if mfa {
+			fmt.Fprint(w, `<html><body><form method="post" action="mfa"><input type="text" name="otp_code"><input type="submit" value="Verify"></form></body></html>`)
+		} else {
+			fmt.Fprint(w, `<html><body><form method="post" action="/sso"><input type="hidden" name="step" value="sso"/></form></body></html>`)
+		}
+	})
+
+	mux.HandleFunc("/mfa", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("otp_code") != mockMfaCode {
+			fmt.Fprint(w, `<html><body><form method="post" action="/mfa"><input type="text" name="otp_code"></form></body></html>`)
+			return
+		}
+		fmt.Fprint(w, `<html><body><form method="post" action="/sso"><input type="hidden" name="step" value="sso"/></form></body></html>`)
+	})
+
+	mux.HandleFunc("/sso", func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err != nil || c.Value != "1" {
+			http.Error(w, "not logged in", http.StatusUnauthorized)
+			return
+		}
+
+		fmt.Fprintf(w, `<html><body onload="document.forms[0].submit()">
+<form method="post" action="https://signin.aws.amazon.com/saml">
+<input type="hidden" name="SAMLResponse" value="%s"/>
+</form></body></html>`, mockAssertion)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func newTestClient(t *testing.T, url string, options ...func(*FormLoginClient)) *FormLoginClient {
+	o := append([]func(*FormLoginClient){func(c *FormLoginClient) {
+		c.Username = mockUser
+		c.Password = mockPassword
+		c.MfaTokenProvider = func() (string, error) { return mockMfaCode, nil }
+	}}, options...)
+
+	c, err := NewFormLoginClient(url, o...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestNewFormLoginClient(t *testing.T) {
+	t.Run("good", func(t *testing.T) {
+		c, err := NewFormLoginClient("https://idp.example.com/login", func(c *FormLoginClient) { c.Username = "x" })
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.Username != "x" || c.MaxSteps != DefaultMaxSteps {
+			t.Error("bad client configuration")
+		}
+	})
+
+	t.Run("bad url", func(t *testing.T) {
+		if _, err := NewFormLoginClient("idp.example.com/login"); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
+
+func TestFormLoginClient_AwsSaml(t *testing.T) {
+	t.Run("login", func(t *testing.T) {
+		s := mockIdp(false)
+		defer s.Close()
+
+		a, err := newTestClient(t, s.URL+"/login").AwsSaml()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if a != mockAssertion {
+			t.Error("bad SAML assertion")
+		}
+	})
+
+	t.Run("mfa", func(t *testing.T) {
+		s := mockIdp(true)
+		defer s.Close()
+
+		c := newTestClient(t, s.URL+"/login")
+		a, err := c.AwsSaml()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if a != mockAssertion {
+			t.Error("bad SAML assertion")
+			return
+		}
+
+		// assertions expire, so the idp is contacted again for a new assertion
+		if a, err := c.AwsSaml(); err != nil || a != mockAssertion {
+			t.Errorf("did not get new assertion: %v", err)
+			return
+		}
+
+		s.Close()
+		if _, err := c.AwsSaml(); err == nil {
+			t.Error("expired assertion reused by client")
+		}
+	})
+
+	t.Run("password provider", func(t *testing.T) {
+		s := mockIdp(false)
+		defer s.Close()
+
+		c := newTestClient(t, s.URL+"/login", func(c *FormLoginClient) {
+			c.Password = ""
+			c.PasswordProvider = func() (string, error) { return mockPassword, nil }
+		})
+
+		if _, err := c.AwsSaml(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("bad password", func(t *testing.T) {
+		s := mockIdp(false)
+		defer s.Close()
+
+		_, err := newTestClient(t, s.URL+"/login", func(c *FormLoginClient) { c.Password = "bad" }).AwsSaml()
+		if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+			t.Errorf("did not receive expected error: %v", err)
+		}
+	})
+
+	t.Run("bad mfa", func(t *testing.T) {
+		s := mockIdp(true)
+		defer s.Close()
+
+		_, err := newTestClient(t, s.URL+"/login", func(c *FormLoginClient) {
+			c.MfaTokenProvider = func() (string, error) { return "000000", nil }
+		}).AwsSaml()
+
+		if err == nil || !strings.Contains(err.Error(), "MFA") {
+			t.Errorf("did not receive expected error: %v", err)
+		}
+	})
+
+	t.Run("no mfa provider", func(t *testing.T) {
+		s := mockIdp(true)
+		defer s.Close()
+
+		if _, err := newTestClient(t, s.URL+"/login", func(c *FormLoginClient) { c.MfaTokenProvider = nil }).AwsSaml(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("http error", func(t *testing.T) {
+		s := mockIdp(false)
+		defer s.Close()
+
+		if _, err := newTestClient(t, s.URL+"/sso").AwsSaml(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("no form", func(t *testing.T) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "<html><body>Nothing here</body></html>")
+		}))
+		defer s.Close()
+
+		if _, err := newTestClient(t, s.URL).AwsSaml(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("max steps", func(t *testing.T) {
+		s := mockIdp(false)
+		defer s.Close()
+
+		if _, err := newTestClient(t, s.URL+"/login", func(c *FormLoginClient) { c.MaxSteps = 1 }).AwsSaml(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
+
+func TestReadPassword(t *testing.T) {
+	out := new(strings.Builder)
+	p, err := readPassword(strings.NewReader("s3cret\r\n"), out)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if p != "s3cret" || !strings.Contains(out.String(), "Password") {
+		t.Error("bad password read")
+	}
+}
@@ -0,0 +1,142 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	userFieldRe = regexp.MustCompile(`(?i)user|login|email`)
+	mfaFieldRe  = regexp.MustCompile(`(?i)otp|mfa|code|token|passcode|factor`)
+	// content which is not valid XML, and has nothing we need to find the forms
+	skipContentRe = regexp.MustCompile(`(?is)<script\b.*?</script>|<style\b.*?</style>|<!--.*?-->`)
+)
+
+type formInput struct {
+	name  string
+	value string
+	kind  string
+}
+
+type htmlForm struct {
+	action string
+	method string
+	inputs []*formInput
+}
+
+// parseForms returns the forms found in an HTML document.  The document is parsed as (non-strict) XML, which is good
+// enough for the login pages served by identity providers, and avoids a dependency on a full HTML parser.  Any
+// parsing error will stop the parsing, and return the forms found so far.
+func parseForms(b []byte) []*htmlForm {
+	forms := make([]*htmlForm, 0)
+	var cur *htmlForm
+
+	d := xml.NewDecoder(bytes.NewReader(skipContentRe.ReplaceAll(b, nil)))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	for {
+		t, err := d.Token()
+		if err != nil {
+			break
+		}
+
+		switch e := t.(type) {
+		case xml.StartElement:
+			switch strings.ToLower(e.Name.Local) {
+			case "form":
+				cur = &htmlForm{action: attrValue(e.Attr, "action"), method: strings.ToUpper(attrValue(e.Attr, "method"))}
+				forms = append(forms, cur)
+			case "input":
+				if cur != nil {
+					i := &formInput{name: attrValue(e.Attr, "name"), value: attrValue(e.Attr, "value"), kind: strings.ToLower(attrValue(e.Attr, "type"))}
+					if len(i.kind) < 1 {
+						i.kind = "text"
+					}
+
+					if len(i.name) > 0 {
+						cur.inputs = append(cur.inputs, i)
+					}
+				}
+			}
+		case xml.EndElement:
+			if strings.ToLower(e.Name.Local) == "form" {
+				cur = nil
+			}
+		}
+	}
+
+	return forms
+}
+
+// return the value of the named form input, and if the input was found
+func (f *htmlForm) value(name string) (string, bool) {
+	for _, i := range f.inputs {
+		if i.name == name {
+			return i.value, true
+		}
+	}
+	return "", false
+}
+
+// isLogin returns true if the form has a password field
+func (f *htmlForm) isLogin() bool {
+	for _, i := range f.inputs {
+		if i.kind == "password" {
+			return true
+		}
+	}
+	return false
+}
+
+// isMfa returns true if the form has a visible field which looks like it's for an MFA code
+func (f *htmlForm) isMfa() bool {
+	return f.mfaField() != nil
+}
+
+func (f *htmlForm) mfaField() *formInput {
+	for _, i := range f.inputs {
+		if (i.kind == "text" || i.kind == "number" || i.kind == "tel") && mfaFieldRe.MatchString(i.name) {
+			return i
+		}
+	}
+	return nil
+}
+
+// isAutoSubmit returns true if the form has no user input fields, like the intermediate pages some identity
+// providers use to POST data between their endpoints with javascript
+func (f *htmlForm) isAutoSubmit() bool {
+	for _, i := range f.inputs {
+		if i.kind != "hidden" && i.kind != "submit" {
+			return false
+		}
+	}
+	return true
+}
+
+// values returns the form data to submit, filling in visible fields using the provided function
+func (f *htmlForm) values(fill func(*formInput) string) url.Values {
+	v := url.Values{}
+	submit := false
+	for _, i := range f.inputs {
+		switch i.kind {
+		case "hidden":
+			v.Set(i.name, i.value)
+		case "submit", "button", "image", "reset":
+			// some pages check which button was used, include the first named submit button, like a browser would
+			if i.kind == "submit" && !submit {
+				v.Set(i.name, i.value)
+				submit = true
+			}
+		case "checkbox", "radio":
+			// leave unchecked
+		default:
+			v.Set(i.name, fill(i))
+		}
+	}
+	return v
+}
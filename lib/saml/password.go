@@ -0,0 +1,42 @@
+package saml
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mmmorris1975/aws-runas/internal/tty"
+	"io"
+	"strings"
+)
+
+// TtyPasswordProvider will print a prompt to the controlling terminal for a user to enter their identity provider
+// password, and read the password from the terminal with echo disabled.
+func TtyPasswordProvider() (string, error) {
+	in, out, err := tty.Open()
+	if err != nil {
+		return "", fmt.Errorf("unable to open terminal for password prompt: %v", err)
+	}
+	defer in.Close()
+	defer out.Close()
+
+	restore, err := tty.DisableEcho(in)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	p, err := readPassword(in, out)
+	fmt.Fprintln(out)
+	return p, err
+}
+
+func readPassword(in io.Reader, out io.Writer) (string, error) {
+	if _, err := fmt.Fprint(out, "Enter Password: "); err != nil {
+		return "", err
+	}
+
+	p, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && (err != io.EOF || len(p) < 1) {
+		return "", err
+	}
+	return strings.TrimRight(p, "\r\n"), nil
+}
@@ -0,0 +1,231 @@
+// Package sso provides a client for AWS SSO (IAM Identity Center), to log in using the OIDC device authorization
+// flow, and get the credentials for the accounts and roles the user is assigned.  The SSO access token is cached
+// using the same format and location as the AWS CLI, so a login is shared with the AWS CLI and SDKs.
+package sso
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mmmorris1975/simple-logger"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// tokenExpiryWindow is the amount of time before the access token expiration when it's considered expired, so we
+// don't use a token which will expire before the API call is made
+const tokenExpiryWindow = 1 * time.Minute
+
+// Client is the type used to interact with the AWS SSO OIDC and portal APIs for a single SSO start URL
+type Client struct {
+	// StartUrl is the AWS SSO user portal URL
+	StartUrl string
+	// Region is the AWS region hosting the SSO service
+	Region string
+	// CacheDir is the directory used to cache the SSO access token, if not set the AWS CLI default ~/.aws/sso/cache is used
+	CacheDir string
+	// OidcUrl is the base URL of the SSO OIDC API, if not set the regional AWS endpoint is used
+	OidcUrl string
+	// PortalUrl is the base URL of the SSO portal API, if not set the regional AWS endpoint is used
+	PortalUrl string
+	// Prompt is called with the verification URL and user code when the user needs to log in with their browser,
+	// the default prints instructions to stderr
+	Prompt func(url, code string)
+	// PollInterval overrides the interval returned by the device authorization API to check for completed logins
+	PollInterval time.Duration
+	client       *http.Client
+	token        *Token
+	log          *simple_logger.Logger
+}
+
+// NewClient creates a Client for the provided SSO start URL and region.  A list of options can be provided to
+// override the default Client configuration.
+func NewClient(startUrl, region string, options ...func(*Client)) (*Client, error) {
+	if len(startUrl) < 1 || len(region) < 1 {
+		return nil, fmt.Errorf("SSO start url and region are required")
+	}
+
+	c := &Client{
+		StartUrl:  startUrl,
+		Region:    region,
+		OidcUrl:   fmt.Sprintf("https://oidc.%s.amazonaws.com", region),
+		PortalUrl: fmt.Sprintf("https://portal.sso.%s.amazonaws.com", region),
+		Prompt:    stderrPrompt,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+
+	for _, o := range options {
+		o(c)
+	}
+
+	if len(c.CacheDir) < 1 {
+		h, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		c.CacheDir = filepath.Join(h, ".aws", "sso", "cache")
+	}
+
+	return c, nil
+}
+
+// WithLogger configures the provided logger in the client
+func (c *Client) WithLogger(l *simple_logger.Logger) *Client {
+	c.log = l
+	return c
+}
+
+// Token is the SSO access token, as stored in the AWS CLI SSO cache
+type Token struct {
+	StartUrl    string `json:"startUrl"`
+	Region      string `json:"region"`
+	AccessToken string `json:"accessToken"`
+	ExpiresAt   string `json:"expiresAt"`
+}
+
+// Expiration returns the expiration time of the token, an unparseable value is treated as already expired
+func (t *Token) Expiration() time.Time {
+	// older versions of the AWS CLI use a 'UTC' suffix instead of 'Z'
+	for _, f := range []string{time.RFC3339, "2006-01-02T15:04:05UTC"} {
+		if e, err := time.Parse(f, t.ExpiresAt); err == nil {
+			return e
+		}
+	}
+	return time.Time{}
+}
+
+// IsExpired returns true if the token is expired, or will soon expire
+func (t *Token) IsExpired() bool {
+	return t == nil || len(t.AccessToken) < 1 || time.Now().Add(tokenExpiryWindow).After(t.Expiration())
+}
+
+// Token returns a valid SSO access token, using the cached token if it's not expired, otherwise the user is
+// prompted to log in using the device authorization flow, and the new token is cached.
+func (c *Client) Token() (*Token, error) {
+	if c.token.IsExpired() {
+		if t, err := c.cachedToken(); err == nil && !t.IsExpired() {
+			c.debug("found cached SSO token")
+			c.token = t
+		} else {
+			c.debug("SSO token expired or not found, logging in")
+			if err := c.Login(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c.token, nil
+}
+
+// Login performs the OIDC device authorization flow to get a new SSO access token, and caches the token
+func (c *Client) Login() error {
+	t, err := c.deviceLogin()
+	if err != nil {
+		return err
+	}
+	c.token = t
+
+	if err := c.storeToken(t); err != nil {
+		c.debug("error caching SSO token: %v", err)
+	}
+	return nil
+}
+
+// the AWS CLI names the token cache file using the SHA1 hash of the start url
+func (c *Client) cacheFile() string {
+	h := sha1.Sum([]byte(c.StartUrl))
+	return filepath.Join(c.CacheDir, hex.EncodeToString(h[:])+".json")
+}
+
+func (c *Client) cachedToken() (*Token, error) {
+	b, err := ioutil.ReadFile(c.cacheFile())
+	if err != nil {
+		return nil, err
+	}
+
+	t := new(Token)
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (c *Client) storeToken(t *Token) error {
+	if err := os.MkdirAll(c.CacheDir, 0700); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.cacheFile(), b, 0600)
+}
+
+// apiError is the error document returned by the SSO APIs
+type apiError struct {
+	status      int
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+	Message     string `json:"message"`
+}
+
+func (e *apiError) String() string {
+	m := e.Message
+	if len(e.Description) > 0 {
+		m = e.Description
+	}
+	return fmt.Sprintf("SSO API error (HTTP %d): %s %s", e.status, e.Error, m)
+}
+
+// send the request, and unmarshal the JSON response body into out.  If the response status is an error, the
+// error document is returned as an *apiError
+func (c *Client) do(r *http.Request, out interface{}) (*apiError, error) {
+	res, err := c.client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 300 {
+		e := &apiError{status: res.StatusCode}
+		json.Unmarshal(b, e)
+		return e, nil
+	}
+
+	return nil, json.Unmarshal(b, out)
+}
+
+func (c *Client) postJSON(url string, in interface{}, out interface{}) (*apiError, error) {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	return c.do(r, out)
+}
+
+func stderrPrompt(url, code string) {
+	fmt.Fprintf(os.Stderr, "Open the following URL in your browser to log in to AWS SSO, and verify the code %s\n\n%s\n\n", code, url)
+}
+
+func (c *Client) debug(f string, v ...interface{}) {
+	if c.log != nil {
+		c.log.Debugf(f, v...)
+	}
+}
@@ -0,0 +1,254 @@
+package sso
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mockAccessToken = "mock-access-token"
+
+// mockSso simulates the SSO OIDC and portal APIs.  The token endpoint returns authorization_pending for the first
+// poll, to simulate the user completing the login in their browser.
+type mockSso struct {
+	*httptest.Server
+	polls  int
+	logins int
+}
+
+func newMockSso() *mockSso {
+	m := new(mockSso)
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/client/register", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"clientId":"cid","clientSecret":"csecret"}`)
+	})
+
+	mux.HandleFunc("/device_authorization", func(w http.ResponseWriter, r *http.Request) {
+		in := make(map[string]string)
+		json.NewDecoder(r.Body).Decode(&in)
+		if in["clientId"] != "cid" || in["startUrl"] != "https://example.awsapps.com/start" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_request"}`)
+			return
+		}
+		fmt.Fprint(w, `{"deviceCode":"dcode","userCode":"ABCD-EFGH","verificationUriComplete":"https://device.sso/?user_code=ABCD-EFGH","expiresIn":5,"interval":1}`)
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		m.polls++
+		if m.polls < 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"authorization_pending"}`)
+			return
+		}
+		m.logins++
+		fmt.Fprintf(w, `{"accessToken":"%s","expiresIn":3600,"tokenType":"Bearer"}`, mockAccessToken)
+	})
+
+	mux.HandleFunc("/federation/credentials", func(w http.ResponseWriter, r *http.Request) {
+		if !m.authorized(w, r) {
+			return
+		}
+
+		q := r.URL.Query()
+		if q.Get("account_id") != "123456789012" || q.Get("role_name") != "Admin" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message":"No access"}`)
+			return
+		}
+
+		exp := time.Now().Add(1*time.Hour).UnixNano() / int64(time.Millisecond)
+		fmt.Fprintf(w, `{"roleCredentials":{"accessKeyId":"ASIAMOCK","secretAccessKey":"secret","sessionToken":"token","expiration":%d}}`, exp)
+	})
+
+	mux.HandleFunc("/assignment/accounts", func(w http.ResponseWriter, r *http.Request) {
+		if !m.authorized(w, r) {
+			return
+		}
+
+		if r.URL.Query().Get("next_token") == "page2" {
+			fmt.Fprint(w, `{"accountList":[{"accountId":"210987654321","accountName":"dev"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"accountList":[{"accountId":"123456789012","accountName":"prod"}],"nextToken":"page2"}`)
+	})
+
+	mux.HandleFunc("/assignment/roles", func(w http.ResponseWriter, r *http.Request) {
+		if !m.authorized(w, r) {
+			return
+		}
+		a := r.URL.Query().Get("account_id")
+		fmt.Fprintf(w, `{"roleList":[{"roleName":"Admin","accountId":"%s"},{"roleName":"ReadOnly","accountId":"%s"}]}`, a, a)
+	})
+
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockSso) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get(bearerTokenHeader) != mockAccessToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"message":"Session token not found or invalid"}`)
+		return false
+	}
+	return true
+}
+
+func newTestClient(t *testing.T, m *mockSso, dir string) *Client {
+	c, err := NewClient("https://example.awsapps.com/start", "us-east-1", func(c *Client) {
+		c.OidcUrl = m.URL
+		c.PortalUrl = m.URL
+		c.CacheDir = dir
+		c.PollInterval = 10 * time.Millisecond
+		c.Prompt = func(u, code string) {
+			if code != "ABCD-EFGH" || !strings.Contains(u, code) {
+				t.Errorf("bad login prompt: %s %s", u, code)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestNewClient(t *testing.T) {
+	t.Run("good", func(t *testing.T) {
+		c, err := NewClient("https://example.awsapps.com/start", "us-east-2")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c.OidcUrl != "https://oidc.us-east-2.amazonaws.com" || !strings.HasSuffix(c.CacheDir, filepath.Join(".aws", "sso", "cache")) {
+			t.Error("bad client defaults")
+		}
+	})
+
+	t.Run("missing region", func(t *testing.T) {
+		if _, err := NewClient("https://example.awsapps.com/start", ""); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
+
+func TestClient_Token(t *testing.T) {
+	m := newMockSso()
+	defer m.Close()
+
+	dir, err := ioutil.TempDir("", "sso-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("login", func(t *testing.T) {
+		tok, err := newTestClient(t, m, dir).Token()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if tok.AccessToken != mockAccessToken || tok.IsExpired() || m.polls != 2 {
+			t.Error("bad token from login")
+		}
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		// the cache file is named using the sha1 of the start url, like the AWS CLI
+		b, err := ioutil.ReadFile(filepath.Join(dir, "e8be5486177c5b5392bd9aa76563515b29358e6e.json"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if !strings.Contains(string(b), `"accessToken":"mock-access-token"`) {
+			t.Error("bad token cache content")
+			return
+		}
+
+		if _, err := newTestClient(t, m, dir).Token(); err != nil || m.logins != 1 {
+			t.Error("cached token not used")
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		tok := &Token{AccessToken: "x", ExpiresAt: "2019-11-14T04:05:45UTC"}
+		if !tok.IsExpired() || tok.Expiration().Year() != 2019 {
+			t.Error("bad expired token")
+		}
+	})
+}
+
+func TestClient_RoleCredentials(t *testing.T) {
+	m := newMockSso()
+	defer m.Close()
+
+	dir, err := ioutil.TempDir("", "sso-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newTestClient(t, m, dir)
+
+	t.Run("good", func(t *testing.T) {
+		r, err := c.RoleCredentials("123456789012", "Admin")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if r.AccessKeyID != "ASIAMOCK" || r.Expiration.Before(time.Now()) {
+			t.Error("bad role credentials")
+		}
+	})
+
+	t.Run("bad role", func(t *testing.T) {
+		if _, err := c.RoleCredentials("123456789012", "Other"); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+
+	t.Run("revoked token", func(t *testing.T) {
+		// the client should log in again, and retry
+		c.token = &Token{AccessToken: "revoked", ExpiresAt: time.Now().Add(1 * time.Hour).UTC().Format(time.RFC3339)}
+		if _, err := c.RoleCredentials("123456789012", "Admin"); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestClient_AccountRoles(t *testing.T) {
+	m := newMockSso()
+	defer m.Close()
+
+	dir, err := ioutil.TempDir("", "sso-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := newTestClient(t, m, dir).AccountRoles()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(r) != 4 {
+		t.Errorf("unexpected role count: %d", len(r))
+		return
+	}
+
+	if r[2].AccountID != "210987654321" || r[2].AccountName != "dev" || r[2].RoleName != "Admin" {
+		t.Error("bad account role")
+	}
+}
@@ -0,0 +1,99 @@
+package sso
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	clientName       = "aws-runas"
+	deviceGrantType  = "urn:ietf:params:oauth:grant-type:device_code"
+	errAuthPending   = "AuthorizationPendingException"
+	errSlowDown      = "SlowDownException"
+	slowDownInterval = 5 * time.Second
+)
+
+type registerClientOutput struct {
+	ClientId     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+}
+
+type deviceAuthOutput struct {
+	DeviceCode              string `json:"deviceCode"`
+	UserCode                string `json:"userCode"`
+	VerificationUri         string `json:"verificationUri"`
+	VerificationUriComplete string `json:"verificationUriComplete"`
+	ExpiresIn               int64  `json:"expiresIn"`
+	Interval                int64  `json:"interval"`
+}
+
+type createTokenOutput struct {
+	AccessToken string `json:"accessToken"`
+	ExpiresIn   int64  `json:"expiresIn"`
+	TokenType   string `json:"tokenType"`
+}
+
+// deviceLogin registers an OIDC client, starts the device authorization, and polls for the access token while the
+// user completes the login in their browser
+func (c *Client) deviceLogin() (*Token, error) {
+	reg := new(registerClientOutput)
+	if e, err := c.postJSON(c.OidcUrl+"/client/register", map[string]string{"clientName": clientName, "clientType": "public"}, reg); err != nil {
+		return nil, err
+	} else if e != nil {
+		return nil, fmt.Errorf("error registering SSO client: %s", e)
+	}
+
+	auth := new(deviceAuthOutput)
+	in := map[string]string{"clientId": reg.ClientId, "clientSecret": reg.ClientSecret, "startUrl": c.StartUrl}
+	if e, err := c.postJSON(c.OidcUrl+"/device_authorization", in, auth); err != nil {
+		return nil, err
+	} else if e != nil {
+		return nil, fmt.Errorf("error starting SSO device authorization: %s", e)
+	}
+
+	u := auth.VerificationUriComplete
+	if len(u) < 1 {
+		u = auth.VerificationUri
+	}
+	c.Prompt(u, auth.UserCode)
+
+	interval := time.Duration(auth.Interval) * time.Second
+	if c.PollInterval > 0 {
+		interval = c.PollInterval
+	} else if interval < 1 {
+		interval = slowDownInterval
+	}
+
+	in = map[string]string{"clientId": reg.ClientId, "clientSecret": reg.ClientSecret, "deviceCode": auth.DeviceCode, "grantType": deviceGrantType}
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		tok := new(createTokenOutput)
+		e, err := c.postJSON(c.OidcUrl+"/token", in, tok)
+		if err != nil {
+			return nil, err
+		}
+
+		if e != nil {
+			switch e.Error {
+			case errAuthPending, "authorization_pending":
+				c.debug("waiting for SSO login")
+				continue
+			case errSlowDown, "slow_down":
+				interval += slowDownInterval
+				continue
+			}
+			return nil, fmt.Errorf("error getting SSO token: %s", e)
+		}
+
+		return &Token{
+			StartUrl:    c.StartUrl,
+			Region:      c.Region,
+			AccessToken: tok.AccessToken,
+			ExpiresAt:   time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second).UTC().Format(time.RFC3339),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("SSO login was not completed before the device authorization expired")
+}
@@ -0,0 +1,163 @@
+package sso
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const bearerTokenHeader = "x-amz-sso_bearer_token"
+
+// RoleCredentials are the AWS credentials for an SSO account and role
+type RoleCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// AccountRole is an account and role assigned to the SSO user
+type AccountRole struct {
+	AccountID   string `json:"account_id"`
+	AccountName string `json:"account_name"`
+	RoleName    string `json:"role_name"`
+}
+
+type roleCredentialsOutput struct {
+	RoleCredentials struct {
+		AccessKeyId     string `json:"accessKeyId"`
+		SecretAccessKey string `json:"secretAccessKey"`
+		SessionToken    string `json:"sessionToken"`
+		Expiration      int64  `json:"expiration"`
+	} `json:"roleCredentials"`
+}
+
+type listAccountsOutput struct {
+	NextToken   string `json:"nextToken"`
+	AccountList []struct {
+		AccountId   string `json:"accountId"`
+		AccountName string `json:"accountName"`
+	} `json:"accountList"`
+}
+
+type listAccountRolesOutput struct {
+	NextToken string `json:"nextToken"`
+	RoleList  []struct {
+		RoleName  string `json:"roleName"`
+		AccountId string `json:"accountId"`
+	} `json:"roleList"`
+}
+
+// RoleCredentials returns the AWS credentials for the provided SSO account and role
+func (c *Client) RoleCredentials(accountId, roleName string) (*RoleCredentials, error) {
+	q := url.Values{"account_id": {accountId}, "role_name": {roleName}}
+
+	o := new(roleCredentialsOutput)
+	if err := c.portalGet("/federation/credentials", q, o); err != nil {
+		return nil, err
+	}
+
+	r := o.RoleCredentials
+	return &RoleCredentials{
+		AccessKeyID:     r.AccessKeyId,
+		SecretAccessKey: r.SecretAccessKey,
+		SessionToken:    r.SessionToken,
+		Expiration:      time.Unix(0, r.Expiration*int64(time.Millisecond)),
+	}, nil
+}
+
+// AccountRoles returns the list of all accounts and roles assigned to the SSO user
+func (c *Client) AccountRoles() ([]*AccountRole, error) {
+	roles := make([]*AccountRole, 0)
+
+	next := ""
+	for {
+		q := url.Values{}
+		if len(next) > 0 {
+			q.Set("next_token", next)
+		}
+
+		o := new(listAccountsOutput)
+		if err := c.portalGet("/assignment/accounts", q, o); err != nil {
+			return nil, err
+		}
+
+		for _, a := range o.AccountList {
+			r, err := c.accountRoles(a.AccountId, a.AccountName)
+			if err != nil {
+				return nil, err
+			}
+			roles = append(roles, r...)
+		}
+
+		if next = o.NextToken; len(next) < 1 {
+			break
+		}
+	}
+
+	return roles, nil
+}
+
+func (c *Client) accountRoles(accountId, accountName string) ([]*AccountRole, error) {
+	roles := make([]*AccountRole, 0)
+
+	next := ""
+	for {
+		q := url.Values{"account_id": {accountId}}
+		if len(next) > 0 {
+			q.Set("next_token", next)
+		}
+
+		o := new(listAccountRolesOutput)
+		if err := c.portalGet("/assignment/roles", q, o); err != nil {
+			return nil, err
+		}
+
+		for _, r := range o.RoleList {
+			roles = append(roles, &AccountRole{AccountID: accountId, AccountName: accountName, RoleName: r.RoleName})
+		}
+
+		if next = o.NextToken; len(next) < 1 {
+			break
+		}
+	}
+
+	return roles, nil
+}
+
+// call the portal API, if the API says the access token is not valid (like if the session was revoked), log in
+// again and retry the request once
+func (c *Client) portalGet(path string, q url.Values, out interface{}) error {
+	for i := 0; i < 2; i++ {
+		t, err := c.Token()
+		if err != nil {
+			return err
+		}
+
+		r, err := http.NewRequest(http.MethodGet, c.PortalUrl+path+"?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		r.Header.Set(bearerTokenHeader, t.AccessToken)
+
+		e, err := c.do(r, out)
+		if err != nil {
+			return err
+		}
+
+		if e == nil {
+			return nil
+		}
+
+		if e.status != http.StatusUnauthorized || i > 0 {
+			return fmt.Errorf("%s", e)
+		}
+
+		c.debug("SSO token rejected, logging in again")
+		if err := c.Login(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
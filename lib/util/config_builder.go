@@ -0,0 +1,132 @@
+package util
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strings"
+)
+
+// RoleProfile contains the details needed to configure a profile for a single IAM role
+type RoleProfile struct {
+	Name          string
+	AccountID     string
+	RoleName      string
+	RoleArn       string
+	Color         string
+	Region        string
+	SourceProfile string
+	MfaSerial     string
+}
+
+// ConfigBuilder generates profile configuration for a set of IAM role ARNs, suitable for use by the
+// AWS Extend Switch Roles browser plugin, or the AWS SDK config file
+type ConfigBuilder struct {
+	// Region is the (optional) region to set for each profile
+	Region string
+	// SourceProfile is the profile name used as the source_profile attribute in the SDK config file
+	SourceProfile string
+	// MfaSerial is the (optional) ARN of the MFA device used in the SDK config file
+	MfaSerial string
+	// AccountAliases is an (optional) mapping of AWS account IDs to account aliases.  If an alias is found for a role's
+	// account, the alias is used in place of the account ID when building the profile name.
+	AccountAliases map[string]string
+}
+
+// NewConfigBuilder creates a ConfigBuilder using the 'default' profile as the source profile.  A list of options
+// can be provided to override the SourceProfile, or set the Region and MfaSerial attributes.
+func NewConfigBuilder(options ...func(*ConfigBuilder)) *ConfigBuilder {
+	b := &ConfigBuilder{SourceProfile: "default"}
+
+	for _, o := range options {
+		o(b)
+	}
+
+	return b
+}
+
+// Profiles returns the list of RoleProfiles for the given roles, sorted by profile name.  Any values which
+// are not valid IAM role ARNs are skipped.
+func (b *ConfigBuilder) Profiles(roles Roles) []*RoleProfile {
+	profiles := make([]*RoleProfile, 0)
+
+	for _, r := range roles.Dedup() {
+		a, err := arn.Parse(r)
+		if err != nil || !strings.HasPrefix(a.Resource, "role/") {
+			continue
+		}
+
+		// role_name for the plugin must include any path information, profile name does not
+		name := strings.TrimPrefix(a.Resource, "role/")
+		f := strings.Split(name, "/")
+
+		acct := a.AccountID
+		if v, ok := b.AccountAliases[acct]; ok && len(v) > 0 {
+			acct = v
+		}
+
+		p := &RoleProfile{
+			Name:          fmt.Sprintf("%s-%s", acct, f[len(f)-1]),
+			AccountID:     a.AccountID,
+			RoleName:      name,
+			RoleArn:       a.String(),
+			Color:         accountColor(a.AccountID),
+			Region:        b.Region,
+			SourceProfile: b.SourceProfile,
+			MfaSerial:     b.MfaSerial,
+		}
+		profiles = append(profiles, p)
+	}
+
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// WriteSwitchRoleConfig writes the configuration for the AWS Extend Switch Roles browser plugin for the provided roles
+// REF: https://github.com/tilfin/aws-extend-switch-roles
+func (b *ConfigBuilder) WriteSwitchRoleConfig(w io.Writer, roles Roles) error {
+	for _, p := range b.Profiles(roles) {
+		s := fmt.Sprintf("[profile %s]\naws_account_id = %s\nrole_name = %s\ncolor = %s\n", p.Name, p.AccountID, p.RoleName, p.Color)
+		if len(p.Region) > 0 {
+			s += fmt.Sprintf("region = %s\n", p.Region)
+		}
+
+		if _, err := fmt.Fprintln(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteAwsConfig writes the SDK config file profile sections for the provided roles
+func (b *ConfigBuilder) WriteAwsConfig(w io.Writer, roles Roles) error {
+	for _, p := range b.Profiles(roles) {
+		if _, err := fmt.Fprintln(w, p.AwsConfigSection()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AwsConfigSection returns the SDK config file profile section for the RoleProfile
+func (p *RoleProfile) AwsConfigSection() string {
+	s := fmt.Sprintf("[profile %s]\nrole_arn = %s\nsource_profile = %s\n", p.Name, p.RoleArn, p.SourceProfile)
+	if len(p.MfaSerial) > 0 {
+		s += fmt.Sprintf("mfa_serial = %s\n", p.MfaSerial)
+	}
+
+	if len(p.Region) > 0 {
+		s += fmt.Sprintf("region = %s\n", p.Region)
+	}
+
+	return s
+}
+
+// Generate a stable color for an AWS account, so all roles for the account are displayed with the same color
+func accountColor(acct string) string {
+	h := fnv.New32a()
+	h.Write([]byte(acct))
+	return fmt.Sprintf("%06x", h.Sum32()&0xffffff)
+}
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"os"
+	"testing"
+)
+
+var builderRoles = Roles([]string{
+	"arn:aws:iam::210987654321:role/path/ReadOnly",
+	"arn:aws:iam::123456789012:role/Admin",
+	"arn:aws:iam::123456789012:user/Bob",
+	"not-an-arn",
+	"arn:aws:iam::123456789012:role/Admin",
+})
+
+func TestNewConfigBuilder(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		b := NewConfigBuilder()
+		if b.SourceProfile != "default" {
+			t.Error("bad default source profile")
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		b := NewConfigBuilder(func(b *ConfigBuilder) {
+			b.SourceProfile = "other"
+			b.Region = "us-east-2"
+		})
+
+		if b.SourceProfile != "other" || b.Region != "us-east-2" {
+			t.Error("options not applied")
+		}
+	})
+}
+
+func TestConfigBuilder_Profiles(t *testing.T) {
+	t.Run("good", func(t *testing.T) {
+		p := NewConfigBuilder().Profiles(builderRoles)
+		if len(p) != 2 {
+			t.Errorf("unexpected profile count: %d", len(p))
+			return
+		}
+
+		if p[0].Name != "123456789012-Admin" || p[0].RoleName != "Admin" {
+			t.Error("bad profile name or role name")
+		}
+
+		if p[1].Name != "210987654321-ReadOnly" || p[1].RoleName != "path/ReadOnly" {
+			t.Error("bad profile name or role name for role with path")
+		}
+
+		if p[0].Color == p[1].Color {
+			t.Error("different accounts have the same color")
+		}
+	})
+
+	t.Run("alias", func(t *testing.T) {
+		b := NewConfigBuilder(func(b *ConfigBuilder) {
+			b.AccountAliases = map[string]string{"123456789012": "my-acct"}
+		})
+
+		p := b.Profiles(builderRoles)
+		if p[0].Name != "210987654321-ReadOnly" || p[1].Name != "my-acct-Admin" {
+			t.Error("bad profile name using account alias")
+		}
+
+		if p[1].AccountID != "123456789012" {
+			t.Error("account id was changed by alias")
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if len(NewConfigBuilder().Profiles(nil)) > 0 {
+			t.Error("unexpected profiles from nil roles")
+		}
+	})
+}
+
+func ExampleConfigBuilder_WriteSwitchRoleConfig() {
+	b := NewConfigBuilder(func(b *ConfigBuilder) { b.Region = "us-west-2" })
+	b.WriteSwitchRoleConfig(os.Stdout, builderRoles)
+	// Output:
+	// [profile 123456789012-Admin]
+	// aws_account_id = 123456789012
+	// role_name = Admin
+	// color = 58fda7
+	// region = us-west-2
+	//
+	// [profile 210987654321-ReadOnly]
+	// aws_account_id = 210987654321
+	// role_name = path/ReadOnly
+	// color = e539af
+	// region = us-west-2
+}
+
+func ExampleConfigBuilder_WriteAwsConfig() {
+	b := NewConfigBuilder(func(b *ConfigBuilder) { b.MfaSerial = "arn:aws:iam::123456789012:mfa/bob" })
+	b.WriteAwsConfig(os.Stdout, builderRoles[:2])
+	// Output:
+	// [profile 123456789012-Admin]
+	// role_arn = arn:aws:iam::123456789012:role/Admin
+	// source_profile = default
+	// mfa_serial = arn:aws:iam::123456789012:mfa/bob
+	//
+	// [profile 210987654321-ReadOnly]
+	// role_arn = arn:aws:iam::210987654321:role/path/ReadOnly
+	// source_profile = default
+	// mfa_serial = arn:aws:iam::123456789012:mfa/bob
+}
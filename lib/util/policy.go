@@ -0,0 +1,414 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const assumeRoleAction = "sts:AssumeRole"
+
+// AssumableRole is an IAM role the user is allowed to assume, along with a description of any conditions the IAM
+// policies place on assuming the role (like requiring MFA, or a source IP address)
+type AssumableRole struct {
+	Arn        string   `json:"arn"`
+	Conditions []string `json:"conditions,omitempty"`
+}
+
+// String returns the role ARN, followed by the list of conditions (if any) in parentheses
+func (r *AssumableRole) String() string {
+	if len(r.Conditions) < 1 {
+		return r.Arn
+	}
+	return fmt.Sprintf("%s (%s)", r.Arn, strings.Join(r.Conditions, ", "))
+}
+
+// AssumableRoles is a container for AssumableRole
+type AssumableRoles []*AssumableRole
+
+// Roles returns the sorted set of role ARNs
+func (r AssumableRoles) Roles() Roles {
+	roles := make([]string, 0, len(r))
+	for _, v := range r {
+		roles = append(roles, v.Arn)
+	}
+	return Roles(roles).Dedup()
+}
+
+// policyStatement is a single statement of an IAM policy document.  The Action, Resource and condition value
+// elements may be a single value, or a list of values.
+type policyStatement struct {
+	Effect      string
+	Action      stringList
+	NotAction   stringList
+	Resource    stringList
+	NotResource stringList
+	Condition   map[string]map[string]stringList
+}
+
+// stringList is a policy element which may be a single value, or a list of values.  Non-string values (like the
+// booleans and numbers in conditions) are converted to strings.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch t := v.(type) {
+	case []interface{}:
+		for _, i := range t {
+			*l = append(*l, fmt.Sprint(i))
+		}
+	case nil:
+	default:
+		*l = append(*l, fmt.Sprint(t))
+	}
+	return nil
+}
+
+// appliesTo returns true if the statement Action (or NotAction) element includes the action
+func (s *policyStatement) appliesTo(action string) bool {
+	if len(s.NotAction) > 0 {
+		return !matchAny(s.NotAction, action, true)
+	}
+	return matchAny(s.Action, action, true)
+}
+
+// matchesResource returns true if the statement Resource (or NotResource) element includes the resource
+func (s *policyStatement) matchesResource(res string) bool {
+	if len(s.NotResource) > 0 {
+		return !matchAny(s.NotResource, res, false)
+	}
+	return matchAny(s.Resource, res, false)
+}
+
+// conditions returns the descriptions of the statement conditions, sorted to keep the output stable
+func (s *policyStatement) conditions() []string {
+	c := make([]string, 0)
+	for op, m := range s.Condition {
+		for k, v := range m {
+			c = append(c, conditionText(op, k, v, strings.EqualFold(s.Effect, "Deny")))
+		}
+	}
+
+	sort.Strings(c)
+	return c
+}
+
+// parseStatements returns the statements of the policy document.  Statements which don't look like a valid policy
+// statement are skipped.
+func parseStatements(doc *string) ([]*policyStatement, error) {
+	if doc == nil {
+		return nil, fmt.Errorf("nil policy doc")
+	}
+
+	parsedDoc, err := url.QueryUnescape(*doc)
+	if err != nil {
+		return nil, err
+	}
+
+	pol := struct{ Statement json.RawMessage }{}
+	if err := json.Unmarshal([]byte(parsedDoc), &pol); err != nil || len(pol.Statement) < 1 {
+		return nil, nil
+	}
+
+	raw := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(pol.Statement, &raw); err != nil {
+		// a policy with a single statement doesn't need to wrap it in a list
+		raw = append(raw, pol.Statement)
+	}
+
+	stmts := make([]*policyStatement, 0)
+	for _, r := range raw {
+		s := new(policyStatement)
+		if err := json.Unmarshal(r, s); err == nil {
+			stmts = append(stmts, s)
+		}
+	}
+	return stmts, nil
+}
+
+// policyEvaluator decides which roles the statements of a set of IAM policies allow the user to assume
+type policyEvaluator struct {
+	allow []*policyStatement
+	deny  []*policyStatement
+}
+
+// newPolicyEvaluator creates a policyEvaluator using the statements which apply to the sts:AssumeRole action
+func newPolicyEvaluator(stmts ...*policyStatement) *policyEvaluator {
+	e := new(policyEvaluator)
+
+	for _, s := range stmts {
+		if !s.appliesTo(assumeRoleAction) {
+			continue
+		}
+
+		switch strings.ToLower(s.Effect) {
+		case "allow":
+			e.allow = append(e.allow, s)
+		case "deny":
+			e.deny = append(e.deny, s)
+		}
+	}
+
+	return e
+}
+
+// candidates returns the Resource values of the Allow statements, which may contain wildcards.  Roles allowed by a
+// NotResource element can't be listed, since that would be every role except the ones in the element.
+func (e *policyEvaluator) candidates() Roles {
+	r := make([]string, 0)
+	for _, s := range e.allow {
+		r = append(r, s.Resource...)
+	}
+	return Roles(r).Dedup()
+}
+
+// evaluate returns true if the statements allow assuming the role, along with the conditions placed on assuming the
+// role.  If any Allow statement for the role is unconditional, the conditions of the other Allow statements don't
+// matter.  An unconditional Deny statement for the role wins over any Allow statement, and the conditions of any
+// other Deny statements are added to the list.
+func (e *policyEvaluator) evaluate(role string) (bool, []string) {
+	var allowed bool
+	cond := make([]string, 0)
+	unconditional := false
+
+	for _, s := range e.allow {
+		if !s.matchesResource(role) {
+			continue
+		}
+		allowed = true
+
+		c := s.conditions()
+		if len(c) < 1 {
+			unconditional = true
+		}
+		cond = append(cond, c...)
+	}
+
+	if !allowed {
+		return false, nil
+	}
+
+	if unconditional {
+		cond = cond[:0]
+	}
+
+	for _, s := range e.deny {
+		if !s.matchesResource(role) {
+			continue
+		}
+
+		c := s.conditions()
+		if len(c) < 1 {
+			return false, nil
+		}
+		cond = append(cond, c...)
+	}
+
+	return true, dedupStrings(cond)
+}
+
+// expandAccounts returns the role ARN with any wildcard in the account ID field replaced by each matching account
+// in the list.  Values which aren't ARNs, or don't have a wildcard account ID, are returned unchanged.
+func expandAccounts(role string, accounts []string) []string {
+	a, err := arn.Parse(role)
+	if err != nil || !hasWildcard(a.AccountID) {
+		return []string{role}
+	}
+
+	res := make([]string, 0)
+	for _, acct := range accounts {
+		if wildcardMatch(a.AccountID, acct) {
+			r := a
+			r.AccountID = acct
+			res = append(res, r.String())
+		}
+	}
+	return res
+}
+
+// expandRoles returns the roles with wildcard account IDs expanded, skipping any role which still contains a wildcard.
+// The accounts function is only called if there's a role with a wildcard in its account ID field, a wildcard only in
+// another part of the role (like the role name, or a Resource of "*") can't be expanded, so the role is just skipped.
+func expandRoles(roles Roles, accounts func() []string) Roles {
+	res := make([]string, 0)
+	var accts []string
+	var listed bool
+
+	for _, v := range roles {
+		if !hasWildcard(v) {
+			res = append(res, v)
+			continue
+		}
+
+		if a, err := arn.Parse(v); err != nil || !hasWildcard(a.AccountID) {
+			continue
+		}
+
+		if !listed {
+			accts = accounts()
+			listed = true
+		}
+
+		for _, a := range expandAccounts(v, accts) {
+			if !hasWildcard(a) {
+				res = append(res, a)
+			}
+		}
+	}
+
+	return Roles(res).Dedup()
+}
+
+func hasWildcard(s string) bool {
+	return strings.ContainsAny(s, "*?")
+}
+
+func matchAny(patterns []string, s string, ignoreCase bool) bool {
+	for _, p := range patterns {
+		if ignoreCase {
+			if wildcardMatch(strings.ToLower(p), strings.ToLower(s)) {
+				return true
+			}
+		} else if wildcardMatch(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch implements IAM policy wildcard matching, where '*' matches any sequence of characters (including
+// none) and '?' matches any single character
+func wildcardMatch(pattern, s string) bool {
+	p, i := 0, 0
+	star, mark := -1, 0
+
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star = p
+			mark = i
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			i = mark
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// operators with their opposite, used to turn the condition of a Deny statement into the condition needed to be allowed
+var negatedOperators = map[string]string{
+	"StringEquals":              "StringNotEquals",
+	"StringNotEquals":           "StringEquals",
+	"StringEqualsIgnoreCase":    "StringNotEqualsIgnoreCase",
+	"StringNotEqualsIgnoreCase": "StringEqualsIgnoreCase",
+	"StringLike":                "StringNotLike",
+	"StringNotLike":             "StringLike",
+	"ArnEquals":                 "ArnNotEquals",
+	"ArnNotEquals":              "ArnEquals",
+	"ArnLike":                   "ArnNotLike",
+	"ArnNotLike":                "ArnLike",
+	"IpAddress":                 "NotIpAddress",
+	"NotIpAddress":              "IpAddress",
+	"NumericEquals":             "NumericNotEquals",
+	"NumericNotEquals":          "NumericEquals",
+	"NumericLessThan":           "NumericGreaterThanEquals",
+	"NumericGreaterThanEquals":  "NumericLessThan",
+	"NumericLessThanEquals":     "NumericGreaterThan",
+	"NumericGreaterThan":        "NumericLessThanEquals",
+}
+
+// tag condition key prefixes, and the description used for them
+var tagConditionKeys = map[string]string{
+	"aws:principaltag/": "principal tag",
+	"aws:requesttag/":   "request tag",
+	"aws:resourcetag/":  "role tag",
+	"iam:resourcetag/":  "role tag",
+}
+
+// conditionText returns a short description of a policy condition.  The conditions of a Deny statement are turned
+// around to describe what is needed to assume the role, where the operator has an opposite.
+func conditionText(op, key string, values []string, deny bool) string {
+	op = strings.TrimSuffix(op, "IfExists")
+	if i := strings.Index(op, ":"); i >= 0 {
+		// drop the ForAnyValue and ForAllValues set operator prefixes
+		op = op[i+1:]
+	}
+
+	if deny {
+		if op == "Bool" {
+			v := make([]string, 0, len(values))
+			for _, b := range values {
+				if strings.EqualFold(b, "true") {
+					v = append(v, "false")
+				} else {
+					v = append(v, "true")
+				}
+			}
+			values = v
+		} else if neg, ok := negatedOperators[op]; ok {
+			op = neg
+		} else {
+			return fmt.Sprintf("denied if %s %s %s", key, op, strings.Join(values, ","))
+		}
+	}
+
+	k := strings.ToLower(key)
+	switch {
+	case k == "aws:multifactorauthpresent" && op == "Bool" && len(values) == 1:
+		if strings.EqualFold(values[0], "true") {
+			return "MFA required"
+		}
+		return "without MFA"
+	case k == "aws:multifactorauthage" && strings.HasPrefix(op, "NumericLessThan"):
+		return fmt.Sprintf("MFA within %ss", strings.Join(values, ","))
+	case k == "aws:sourceip" && op == "IpAddress":
+		return fmt.Sprintf("source IP %s", strings.Join(values, ","))
+	case k == "aws:sourceip" && op == "NotIpAddress":
+		return fmt.Sprintf("source IP not %s", strings.Join(values, ","))
+	}
+
+	for p, d := range tagConditionKeys {
+		if !strings.HasPrefix(k, p) {
+			continue
+		}
+
+		eq := "="
+		if strings.Contains(op, "Not") {
+			eq = "!="
+		}
+		return fmt.Sprintf("%s %s%s%s", d, key[len(p):], eq, strings.Join(values, "|"))
+	}
+
+	return fmt.Sprintf("%s %s %s", key, op, strings.Join(values, ","))
+}
+
+func dedupStrings(s []string) []string {
+	m := make(map[string]bool)
+	res := make([]string, 0)
+
+	for _, v := range s {
+		if !m[v] {
+			m[v] = true
+			res = append(res, v)
+		}
+	}
+	return res
+}
@@ -0,0 +1,258 @@
+package util
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"reflect"
+	"testing"
+)
+
+func TestWildcardMatch(t *testing.T) {
+	t.Run("exact", func(t *testing.T) {
+		if !wildcardMatch("arn:aws:iam::123456789012:role/a", "arn:aws:iam::123456789012:role/a") {
+			t.Error("exact value did not match")
+		}
+	})
+
+	t.Run("star", func(t *testing.T) {
+		if !wildcardMatch("arn:aws:iam::*:role/*-admin", "arn:aws:iam::123456789012:role/x/y-admin") {
+			t.Error("wildcard value did not match")
+		}
+	})
+
+	t.Run("question", func(t *testing.T) {
+		if !wildcardMatch("12345678901?", "123456789012") || wildcardMatch("12345678901?", "1234567890123") {
+			t.Error("single character wildcard mismatch")
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		if wildcardMatch("arn:aws:iam::*:role/admin", "arn:aws:iam::123456789012:role/admin2") {
+			t.Error("unexpected match")
+		}
+	})
+}
+
+func TestParseStatements(t *testing.T) {
+	t.Run("single statement", func(t *testing.T) {
+		s, err := parseStatements(aws.String(`{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRole", "Resource": "x"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(s) != 1 || s[0].Resource[0] != "x" {
+			t.Errorf("unexpected statements: %+v", s)
+		}
+	})
+
+	t.Run("encoded", func(t *testing.T) {
+		s, err := parseStatements(aws.String(`%7B%22Statement%22%3A%5B%7B%22Effect%22%3A%22Allow%22%7D%5D%7D`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(s) != 1 || s[0].Effect != "Allow" {
+			t.Errorf("unexpected statements: %+v", s)
+		}
+	})
+
+	t.Run("condition values", func(t *testing.T) {
+		s, err := parseStatements(aws.String(`{"Statement": [{"Effect": "Allow",
+             "Condition": {"Bool": {"aws:MultiFactorAuthPresent": true}, "NumericLessThan": {"aws:MultiFactorAuthAge": [3600]}}}]}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		c := s[0].Condition
+		if c["Bool"]["aws:MultiFactorAuthPresent"][0] != "true" || c["NumericLessThan"]["aws:MultiFactorAuthAge"][0] != "3600" {
+			t.Errorf("unexpected conditions: %+v", c)
+		}
+	})
+}
+
+func TestPolicyEvaluator(t *testing.T) {
+	doc := `{"Statement": [
+      {"Effect": "Allow", "Action": "sts:Assume*", "Resource": ["arn:aws:iam::*:role/ReadOnly", "arn:aws:iam::111111111111:role/Admin"]},
+      {"Effect": "Allow", "Action": "sts:AssumeRole", "Resource": "arn:aws:iam::111111111111:role/Dev",
+       "Condition": {"IpAddress": {"aws:SourceIp": ["10.0.0.0/8", "192.168.0.0/16"]}}},
+      {"Effect": "Allow", "NotAction": "s3:*", "Resource": "arn:aws:iam::222222222222:role/Ops"},
+      {"Effect": "Allow", "NotAction": "sts:*", "Resource": "arn:aws:iam::333333333333:role/Nope"},
+      {"Effect": "Deny", "Action": "sts:AssumeRole", "Resource": "arn:aws:iam::*:role/Admin",
+       "Condition": {"BoolIfExists": {"aws:MultiFactorAuthPresent": "false"}}},
+      {"Effect": "Deny", "Action": "sts:AssumeRole", "NotResource": "arn:aws:iam::*:role/*"},
+      {"Effect": "Deny", "Action": "*", "Resource": "arn:aws:iam::222222222222:role/ReadOnly"}
+    ]}`
+
+	s, err := parseStatements(&doc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	e := newPolicyEvaluator(s...)
+
+	t.Run("candidates", func(t *testing.T) {
+		r := Roles([]string{"arn:aws:iam::*:role/ReadOnly", "arn:aws:iam::111111111111:role/Admin",
+			"arn:aws:iam::111111111111:role/Dev", "arn:aws:iam::222222222222:role/Ops"}).Dedup()
+		if !reflect.DeepEqual(e.candidates(), r) {
+			t.Errorf("unexpected candidates: %v", e.candidates())
+		}
+	})
+
+	t.Run("unconditional", func(t *testing.T) {
+		ok, c := e.evaluate("arn:aws:iam::222222222222:role/Ops")
+		if !ok || len(c) > 0 {
+			t.Errorf("unexpected result: %v %v", ok, c)
+		}
+	})
+
+	t.Run("wildcard allow", func(t *testing.T) {
+		ok, _ := e.evaluate("arn:aws:iam::111111111111:role/ReadOnly")
+		if !ok {
+			t.Error("role not allowed")
+		}
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		if ok, _ := e.evaluate("arn:aws:iam::222222222222:role/ReadOnly"); ok {
+			t.Error("denied role was allowed")
+		}
+	})
+
+	t.Run("deny not resource", func(t *testing.T) {
+		if ok, _ := e.evaluate("arn:aws:iam::111111111111:user/ReadOnly"); ok {
+			t.Error("denied resource was allowed")
+		}
+	})
+
+	t.Run("not action", func(t *testing.T) {
+		if ok, _ := e.evaluate("arn:aws:iam::333333333333:role/Nope"); ok {
+			t.Error("role allowed by statement excluding the action")
+		}
+	})
+
+	t.Run("allow condition", func(t *testing.T) {
+		ok, c := e.evaluate("arn:aws:iam::111111111111:role/Dev")
+		if !ok || !reflect.DeepEqual(c, []string{"source IP 10.0.0.0/8,192.168.0.0/16"}) {
+			t.Errorf("unexpected result: %v %v", ok, c)
+		}
+	})
+
+	t.Run("deny condition", func(t *testing.T) {
+		ok, c := e.evaluate("arn:aws:iam::111111111111:role/Admin")
+		if !ok || !reflect.DeepEqual(c, []string{"MFA required"}) {
+			t.Errorf("unexpected result: %v %v", ok, c)
+		}
+	})
+}
+
+func TestExpandAccounts(t *testing.T) {
+	accts := []string{"111111111111", "222222222222", "333333333333"}
+
+	t.Run("wildcard", func(t *testing.T) {
+		r := expandAccounts("arn:aws:iam::*:role/ReadOnly", accts)
+		if len(r) != 3 || r[1] != "arn:aws:iam::222222222222:role/ReadOnly" {
+			t.Errorf("unexpected roles: %v", r)
+		}
+	})
+
+	t.Run("partial wildcard", func(t *testing.T) {
+		r := expandAccounts("arn:aws:iam::3*:role/ReadOnly", accts)
+		if len(r) != 1 || r[0] != "arn:aws:iam::333333333333:role/ReadOnly" {
+			t.Errorf("unexpected roles: %v", r)
+		}
+	})
+
+	t.Run("no wildcard", func(t *testing.T) {
+		r := expandAccounts("arn:aws:iam::123456789012:role/*", accts)
+		if len(r) != 1 || r[0] != "arn:aws:iam::123456789012:role/*" {
+			t.Errorf("unexpected roles: %v", r)
+		}
+	})
+
+	t.Run("not arn", func(t *testing.T) {
+		r := expandAccounts("*", accts)
+		if len(r) != 1 || r[0] != "*" {
+			t.Errorf("unexpected roles: %v", r)
+		}
+	})
+}
+
+func TestExpandRoles(t *testing.T) {
+	t.Run("wildcard account", func(t *testing.T) {
+		var calls int
+		r := expandRoles(Roles{"arn:aws:iam::*:role/ReadOnly", "arn:aws:iam::*:role/Admin"}, func() []string {
+			calls++
+			return []string{"111111111111"}
+		})
+
+		if calls != 1 || !reflect.DeepEqual(r, Roles{"arn:aws:iam::111111111111:role/Admin", "arn:aws:iam::111111111111:role/ReadOnly"}) {
+			t.Errorf("unexpected roles: %v (%d calls)", r, calls)
+		}
+	})
+
+	t.Run("role name wildcard", func(t *testing.T) {
+		r := expandRoles(Roles{"arn:aws:iam::123456789012:role/dev-*", "*", "arn:aws:iam::123456789012:role/Admin"},
+			func() []string {
+				t.Error("accounts listed without a wildcard account ID")
+				return nil
+			})
+
+		if !reflect.DeepEqual(r, Roles{"arn:aws:iam::123456789012:role/Admin"}) {
+			t.Errorf("unexpected roles: %v", r)
+		}
+	})
+}
+
+func TestConditionText(t *testing.T) {
+	t.Run("mfa", func(t *testing.T) {
+		if c := conditionText("Bool", "aws:MultiFactorAuthPresent", []string{"true"}, false); c != "MFA required" {
+			t.Errorf("unexpected condition: %s", c)
+		}
+	})
+
+	t.Run("mfa age", func(t *testing.T) {
+		if c := conditionText("NumericLessThanEquals", "aws:MultiFactorAuthAge", []string{"3600"}, false); c != "MFA within 3600s" {
+			t.Errorf("unexpected condition: %s", c)
+		}
+	})
+
+	t.Run("deny source ip", func(t *testing.T) {
+		if c := conditionText("NotIpAddress", "aws:SourceIp", []string{"10.0.0.0/8"}, true); c != "source IP 10.0.0.0/8" {
+			t.Errorf("unexpected condition: %s", c)
+		}
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		if c := conditionText("StringEquals", "aws:PrincipalTag/team", []string{"ops", "dev"}, false); c != "principal tag team=ops|dev" {
+			t.Errorf("unexpected condition: %s", c)
+		}
+	})
+
+	t.Run("deny tag", func(t *testing.T) {
+		if c := conditionText("StringNotEqualsIfExists", "iam:ResourceTag/env", []string{"prod"}, true); c != "role tag env=prod" {
+			t.Errorf("unexpected condition: %s", c)
+		}
+	})
+
+	t.Run("other", func(t *testing.T) {
+		if c := conditionText("ForAnyValue:StringLike", "aws:PrincipalOrgPaths", []string{"o-a/*"}, false); c != "aws:PrincipalOrgPaths StringLike o-a/*" {
+			t.Errorf("unexpected condition: %s", c)
+		}
+	})
+
+	t.Run("deny other", func(t *testing.T) {
+		if c := conditionText("DateGreaterThan", "aws:CurrentTime", []string{"2020-01-01T00:00:00Z"}, true); c != "denied if aws:CurrentTime DateGreaterThan 2020-01-01T00:00:00Z" {
+			t.Errorf("unexpected condition: %s", c)
+		}
+	})
+}
+
+func ExampleAssumableRole_String() {
+	r := &AssumableRole{Arn: "arn:aws:iam::123456789012:role/Admin", Conditions: []string{"MFA required", "source IP 10.0.0.0/8"}}
+	fmt.Println(r)
+	// Output:
+	// arn:aws:iam::123456789012:role/Admin (MFA required, source IP 10.0.0.0/8)
+}
@@ -0,0 +1,31 @@
+package util
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"time"
+)
+
+// retry calls f until it succeeds, returns an error which isn't an AWS API rate limit error, or has been retried
+// max times.  The wait before the first retry is delay, doubling for each later retry.
+func retry(max int, delay time.Duration, f func() error) error {
+	for n := 0; ; n++ {
+		err := f()
+		if err == nil || n >= max || !isThrottled(err) {
+			return err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isThrottled returns true if the error is an AWS API rate limit error
+func isThrottled(err error) bool {
+	if e, ok := err.(awserr.Error); ok {
+		switch e.Code() {
+		case "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequestsException":
+			return true
+		}
+	}
+	return false
+}
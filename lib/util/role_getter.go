@@ -6,11 +6,18 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/organizations/organizationsiface"
 	"github.com/mmmorris1975/simple-logger"
-	"net/url"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Roles is a container for IAM role ARN
@@ -43,14 +50,21 @@ type RoleGetter interface {
 
 // NewAwsRoleGetter creates a RoleGetter to retrieve AWS IAM roles for the specified user
 func NewAwsRoleGetter(c client.ConfigProvider, user string) *awsRoleGetter {
-	return &awsRoleGetter{client: c, user: user, wg: new(sync.WaitGroup)}
+	return &awsRoleGetter{client: c, user: user, concurrency: 4, maxRetries: 5, retryDelay: 500 * time.Millisecond}
 }
 
 type awsRoleGetter struct {
-	client client.ConfigProvider
-	wg     *sync.WaitGroup
-	user   string
-	log    aws.Logger
+	client      client.ConfigProvider
+	user        string
+	log         aws.Logger
+	accounts    []string
+	iam         iamiface.IAMAPI
+	org         organizationsiface.OrganizationsAPI
+	concurrency int
+	maxRetries  int
+	retryDelay  time.Duration
+	cacheFile   string
+	cacheTTL    time.Duration
 }
 
 // WithLogger configures a conforming Logger
@@ -59,25 +73,216 @@ func (r *awsRoleGetter) WithLogger(l aws.Logger) *awsRoleGetter {
 	return r
 }
 
-// Get the explicitly configured IAM roles from the user's IAM account
-// and groups, filtering out any roles which contain any wildcard characters.
-// Roles from inline and attached IAM polices are discovered.  Access to roles
-// which are implicitly granted (via policies like the AWS-managed administrator
-// or IAM full access) are not discovered by this method.
+// WithAccounts configures the list of AWS account IDs used to expand role ARNs with a wildcard in the account ID
+// field.  If no accounts are configured, the accounts are looked up using the AWS Organizations ListAccounts API.
+func (r *awsRoleGetter) WithAccounts(a []string) *awsRoleGetter {
+	r.accounts = a
+	return r
+}
+
+// WithCache configures the file used to cache the discovered roles for the ttl duration, so the IAM policies aren't
+// looked up each time.  Roles are only cached if all of the lookups succeeded.
+func (r *awsRoleGetter) WithCache(path string, ttl time.Duration) *awsRoleGetter {
+	r.cacheFile = path
+	r.cacheTTL = ttl
+	return r
+}
+
+// Get the IAM roles the user is allowed to assume, as role ARNs.  See AssumableRoles() for details.
 func (r *awsRoleGetter) Roles() Roles {
-	res := make([]string, 0)
-	ch := make(chan string, 8)
+	return r.AssumableRoles().Roles()
+}
+
+// AssumableRoles gets the IAM roles the user is allowed to assume, logging any error looking up the roles.
+// See FindRoles() for details.
+func (r *awsRoleGetter) AssumableRoles() AssumableRoles {
+	roles, err := r.FindRoles()
+	if e, ok := err.(RoleErrors); ok {
+		for _, v := range e {
+			r.error("%v", v)
+		}
+	}
+	return roles
+}
 
-	go r.roles(ch)
+// FindRoles gets the IAM roles the user is allowed to assume, by evaluating the sts:AssumeRole statements of
+// the inline and attached policies of the user's IAM account and groups.  Allow and Deny statements, and the NotAction
+// and NotResource elements, are honored.  A wildcard in the account ID field of a role ARN is expanded using the
+// configured account list, or the accounts of the AWS Organization, and any role still containing a wildcard is
+// filtered out, since that value can not be used as the role_arn of a profile.  The conditions of the statements
+// granting (or denying) access are described with each role.  Access to roles which are implicitly granted (via
+// policies like the AWS-managed administrator or IAM full access) are not discovered by this method.
+//
+// If any of the policy lookups fail, the roles which could be found are returned along with a RoleErrors error
+// describing each failure, since the list of roles may be incomplete.  An error listing the organization accounts is
+// only logged, and the roles with a wildcard account ID are skipped (and the roles are not cached).
+func (r *awsRoleGetter) FindRoles() (AssumableRoles, error) {
+	if roles := r.fetchCache(); roles != nil {
+		r.debug("Using cached roles from %s", r.cacheFile)
+		return roles, nil
+	}
 
-	for i := range ch {
-		if !strings.Contains(i, "*") {
-			res = append(res, i)
-			r.debug("Found role ARN: %s", i)
+	d := r.policies()
+
+	stmts := make([]*policyStatement, 0)
+	for _, doc := range d.docs {
+		s, err := parseStatements(doc)
+		if err != nil {
+			d.fail("parse policy document", "", err)
+			continue
+		}
+		stmts = append(stmts, s...)
+	}
+
+	// not being allowed to list the organization accounts only means the roles with a wildcard account ID are skipped,
+	// like any other role with a wildcard, so it's not a failure of the role lookup.  The roles aren't cached though,
+	// so a transient error doesn't hide those roles until the cache expires.
+	var accountsFailed bool
+	accounts := func() []string {
+		a, err := r.listAccounts()
+		if err != nil {
+			r.error("Error listing AWS Organizations accounts, roles with a wildcard account ID are skipped: %v", err)
+			accountsFailed = true
 		}
+		return a
+	}
+
+	e := newPolicyEvaluator(stmts...)
+	res := make(AssumableRoles, 0)
+	for _, v := range expandRoles(e.candidates(), accounts) {
+		if allowed, cond := e.evaluate(v); allowed {
+			r.debug("Found role ARN: %s %v", v, cond)
+			res = append(res, &AssumableRole{Arn: v, Conditions: cond})
+		}
+	}
+
+	if len(d.errs) > 0 {
+		return res, d.errs
+	}
+
+	if !accountsFailed {
+		r.storeCache(res)
+	}
+	return res, nil
+}
+
+// RoleError is the failure of a single IAM (or Organizations) API call made while looking up roles
+type RoleError struct {
+	// Op is the name of the API call, or other operation, which failed
+	Op string
+	// Name is the user, group, or policy the operation was for
+	Name string
+	Err  error
+}
+
+func (e *RoleError) Error() string {
+	if len(e.Name) > 0 {
+		return fmt.Sprintf("%s(%s): %v", e.Op, e.Name, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+// RoleErrors is the list of failures looking up roles
+type RoleErrors []*RoleError
+
+func (e RoleErrors) Error() string {
+	msg := make([]string, 0, len(e))
+	for _, v := range e {
+		msg = append(msg, v.Error())
+	}
+	return fmt.Sprintf("%d error(s) looking up roles, the role list may be incomplete: %s", len(e),
+		strings.Join(msg, "; "))
+}
+
+// discovery collects the policy documents, and any errors, from the workers looking up the user's policies
+type discovery struct {
+	mu   sync.Mutex
+	docs []*string
+	errs RoleErrors
+}
+
+func (d *discovery) add(doc *string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.docs = append(d.docs, doc)
+}
+
+func (d *discovery) fail(op, name string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errs = append(d.errs, &RoleError{Op: op, Name: name, Err: err})
+}
+
+// roleCache is the content of the role cache file
+type roleCache struct {
+	Expiration int64          `json:"expiration"`
+	Accounts   []string       `json:"accounts,omitempty"`
+	Roles      AssumableRoles `json:"roles"`
+}
+
+// fetchCache returns the cached roles, or nil if there's no cache, or the cache is expired or was built using a
+// different account list
+func (r *awsRoleGetter) fetchCache() AssumableRoles {
+	if len(r.cacheFile) < 1 {
+		return nil
 	}
 
-	return Roles(res).Dedup()
+	data, err := ioutil.ReadFile(r.cacheFile)
+	if err != nil {
+		return nil
+	}
+
+	c := new(roleCache)
+	if err := json.Unmarshal(data, c); err != nil {
+		r.debug("Error reading role cache: %v", err)
+		return nil
+	}
+
+	if time.Now().Unix() >= c.Expiration || !reflect.DeepEqual(c.Accounts, r.accounts) || c.Roles == nil {
+		return nil
+	}
+	return c.Roles
+}
+
+func (r *awsRoleGetter) storeCache(roles AssumableRoles) {
+	if len(r.cacheFile) < 1 || r.cacheTTL <= 0 {
+		return
+	}
+
+	data, err := json.Marshal(&roleCache{Expiration: time.Now().Add(r.cacheTTL).Unix(), Accounts: r.accounts, Roles: roles})
+	if err != nil {
+		r.debug("Error building role cache: %v", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.cacheFile), 0755); err == nil {
+		err = ioutil.WriteFile(r.cacheFile, data, 0600)
+	}
+
+	if err != nil {
+		r.debug("Error writing role cache: %v", err)
+	}
+}
+
+// listAccounts returns the configured account list, or the active accounts in the AWS Organization
+func (r *awsRoleGetter) listAccounts() ([]string, error) {
+	if len(r.accounts) > 0 {
+		return r.accounts, nil
+	}
+
+	c := r.org
+	if c == nil {
+		c = organizations.New(r.client)
+	}
+
+	var accounts []string
+	err := retry(r.maxRetries, r.retryDelay, func() (e error) {
+		accounts, e = organizationAccounts(c)
+		return e
+	})
+
+	r.debug("ACCOUNTS: %v", accounts)
+	return accounts, err
 }
 
 func (r *awsRoleGetter) debug(f string, v ...interface{}) {
@@ -97,262 +302,257 @@ func (r *awsRoleGetter) error(f string, v ...interface{}) {
 	}
 }
 
-func (r *awsRoleGetter) roles(ch chan<- string) {
-	defer close(ch)
-	c := iam.New(r.client)
+// policies looks up the policy documents of the user, and the user's groups.  The policies of the user and each
+// group are looked up by a pool of workers, limiting the number of concurrent IAM API calls.
+func (r *awsRoleGetter) policies() *discovery {
+	d := new(discovery)
+	c := r.iam
+	if c == nil {
+		c = iam.New(r.client)
+	}
 
-	r.wg.Add(2)
-	go r.inlineUserRoles(c, ch)
-	go r.attachedUserRoles(c, ch)
+	tasks := []func(){
+		func() { r.inlineUserRoles(c, d) },
+		func() { r.attachedUserRoles(c, d) },
+	}
 
 	i := iam.ListGroupsForUserInput{UserName: aws.String(r.user)}
-	truncated := true
-	for truncated {
-		g, err := c.ListGroupsForUser(&i)
+	for {
+		var g *iam.ListGroupsForUserOutput
+		err := retry(r.maxRetries, r.retryDelay, func() (e error) {
+			g, e = c.ListGroupsForUser(&i)
+			return e
+		})
 		if err != nil {
-			r.error("Error getting IAM Group list for %s: %v", r.user, err)
+			d.fail("ListGroupsForUser", r.user, err)
+			break
 		}
 
 		for _, grp := range g.Groups {
 			r.debug("GROUP: %s", *grp.GroupName)
-			r.wg.Add(2)
-			go r.inlineGroupRoles(c, grp.GroupName, ch)
-			go r.attachedGroupRoles(c, grp.GroupName, ch)
+			n := grp.GroupName
+			tasks = append(tasks, func() { r.inlineGroupRoles(c, n, d) }, func() { r.attachedGroupRoles(c, n, d) })
 		}
 
-		truncated = *g.IsTruncated
-		if truncated {
-			i.Marker = g.Marker
+		if !aws.BoolValue(g.IsTruncated) {
+			break
 		}
+		i.Marker = g.Marker
+	}
+
+	workers := r.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	ch := make(chan func())
+	wg := new(sync.WaitGroup)
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range ch {
+				t()
+			}
+		}()
+	}
+
+	for _, t := range tasks {
+		ch <- t
 	}
+	close(ch)
+	wg.Wait()
 
-	r.wg.Wait()
+	return d
 }
 
-func (r *awsRoleGetter) inlineUserRoles(c *iam.IAM, ch chan<- string) {
-	defer r.wg.Done()
+func (r *awsRoleGetter) inlineUserRoles(c iamiface.IAMAPI, d *discovery) {
 	listPolInput := iam.ListUserPoliciesInput{UserName: aws.String(r.user)}
 	getPolInput := iam.GetUserPolicyInput{UserName: aws.String(r.user)}
 
-	truncated := true
-	for truncated {
-		polList, err := c.ListUserPolicies(&listPolInput)
+	for {
+		var polList *iam.ListUserPoliciesOutput
+		err := retry(r.maxRetries, r.retryDelay, func() (e error) {
+			polList, e = c.ListUserPolicies(&listPolInput)
+			return e
+		})
 		if err != nil {
-			r.error("Error calling ListUserPolicies(): %v", err)
+			d.fail("ListUserPolicies", r.user, err)
 			break
 		}
 
 		for _, p := range polList.PolicyNames {
 			getPolInput.PolicyName = p
-			res, err := c.GetUserPolicy(&getPolInput)
-			if err != nil {
-				r.error("Error calling GetUserPolicy(): %v", err)
-				continue
-			}
 
-			roles, err := parsePolicy(res.PolicyDocument)
+			var res *iam.GetUserPolicyOutput
+			err := retry(r.maxRetries, r.retryDelay, func() (e error) {
+				res, e = c.GetUserPolicy(&getPolInput)
+				return e
+			})
 			if err != nil {
-				r.error("Error parsing policy document: %v", err)
+				d.fail("GetUserPolicy", *p, err)
 				continue
 			}
-
-			for _, v := range roles {
-				ch <- v
-			}
+			d.add(res.PolicyDocument)
 		}
 
-		truncated = *polList.IsTruncated
-		if truncated {
-			listPolInput.Marker = polList.Marker
+		if !aws.BoolValue(polList.IsTruncated) {
+			break
 		}
+		listPolInput.Marker = polList.Marker
 	}
 }
 
-func (r *awsRoleGetter) attachedUserRoles(c *iam.IAM, ch chan<- string) {
-	defer r.wg.Done()
+func (r *awsRoleGetter) attachedUserRoles(c iamiface.IAMAPI, d *discovery) {
 	listPolInput := iam.ListAttachedUserPoliciesInput{UserName: aws.String(r.user)}
 
-	truncated := true
-	for truncated {
-		polList, err := c.ListAttachedUserPolicies(&listPolInput)
+	for {
+		var polList *iam.ListAttachedUserPoliciesOutput
+		err := retry(r.maxRetries, r.retryDelay, func() (e error) {
+			polList, e = c.ListAttachedUserPolicies(&listPolInput)
+			return e
+		})
 		if err != nil {
-			r.error("Error calling ListAttachedUserPolicies(): %v", err)
+			d.fail("ListAttachedUserPolicies", r.user, err)
 			break
 		}
 
 		for _, p := range polList.AttachedPolicies {
-			getPolInput := iam.GetPolicyInput{PolicyArn: p.PolicyArn}
-			getPolRes, err := c.GetPolicy(&getPolInput)
-			if err != nil {
-				r.error("Error calling GetPolicy(): %v", err)
-				continue
-			}
-
-			getVerInput := iam.GetPolicyVersionInput{PolicyArn: getPolRes.Policy.Arn, VersionId: getPolRes.Policy.DefaultVersionId}
-			getVerRes, err := c.GetPolicyVersion(&getVerInput)
-			if err != nil {
-				r.error("Error calling GetPolicyVersion(): %v", err)
-				continue
-			}
-
-			roles, err := parsePolicy(getVerRes.PolicyVersion.Document)
-			if err != nil {
-				r.error("Error parsing policy document: %v", err)
-				continue
-			}
-
-			for _, v := range roles {
-				ch <- v
-			}
+			r.managedPolicy(c, p.PolicyArn, d)
 		}
 
-		truncated = *polList.IsTruncated
-		if truncated {
-			listPolInput.Marker = polList.Marker
+		if !aws.BoolValue(polList.IsTruncated) {
+			break
 		}
+		listPolInput.Marker = polList.Marker
 	}
 }
 
-func (r *awsRoleGetter) inlineGroupRoles(c *iam.IAM, g *string, ch chan<- string) {
-	defer r.wg.Done()
+func (r *awsRoleGetter) inlineGroupRoles(c iamiface.IAMAPI, g *string, d *discovery) {
 	listPolInput := iam.ListGroupPoliciesInput{GroupName: g}
 	getPolInput := iam.GetGroupPolicyInput{GroupName: g}
 
-	truncated := true
-	for truncated {
-		polList, err := c.ListGroupPolicies(&listPolInput)
+	for {
+		var polList *iam.ListGroupPoliciesOutput
+		err := retry(r.maxRetries, r.retryDelay, func() (e error) {
+			polList, e = c.ListGroupPolicies(&listPolInput)
+			return e
+		})
 		if err != nil {
-			r.error("Error calling ListGroupPolicies(): %v", err)
+			d.fail("ListGroupPolicies", *g, err)
 			break
 		}
 
 		for _, p := range polList.PolicyNames {
 			getPolInput.PolicyName = p
-			res, err := c.GetGroupPolicy(&getPolInput)
-			if err != nil {
-				r.error("Error calling GetGroupPolicy(): %v", err)
-				continue
-			}
 
-			roles, err := parsePolicy(res.PolicyDocument)
+			var res *iam.GetGroupPolicyOutput
+			err := retry(r.maxRetries, r.retryDelay, func() (e error) {
+				res, e = c.GetGroupPolicy(&getPolInput)
+				return e
+			})
 			if err != nil {
-				r.error("Error parsing policy document: %v", err)
+				d.fail("GetGroupPolicy", *p, err)
 				continue
 			}
-
-			for _, v := range roles {
-				ch <- v
-			}
+			d.add(res.PolicyDocument)
 		}
 
-		truncated = *polList.IsTruncated
-		if truncated {
-			listPolInput.Marker = polList.Marker
+		if !aws.BoolValue(polList.IsTruncated) {
+			break
 		}
+		listPolInput.Marker = polList.Marker
 	}
 }
 
-func (r *awsRoleGetter) attachedGroupRoles(c *iam.IAM, g *string, ch chan<- string) {
-	defer r.wg.Done()
+func (r *awsRoleGetter) attachedGroupRoles(c iamiface.IAMAPI, g *string, d *discovery) {
 	listPolInput := iam.ListAttachedGroupPoliciesInput{GroupName: g}
 
-	truncated := true
-	for truncated {
-		polList, err := c.ListAttachedGroupPolicies(&listPolInput)
+	for {
+		var polList *iam.ListAttachedGroupPoliciesOutput
+		err := retry(r.maxRetries, r.retryDelay, func() (e error) {
+			polList, e = c.ListAttachedGroupPolicies(&listPolInput)
+			return e
+		})
 		if err != nil {
-			r.error("Error calling ListAttachedGroupPolicies(): %v", err)
+			d.fail("ListAttachedGroupPolicies", *g, err)
 			break
 		}
 
 		for _, p := range polList.AttachedPolicies {
-			getPolInput := iam.GetPolicyInput{PolicyArn: p.PolicyArn}
-			getPolRes, err := c.GetPolicy(&getPolInput)
-			if err != nil {
-				r.error("Error calling GetPolicy(): %v", err)
-				continue
-			}
-
-			getVerInput := iam.GetPolicyVersionInput{PolicyArn: getPolRes.Policy.Arn, VersionId: getPolRes.Policy.DefaultVersionId}
-			getVerRes, err := c.GetPolicyVersion(&getVerInput)
-			if err != nil {
-				r.error("Error calling GetPolicyVersion(): %v", err)
-				continue
-			}
-
-			roles, err := parsePolicy(getVerRes.PolicyVersion.Document)
-			if err != nil {
-				r.error("Error parsing policy document: %v", err)
-				continue
-			}
-
-			for _, v := range roles {
-				ch <- v
-			}
+			r.managedPolicy(c, p.PolicyArn, d)
 		}
 
-		truncated = *polList.IsTruncated
-		if truncated {
-			listPolInput.Marker = polList.Marker
+		if !aws.BoolValue(polList.IsTruncated) {
+			break
 		}
+		listPolInput.Marker = polList.Marker
 	}
 }
 
-func parsePolicy(doc *string) (Roles, error) {
-	if doc == nil {
-		return nil, fmt.Errorf("nil policy doc")
+// managedPolicy looks up the document of the default version of the managed policy
+func (r *awsRoleGetter) managedPolicy(c iamiface.IAMAPI, arn *string, d *discovery) {
+	var getPolRes *iam.GetPolicyOutput
+	err := retry(r.maxRetries, r.retryDelay, func() (e error) {
+		getPolRes, e = c.GetPolicy(&iam.GetPolicyInput{PolicyArn: arn})
+		return e
+	})
+	if err != nil {
+		d.fail("GetPolicy", *arn, err)
+		return
 	}
-	polJson := make(map[string]interface{})
 
-	parsedDoc, err := url.QueryUnescape(*doc)
+	getVerInput := iam.GetPolicyVersionInput{PolicyArn: getPolRes.Policy.Arn, VersionId: getPolRes.Policy.DefaultVersionId}
+	var getVerRes *iam.GetPolicyVersionOutput
+	err = retry(r.maxRetries, r.retryDelay, func() (e error) {
+		getVerRes, e = c.GetPolicyVersion(&getVerInput)
+		return e
+	})
 	if err != nil {
-		return nil, err
+		d.fail("GetPolicyVersion", *arn, err)
+		return
 	}
-
-	json.Unmarshal([]byte(parsedDoc), &polJson)
-	roles := findRoles(polJson["Statement"])
-
-	return Roles(*roles), nil
+	d.add(getVerRes.PolicyVersion.Document)
 }
 
-func findRoles(data interface{}) *[]string {
-	roles := make([]string, 0)
+// organizationAccounts returns the IDs of the active accounts in the AWS Organization
+func organizationAccounts(c organizationsiface.OrganizationsAPI) ([]string, error) {
+	accounts := make([]string, 0)
 
-	switch t := data.(type) {
-	case []interface{}:
-		for _, v := range t {
-			roles = append(roles, *findRoles(v)...)
+	i := new(organizations.ListAccountsInput)
+	for {
+		o, err := c.ListAccounts(i)
+		if err != nil {
+			return accounts, err
 		}
-	case map[string]interface{}:
-		var isAssumeRole bool
-		assumeRoleAction := "sts:AssumeRole"
-
-		if t["Effect"] == "Allow" {
-			switch v := t["Action"].(type) {
-			case string:
-				if v == assumeRoleAction {
-					isAssumeRole = true
-				}
-			case []interface{}:
-				for _, val := range v {
-					if val == assumeRoleAction {
-						isAssumeRole = true
-					}
-				}
-			}
 
-			if isAssumeRole {
-				switch r := t["Resource"].(type) {
-				case string:
-					roles = append(roles, r)
-				case []interface{}:
-					// One would have hoped this was a []string, but the compiler says otherwise
-					for _, v := range r {
-						roles = append(roles, v.(string))
-					}
-				}
+		for _, a := range o.Accounts {
+			if a.Status == nil || *a.Status == organizations.AccountStatusActive {
+				accounts = append(accounts, *a.Id)
 			}
 		}
+
+		if o.NextToken == nil {
+			return accounts, nil
+		}
+		i.NextToken = o.NextToken
+	}
+}
+
+// parsePolicy returns the roles (which may contain wildcards) the policy doc allows assuming
+func parsePolicy(doc *string) (Roles, error) {
+	stmts, err := parseStatements(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	e := newPolicyEvaluator(stmts...)
+	roles := make([]string, 0)
+	for _, v := range e.candidates() {
+		if allowed, _ := e.evaluate(v); allowed {
+			roles = append(roles, v)
+		}
 	}
 
-	return &roles
+	return Roles(roles), nil
 }
@@ -3,11 +3,20 @@ package util
 import (
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/organizations/organizationsiface"
 	"github.com/mmmorris1975/simple-logger"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type MockRoleGetter struct {
@@ -144,6 +153,269 @@ func TestParsePolicy(t *testing.T) {
 	})
 }
 
+func TestAwsRoleGetter_AssumableRoles(t *testing.T) {
+	t.Run("configured accounts", func(t *testing.T) {
+		r := NewAwsRoleGetter(nil, "u").WithAccounts([]string{"111111111111", "222222222222"})
+		r.iam = new(mockIamClient)
+		r.org = &mockOrgClient{err: fmt.Errorf("organizations should not be called")}
+
+		roles := r.AssumableRoles()
+		if !reflect.DeepEqual(roles.Roles(), Roles([]string{"arn:aws:iam::111111111111:role/ReadOnly",
+			"arn:aws:iam::123456789012:role/Admin", "arn:aws:iam::222222222222:role/ReadOnly"})) {
+			t.Errorf("unexpected roles: %v", roles.Roles())
+			return
+		}
+
+		for _, v := range roles {
+			if v.Arn == "arn:aws:iam::123456789012:role/Admin" && v.String() != v.Arn+" (MFA required)" {
+				t.Errorf("unexpected conditions: %s", v)
+			}
+		}
+	})
+
+	t.Run("organization accounts", func(t *testing.T) {
+		r := NewAwsRoleGetter(nil, "u")
+		r.iam = new(mockIamClient)
+		r.org = &mockOrgClient{accounts: []string{"333333333333", "444444444444"}}
+
+		roles := r.Roles()
+		if !reflect.DeepEqual(roles, Roles([]string{"arn:aws:iam::123456789012:role/Admin",
+			"arn:aws:iam::333333333333:role/ReadOnly", "arn:aws:iam::444444444444:role/ReadOnly"})) {
+			t.Errorf("unexpected roles: %v", roles)
+		}
+	})
+
+	t.Run("organization error", func(t *testing.T) {
+		r := NewAwsRoleGetter(nil, "u")
+		r.iam = new(mockIamClient)
+		r.org = &mockOrgClient{err: fmt.Errorf("AccessDenied")}
+
+		roles := r.Roles()
+		if !reflect.DeepEqual(roles, Roles([]string{"arn:aws:iam::123456789012:role/Admin"})) {
+			t.Errorf("unexpected roles: %v", roles)
+		}
+	})
+}
+
+func TestAwsRoleGetter_FindRoles(t *testing.T) {
+	t.Run("group error", func(t *testing.T) {
+		r := NewAwsRoleGetter(nil, "u").WithAccounts([]string{"111111111111"})
+		r.iam = &mockIamClient{groupErr: awserr.New("AccessDenied", "not allowed", nil)}
+
+		roles, err := r.FindRoles()
+		if err == nil {
+			t.Error("did not see expected error")
+			return
+		}
+
+		e, ok := err.(RoleErrors)
+		if !ok || len(e) != 1 || e[0].Op != "ListGroupsForUser" || e[0].Name != "u" {
+			t.Errorf("unexpected error: %v", err)
+			return
+		}
+
+		// the roles from the user policies are still found, without the group policy MFA condition
+		if len(roles) != 2 || roles[1].Arn != "arn:aws:iam::123456789012:role/Admin" || len(roles[1].Conditions) > 0 {
+			t.Errorf("unexpected roles: %v", roles.Roles())
+		}
+	})
+
+	t.Run("throttled", func(t *testing.T) {
+		r := NewAwsRoleGetter(nil, "u").WithAccounts([]string{"111111111111"})
+		r.retryDelay = 1 * time.Millisecond
+		r.iam = &mockIamClient{throttle: 2}
+
+		roles, err := r.FindRoles()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(roles) != 2 {
+			t.Errorf("unexpected roles: %v", roles.Roles())
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		r := NewAwsRoleGetter(nil, "u").WithAccounts([]string{"111111111111"})
+		r.maxRetries = 1
+		r.retryDelay = 1 * time.Millisecond
+		r.iam = &mockIamClient{throttle: 5}
+
+		_, err := r.FindRoles()
+		if e, ok := err.(RoleErrors); !ok || len(e) != 1 || e[0].Op != "GetUserPolicy" {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("organizations error", func(t *testing.T) {
+		r := NewAwsRoleGetter(nil, "u")
+		r.iam = new(mockIamClient)
+		r.org = &mockOrgClient{err: awserr.New("AccessDenied", "not allowed", nil)}
+
+		// roles with a wildcard account ID are skipped, the other roles are complete
+		roles, err := r.FindRoles()
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			return
+		}
+
+		if !reflect.DeepEqual(roles.Roles(), Roles([]string{"arn:aws:iam::123456789012:role/Admin"})) {
+			t.Errorf("unexpected roles: %v", roles.Roles())
+		}
+	})
+
+	t.Run("role name wildcard", func(t *testing.T) {
+		o := &mockOrgClient{err: awserr.New("AccessDenied", "not allowed", nil)}
+		r := NewAwsRoleGetter(nil, "u")
+		r.iam = &mockIamClient{userDoc: `{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRole",
+      "Resource": ["arn:aws:iam::123456789012:role/dev-*", "*", "arn:aws:iam::123456789012:role/Admin"]}}`}
+		r.org = o
+
+		roles, err := r.FindRoles()
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			return
+		}
+
+		if o.calls > 0 {
+			t.Error("organization accounts listed without a wildcard account ID")
+		}
+
+		if !reflect.DeepEqual(roles.Roles(), Roles([]string{"arn:aws:iam::123456789012:role/Admin"})) {
+			t.Errorf("unexpected roles: %v", roles.Roles())
+		}
+	})
+
+	t.Run("bounded workers", func(t *testing.T) {
+		m := &mockIamClient{groups: 10}
+		r := NewAwsRoleGetter(nil, "u").WithAccounts([]string{"111111111111"})
+		r.concurrency = 2
+		r.iam = m
+
+		if _, err := r.FindRoles(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if m.maxActive < 1 || m.maxActive > 2 {
+			t.Errorf("unexpected concurrent calls: %d", m.maxActive)
+		}
+	})
+}
+
+func TestAwsRoleGetter_Cache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "role-cache")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	f := filepath.Join(dir, "roles")
+
+	t.Run("store", func(t *testing.T) {
+		m := new(mockIamClient)
+		r := NewAwsRoleGetter(nil, "u").WithAccounts([]string{"111111111111"}).WithCache(f, 1*time.Minute)
+		r.iam = m
+
+		if _, err := r.FindRoles(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("cache file not written: %v", err)
+		}
+	})
+
+	t.Run("fetch", func(t *testing.T) {
+		m := new(mockIamClient)
+		r := NewAwsRoleGetter(nil, "u").WithAccounts([]string{"111111111111"}).WithCache(f, 1*time.Minute)
+		r.iam = m
+
+		roles, err := r.FindRoles()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if m.calls > 0 {
+			t.Error("IAM called with cached roles")
+		}
+
+		if len(roles) != 2 || roles[1].String() != "arn:aws:iam::123456789012:role/Admin (MFA required)" {
+			t.Errorf("unexpected roles: %v", roles.Roles())
+		}
+	})
+
+	t.Run("different accounts", func(t *testing.T) {
+		m := new(mockIamClient)
+		r := NewAwsRoleGetter(nil, "u").WithAccounts([]string{"222222222222"}).WithCache(f, 1*time.Minute)
+		r.iam = m
+
+		if _, err := r.FindRoles(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if m.calls < 1 {
+			t.Error("cached roles used for a different account list")
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		if err := ioutil.WriteFile(f, []byte(`{"expiration": 1, "roles": []}`), 0600); err != nil {
+			t.Error(err)
+			return
+		}
+
+		m := new(mockIamClient)
+		r := NewAwsRoleGetter(nil, "u").WithCache(f, 1*time.Minute)
+		r.iam = m
+		r.org = &mockOrgClient{accounts: []string{"111111111111"}}
+
+		if _, err := r.FindRoles(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if m.calls < 1 {
+			t.Error("expired cache used")
+		}
+	})
+
+	t.Run("not stored without organization accounts", func(t *testing.T) {
+		os.Remove(f)
+		r := NewAwsRoleGetter(nil, "u").WithCache(f, 1*time.Minute)
+		r.iam = new(mockIamClient)
+		r.org = &mockOrgClient{err: fmt.Errorf("Throttling")}
+
+		if _, err := r.FindRoles(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if _, err := os.Stat(f); err == nil {
+			t.Error("roles cached without the wildcard account roles")
+		}
+	})
+
+	t.Run("not stored with errors", func(t *testing.T) {
+		os.Remove(f)
+		r := NewAwsRoleGetter(nil, "u").WithAccounts([]string{"111111111111"}).WithCache(f, 1*time.Minute)
+		r.iam = &mockIamClient{groupErr: fmt.Errorf("error")}
+
+		if _, err := r.FindRoles(); err == nil {
+			t.Error("did not see expected error")
+			return
+		}
+
+		if _, err := os.Stat(f); err == nil {
+			t.Error("partial results were cached")
+		}
+	})
+}
+
 func Example_debugNilClient() {
 	r := NewAwsRoleGetter(nil, "u")
 	r.debug("test")
@@ -199,3 +471,105 @@ func Example_errorSimpleLogger() {
 	// Output:
 	// ERROR test
 }
+
+type mockIamClient struct {
+	iamiface.IAMAPI
+	groups    int
+	groupErr  error
+	userDoc   string
+	throttle  int32
+	calls     int32
+	active    int32
+	maxActive int32
+}
+
+func (m *mockIamClient) ListGroupsForUser(*iam.ListGroupsForUserInput) (*iam.ListGroupsForUserOutput, error) {
+	atomic.AddInt32(&m.calls, 1)
+	if m.groupErr != nil {
+		return nil, m.groupErr
+	}
+
+	g := []*iam.Group{{GroupName: aws.String("g")}}
+	for i := 1; i < m.groups; i++ {
+		g = append(g, &iam.Group{GroupName: aws.String(fmt.Sprintf("g%d", i))})
+	}
+	return &iam.ListGroupsForUserOutput{Groups: g, IsTruncated: aws.Bool(false)}, nil
+}
+
+func (m *mockIamClient) ListUserPolicies(*iam.ListUserPoliciesInput) (*iam.ListUserPoliciesOutput, error) {
+	return &iam.ListUserPoliciesOutput{PolicyNames: []*string{aws.String("p")}, IsTruncated: aws.Bool(false)}, nil
+}
+
+func (m *mockIamClient) GetUserPolicy(*iam.GetUserPolicyInput) (*iam.GetUserPolicyOutput, error) {
+	if atomic.AddInt32(&m.throttle, -1) >= 0 {
+		return nil, awserr.New("Throttling", "Rate exceeded", nil)
+	}
+
+	doc := `{"Statement": [{"Effect": "Allow", "Action": "sts:AssumeRole",
+      "Resource": ["arn:aws:iam::*:role/ReadOnly", "arn:aws:iam::*:role/*", "arn:aws:iam::123456789012:role/Admin"]}]}`
+	if len(m.userDoc) > 0 {
+		doc = m.userDoc
+	}
+	return &iam.GetUserPolicyOutput{PolicyDocument: aws.String(doc)}, nil
+}
+
+func (m *mockIamClient) ListAttachedUserPolicies(*iam.ListAttachedUserPoliciesInput) (*iam.ListAttachedUserPoliciesOutput, error) {
+	return &iam.ListAttachedUserPoliciesOutput{IsTruncated: aws.Bool(false)}, nil
+}
+
+func (m *mockIamClient) ListGroupPolicies(*iam.ListGroupPoliciesInput) (*iam.ListGroupPoliciesOutput, error) {
+	a := atomic.AddInt32(&m.active, 1)
+	defer atomic.AddInt32(&m.active, -1)
+	for {
+		max := atomic.LoadInt32(&m.maxActive)
+		if a <= max || atomic.CompareAndSwapInt32(&m.maxActive, max, a) {
+			break
+		}
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	return &iam.ListGroupPoliciesOutput{IsTruncated: aws.Bool(false)}, nil
+}
+
+func (m *mockIamClient) ListAttachedGroupPolicies(*iam.ListAttachedGroupPoliciesInput) (*iam.ListAttachedGroupPoliciesOutput, error) {
+	p := &iam.AttachedPolicy{PolicyArn: aws.String("arn:aws:iam::123456789012:policy/mfa")}
+	return &iam.ListAttachedGroupPoliciesOutput{AttachedPolicies: []*iam.AttachedPolicy{p}, IsTruncated: aws.Bool(false)}, nil
+}
+
+func (m *mockIamClient) GetPolicy(i *iam.GetPolicyInput) (*iam.GetPolicyOutput, error) {
+	return &iam.GetPolicyOutput{Policy: &iam.Policy{Arn: i.PolicyArn, DefaultVersionId: aws.String("v1")}}, nil
+}
+
+func (m *mockIamClient) GetPolicyVersion(*iam.GetPolicyVersionInput) (*iam.GetPolicyVersionOutput, error) {
+	doc := `{"Statement": {"Effect": "Deny", "Action": "sts:AssumeRole", "Resource": "arn:aws:iam::*:role/Admin",
+      "Condition": {"BoolIfExists": {"aws:MultiFactorAuthPresent": false}}}}`
+	return &iam.GetPolicyVersionOutput{PolicyVersion: &iam.PolicyVersion{Document: aws.String(doc)}}, nil
+}
+
+type mockOrgClient struct {
+	organizationsiface.OrganizationsAPI
+	accounts []string
+	err      error
+	calls    int
+}
+
+func (m *mockOrgClient) ListAccounts(i *organizations.ListAccountsInput) (*organizations.ListAccountsOutput, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	// return 1 account per page, plus a suspended account which must be skipped
+	o := &organizations.ListAccountsOutput{Accounts: []*organizations.Account{
+		{Id: aws.String("999999999999"), Status: aws.String("SUSPENDED")}}}
+	n := 0
+	if i.NextToken != nil {
+		fmt.Sscan(*i.NextToken, &n)
+	}
+
+	o.Accounts = append(o.Accounts, &organizations.Account{Id: aws.String(m.accounts[n]), Status: aws.String(organizations.AccountStatusActive)})
+	if n+1 < len(m.accounts) {
+		o.NextToken = aws.String(fmt.Sprint(n + 1))
+	}
+	return o, nil
+}
@@ -0,0 +1,244 @@
+package util
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/organizations/organizationsiface"
+	"github.com/mmmorris1975/simple-logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The decisions reported for a simulated role.  The allowed, explicitDeny and implicitDeny values are the
+// EvalDecision values of the IAM SimulatePrincipalPolicy API, and error is used if the role could not be simulated.
+const (
+	DecisionAllowed      = "allowed"
+	DecisionExplicitDeny = "explicitDeny"
+	DecisionImplicitDeny = "implicitDeny"
+	DecisionError        = "error"
+)
+
+// SimulatedRole is the result of the IAM policy simulation of the sts:AssumeRole action for a single role
+type SimulatedRole struct {
+	Arn      string
+	Decision string
+	Error    error
+}
+
+// SimulatedRoles is a container for SimulatedRole
+type SimulatedRoles []*SimulatedRole
+
+// Allowed returns the sorted set of role ARNs the simulation allowed the user to assume
+func (r SimulatedRoles) Allowed() Roles {
+	roles := make([]string, 0)
+	for _, v := range r {
+		if v.Decision == DecisionAllowed {
+			roles = append(roles, v.Arn)
+		}
+	}
+	return Roles(roles).Dedup()
+}
+
+// RoleSimulator finds the roles a principal is able to assume by running the IAM policy simulator for the
+// sts:AssumeRole action against a list of candidate roles.  Unlike evaluating the principal's policies directly, the
+// simulation accounts for permission boundaries and policies which grant access implicitly, like the AWS-managed
+// administrator policy.
+type RoleSimulator struct {
+	// BatchSize is the number of roles sent in each SimulatePrincipalPolicy request
+	BatchSize int
+	// Concurrency is the maximum number of SimulatePrincipalPolicy requests run at the same time
+	Concurrency int
+	// MaxRetries is the number of times a throttled request is retried, before the roles in the batch are reported
+	// with the error decision
+	MaxRetries int
+	// RetryDelay is the wait before retrying the first throttled request, doubling for each later retry
+	RetryDelay time.Duration
+	// Accounts is the list of AWS account IDs used to expand role ARNs with a wildcard in the account ID field.  If
+	// not set, the accounts are looked up using the AWS Organizations ListAccounts API.
+	Accounts []string
+
+	client    client.ConfigProvider
+	principal string
+	log       aws.Logger
+	iam       iamiface.IAMAPI
+	org       organizationsiface.OrganizationsAPI
+}
+
+// NewRoleSimulator creates a RoleSimulator for the IAM user or role with the principal ARN.  A list of options
+// can be provided to override the default batch size, concurrency and retry settings, or set the Accounts list.
+func NewRoleSimulator(c client.ConfigProvider, principal string, options ...func(*RoleSimulator)) *RoleSimulator {
+	s := &RoleSimulator{client: c, principal: principal, BatchSize: 25, Concurrency: 4, MaxRetries: 5,
+		RetryDelay: 500 * time.Millisecond}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
+
+// WithLogger configures a conforming Logger
+func (s *RoleSimulator) WithLogger(l aws.Logger) *RoleSimulator {
+	s.log = l
+	return s
+}
+
+// Simulate runs the policy simulation for the candidate roles, returning the result for each role sorted by ARN.
+// A wildcard in the account ID field of a candidate role ARN is expanded to the matching accounts, and any role which
+// still contains a wildcard is skipped.
+func (s *RoleSimulator) Simulate(candidates Roles) SimulatedRoles {
+	roles := expandRoles(candidates.Dedup(), s.listAccounts)
+
+	c := s.iam
+	if c == nil {
+		c = iam.New(s.client)
+	}
+
+	size := s.BatchSize
+	if size < 1 {
+		size = 1
+	}
+
+	workers := s.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	batches := make(chan Roles, workers)
+	go func() {
+		defer close(batches)
+		for i := 0; i < len(roles); i += size {
+			end := i + size
+			if end > len(roles) {
+				end = len(roles)
+			}
+			batches <- roles[i:end]
+		}
+	}()
+
+	res := make(SimulatedRoles, 0, len(roles))
+	mu := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				r := s.simulateBatch(c, b)
+				mu.Lock()
+				res = append(res, r...)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Arn < res[j].Arn })
+	return res
+}
+
+// simulateBatch runs the policy simulation for a batch of roles, retrying any throttled request
+func (s *RoleSimulator) simulateBatch(c iamiface.IAMAPI, roles Roles) SimulatedRoles {
+	decisions := make(map[string]string)
+
+	i := &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(s.principal),
+		ActionNames:     []*string{aws.String(assumeRoleAction)},
+		ResourceArns:    aws.StringSlice(roles),
+	}
+
+	var err error
+	for {
+		var o *iam.SimulatePolicyResponse
+		if o, err = s.simulate(c, i); err != nil {
+			s.error("Error simulating IAM policy: %v", err)
+			break
+		}
+
+		for _, r := range o.EvaluationResults {
+			if r.EvalResourceName != nil && r.EvalDecision != nil {
+				decisions[*r.EvalResourceName] = *r.EvalDecision
+			}
+		}
+
+		if !aws.BoolValue(o.IsTruncated) {
+			break
+		}
+		i.Marker = o.Marker
+	}
+
+	res := make(SimulatedRoles, 0, len(roles))
+	for _, r := range roles {
+		sr := &SimulatedRole{Arn: r, Decision: decisions[r]}
+		if len(sr.Decision) < 1 {
+			sr.Decision = DecisionError
+			sr.Error = err
+			if sr.Error == nil {
+				sr.Error = fmt.Errorf("no simulation result for role")
+			}
+		}
+
+		s.debug("SIMULATED ROLE: %s %s", sr.Arn, sr.Decision)
+		res = append(res, sr)
+	}
+	return res
+}
+
+// simulate calls SimulatePrincipalPolicy, waiting and retrying the request if it's throttled
+func (s *RoleSimulator) simulate(c iamiface.IAMAPI, i *iam.SimulatePrincipalPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	var o *iam.SimulatePolicyResponse
+	err := retry(s.MaxRetries, s.RetryDelay, func() (e error) {
+		if o, e = c.SimulatePrincipalPolicy(i); isThrottled(e) {
+			s.debug("SimulatePrincipalPolicy throttled: %v", e)
+		}
+		return e
+	})
+	return o, err
+}
+
+// listAccounts returns the configured account list, or the active accounts in the AWS Organization
+func (s *RoleSimulator) listAccounts() []string {
+	if len(s.Accounts) > 0 {
+		return s.Accounts
+	}
+
+	c := s.org
+	if c == nil {
+		c = organizations.New(s.client)
+	}
+
+	var accounts []string
+	err := retry(s.MaxRetries, s.RetryDelay, func() (e error) {
+		accounts, e = organizationAccounts(c)
+		return e
+	})
+	if err != nil {
+		s.error("Error listing AWS Organizations accounts, roles with a wildcard account ID are skipped: %v", err)
+	}
+
+	s.debug("ACCOUNTS: %v", accounts)
+	return accounts
+}
+
+func (s *RoleSimulator) debug(f string, v ...interface{}) {
+	if s.client != nil && s.client.ClientConfig("iam").Config.LogLevel.AtLeast(aws.LogDebug) && s.log != nil {
+		s.log.Log(fmt.Sprintf(f, v...))
+	}
+}
+
+func (s *RoleSimulator) error(f string, v ...interface{}) {
+	switch t := s.log.(type) {
+	case *simple_logger.Logger:
+		t.Errorf(f, v...)
+	default:
+		if t != nil {
+			t.Log(fmt.Sprintf(f, v...))
+		}
+	}
+}
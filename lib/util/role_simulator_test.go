@@ -0,0 +1,166 @@
+package util
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRoleSimulator_Simulate(t *testing.T) {
+	roles := Roles([]string{
+		"arn:aws:iam::111111111111:role/Admin",
+		"arn:aws:iam::111111111111:role/Deny",
+		"arn:aws:iam::111111111111:role/Other",
+		"arn:aws:iam::*:role/ReadOnly",
+		"arn:aws:iam::111111111111:role/*",
+	})
+
+	t.Run("decisions", func(t *testing.T) {
+		m := new(mockSimulatorClient)
+		s := NewRoleSimulator(nil, "arn:aws:iam::111111111111:user/u", func(s *RoleSimulator) {
+			s.BatchSize = 2
+			s.Concurrency = 2
+			s.Accounts = []string{"111111111111", "222222222222"}
+		})
+		s.iam = m
+
+		res := s.Simulate(roles)
+		if len(res) != 5 {
+			t.Errorf("unexpected result count: %d", len(res))
+			return
+		}
+
+		d := make(map[string]string)
+		for _, r := range res {
+			d[r.Arn] = r.Decision
+		}
+
+		if d["arn:aws:iam::111111111111:role/Admin"] != DecisionAllowed || d["arn:aws:iam::111111111111:role/Deny"] != DecisionExplicitDeny ||
+			d["arn:aws:iam::111111111111:role/Other"] != DecisionImplicitDeny || d["arn:aws:iam::222222222222:role/ReadOnly"] != DecisionAllowed {
+			t.Errorf("unexpected decisions: %v", d)
+		}
+
+		if !reflect.DeepEqual(res.Allowed(), Roles([]string{"arn:aws:iam::111111111111:role/Admin",
+			"arn:aws:iam::111111111111:role/ReadOnly", "arn:aws:iam::222222222222:role/ReadOnly"})) {
+			t.Errorf("unexpected allowed roles: %v", res.Allowed())
+		}
+
+		if m.maxActive > 2 {
+			t.Errorf("concurrency limit exceeded: %d", m.maxActive)
+		}
+	})
+
+	t.Run("throttled", func(t *testing.T) {
+		m := &mockSimulatorClient{throttle: 2}
+		s := NewRoleSimulator(nil, "arn:aws:iam::111111111111:user/u", func(s *RoleSimulator) {
+			s.RetryDelay = 1 * time.Millisecond
+		})
+		s.iam = m
+
+		res := s.Simulate(Roles([]string{"arn:aws:iam::111111111111:role/Admin"}))
+		if len(res) != 1 || res[0].Decision != DecisionAllowed {
+			t.Errorf("unexpected result: %+v", res[0])
+			return
+		}
+
+		if m.calls != 3 {
+			t.Errorf("unexpected call count: %d", m.calls)
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		m := &mockSimulatorClient{throttle: 10}
+		s := NewRoleSimulator(nil, "arn:aws:iam::111111111111:user/u", func(s *RoleSimulator) {
+			s.MaxRetries = 1
+			s.RetryDelay = 1 * time.Millisecond
+		})
+		s.iam = m
+
+		res := s.Simulate(Roles([]string{"arn:aws:iam::111111111111:role/Admin"}))
+		if len(res) != 1 || res[0].Decision != DecisionError || res[0].Error == nil {
+			t.Errorf("unexpected result: %+v", res[0])
+			return
+		}
+
+		if m.calls != 2 {
+			t.Errorf("unexpected call count: %d", m.calls)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		m := &mockSimulatorClient{err: awserr.New("AccessDenied", "not allowed", nil)}
+		s := NewRoleSimulator(nil, "arn:aws:iam::111111111111:user/u")
+		s.iam = m
+
+		res := s.Simulate(Roles([]string{"arn:aws:iam::111111111111:role/Admin"}))
+		if len(res) != 1 || res[0].Decision != DecisionError || m.calls != 1 {
+			t.Errorf("unexpected result: %+v", res[0])
+		}
+	})
+}
+
+// mockSimulatorClient allows roles named Admin or ReadOnly, explicitly denies roles named Deny, and implicitly
+// denies all other roles.  Results are returned 1 role per page, to exercise pagination.
+type mockSimulatorClient struct {
+	iamiface.IAMAPI
+	throttle  int32
+	err       error
+	calls     int32
+	active    int32
+	maxActive int32
+	mu        sync.Mutex
+}
+
+func (m *mockSimulatorClient) SimulatePrincipalPolicy(i *iam.SimulatePrincipalPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	n := atomic.AddInt32(&m.calls, 1)
+
+	a := atomic.AddInt32(&m.active, 1)
+	defer atomic.AddInt32(&m.active, -1)
+	m.mu.Lock()
+	if a > m.maxActive {
+		m.maxActive = a
+	}
+	m.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if n <= m.throttle {
+		return nil, awserr.New("Throttling", "Rate exceeded", nil)
+	}
+
+	if len(i.ActionNames) != 1 || *i.ActionNames[0] != "sts:AssumeRole" {
+		return nil, fmt.Errorf("invalid action names")
+	}
+
+	idx := 0
+	if i.Marker != nil {
+		fmt.Sscan(*i.Marker, &idx)
+	}
+
+	r := *i.ResourceArns[idx]
+	d := DecisionImplicitDeny
+	switch {
+	case strings.HasSuffix(r, "/Admin"), strings.HasSuffix(r, "/ReadOnly"):
+		d = DecisionAllowed
+	case strings.HasSuffix(r, "/Deny"):
+		d = DecisionExplicitDeny
+	}
+
+	o := &iam.SimulatePolicyResponse{IsTruncated: aws.Bool(idx+1 < len(i.ResourceArns)),
+		EvaluationResults: []*iam.EvaluationResult{{EvalResourceName: aws.String(r), EvalDecision: aws.String(d)}}}
+	if *o.IsTruncated {
+		o.Marker = aws.String(fmt.Sprint(idx + 1))
+	}
+	return o, nil
+}
@@ -15,8 +15,11 @@ import (
 	"github.com/mmmorris1975/aws-runas/lib/config"
 	credlib "github.com/mmmorris1975/aws-runas/lib/credentials"
 	"github.com/mmmorris1975/aws-runas/lib/metadata"
+	"github.com/mmmorris1975/aws-runas/lib/saml"
+	"github.com/mmmorris1975/aws-runas/lib/sso"
 	"github.com/mmmorris1975/aws-runas/lib/util"
 	"github.com/mmmorris1975/simple-logger"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -28,8 +31,14 @@ import (
 )
 
 const (
-	assumeRoleCachePrefix   = ".aws_assume_role"
-	sessionTokenCachePrefix = ".aws_session_token"
+	assumeRoleCachePrefix   = cache.AssumeRoleFilePrefix
+	sessionTokenCachePrefix = cache.SessionTokenFilePrefix
+	roleCachePrefix         = ".aws_runas_roles"
+	aliasCachePrefix        = ".aws_runas_account_aliases"
+	// how long the roles found in the IAM policies of the user are cached
+	roleCacheTTL = 1 * time.Hour
+	// how long the account aliases looked up using the roles of each account are cached
+	aliasCacheTTL = 24 * time.Hour
 )
 
 var (
@@ -43,14 +52,31 @@ var (
 	updateFlag   *bool
 	diagFlag     *bool
 	ec2MdFlag    *bool
+	ecsMdFlag    *bool
+	imdsV2Flag   *bool
 	profile      *string
 	mfaArn       *string
+	confType     *string
+	writeConf    *bool
+	dryRun       *bool
+	listCache    *bool
+	purgeCache   *string
+	listFormat   *string
+	outputFormat *string
+	credProcess  *bool
+	agentFlag    *bool
+	autoRefresh  *bool
+	agentFgFlag  *bool
+	simulateFlag *bool
+	roleFile     *string
 	duration     *time.Duration
 	roleDuration *time.Duration
 	cmd          *[]string
 	ses          *session.Session
 	cfg          *config.AwsConfig
 	usr          *credlib.AwsIdentity
+	samlIdp      saml.Client
+	ssoIdp       *sso.Client
 
 	sigCh = make(chan os.Signal, 3)
 	log   = simple_logger.StdLogger
@@ -71,17 +97,45 @@ func init() {
 		cmdArgDesc          = "command to execute using configured profile"
 		mfaArnDesc          = "ARN of MFA device needed to perform Assume Role operation"
 		makeConfArgDesc     = "Build an AWS extended switch-role plugin configuration for all available roles"
+		confTypeArgDesc     = "type of configuration built by --make-conf, 'plugin' (switch-role plugin) or 'aws' (~/.aws/config profiles)"
+		writeConfArgDesc    = "Add profiles for all available roles to the ~/.aws/config file"
+		dryRunArgDesc       = "show the changes --write-conf would make to the config file, without updating the file"
+		listCacheArgDesc    = "list the cached credentials, and their expiration"
+		purgeCacheArgDesc   = "remove cached credentials which are 'expired', 'all' cached credentials, or the credentials for the named profile"
+		listFormatArgDesc   = "output format for --list-cache or --list-roles, 'table' or 'json'"
+		credProcArgDesc     = "print credentials as the JSON document used by the credential_process attribute in the ~/.aws/config file"
+		outputArgDesc       = "format of the printed credentials: auto, sh, fish, powershell, env, json (credential_process), or credentials (~/.aws/credentials)"
 		updateArgDesc       = "Check for updates to aws-runas"
 		diagArgDesc         = "Run diagnostics to gather info to troubleshoot issues"
 		ec2ArgDesc          = "Run as mock EC2 metadata service to provide role credentials"
+		ecsArgDesc          = "Run as ECS container credential service to provide role credentials, without needing admin privileges"
+		imdsV2ArgDesc       = "Require IMDSv2 session tokens for requests to the --ec2 metadata service"
+		agentArgDesc        = "Start the credential agent in the background, and print the environment variables to use it"
+		agentFgArgDesc      = "Run the credential agent in the foreground"
+		autoRefreshArgDesc  = "provide credentials to the command from a local endpoint, which refreshes them while the command runs"
+		simulateArgDesc     = "find the roles for --list-roles, --make-conf and --write-conf using the IAM policy simulator"
+		roleFileArgDesc     = "file of candidate role ARNs (or role names) checked by --simulate"
 	)
 
 	duration = kingpin.Flag("duration", durationArgDesc).Short('d').Duration()
 	roleDuration = kingpin.Flag("role-duration", roleDurationArgDesc).Short('a').Duration()
 	listRoles = kingpin.Flag("list-roles", listRoleArgDesc).Short('l').Bool()
+	simulateFlag = kingpin.Flag("simulate", simulateArgDesc).Bool()
+	roleFile = kingpin.Flag("role-file", roleFileArgDesc).PlaceHolder("FILE").String()
 	listMfa = kingpin.Flag("list-mfa", listMfaArgDesc).Short('m').Bool()
 	showExpire = kingpin.Flag("expiration", showExpArgDesc).Short('e').Bool()
 	makeConf = kingpin.Flag("make-conf", makeConfArgDesc).Short('c').Bool()
+	confType = kingpin.Flag("conf-type", confTypeArgDesc).Default("plugin").Enum("plugin", "aws")
+	writeConf = kingpin.Flag("write-conf", writeConfArgDesc).Bool()
+	dryRun = kingpin.Flag("dry-run", dryRunArgDesc).Bool()
+	listCache = kingpin.Flag("list-cache", listCacheArgDesc).Bool()
+	purgeCache = kingpin.Flag("purge-cache", purgeCacheArgDesc).PlaceHolder("expired|all|PROFILE").String()
+	listFormat = kingpin.Flag("list-format", listFormatArgDesc).PlaceHolder("table").Enum("table", "json")
+	outputFormat = kingpin.Flag("output", outputArgDesc).Short('o').Default(autoOutput).Enum(outputFormats...)
+	credProcess = kingpin.Flag("credential-process", credProcArgDesc).Bool()
+	agentFlag = kingpin.Flag("agent", agentArgDesc).Bool()
+	autoRefresh = kingpin.Flag("auto-refresh", autoRefreshArgDesc).Bool()
+	agentFgFlag = kingpin.Flag("agent-foreground", agentFgArgDesc).Hidden().Bool()
 	sesCreds = kingpin.Flag("session", sesCredArgDesc).Short('s').Bool()
 	refresh = kingpin.Flag("refresh", refreshArgDesc).Short('r').Bool()
 	verbose = kingpin.Flag("verbose", verboseArgDesc).Short('v').Bool()
@@ -89,6 +143,8 @@ func init() {
 	updateFlag = kingpin.Flag("update", updateArgDesc).Short('u').Bool()
 	diagFlag = kingpin.Flag("diagnose", diagArgDesc).Short('D').Bool()
 	ec2MdFlag = kingpin.Flag("ec2", ec2ArgDesc).Bool()
+	ecsMdFlag = kingpin.Flag("ecs", ecsArgDesc).Bool()
+	imdsV2Flag = kingpin.Flag("imdsv2", imdsV2ArgDesc).Bool()
 
 	// if AWS_PROFILE env var is NOT set, it MUST be 1st non-flag arg
 	// if AWS_PROFILE env var is set, all non-flag args will be treated as cmd
@@ -114,9 +170,50 @@ func main() {
 		log.SetLevel(simple_logger.DEBUG)
 	}
 
+	if *credProcess {
+		credentialProcessSetup()
+	}
+
+	if *autoRefresh && len(*cmd) < 1 {
+		log.Fatal("--auto-refresh can only be used when running a command")
+	}
+
+	if *agentFlag || *agentFgFlag {
+		agentHandler()
+		return
+	}
+
+	if usePicker() {
+		if p := pickProfile(); len(p) > 0 {
+			profile = aws.String(p)
+		}
+	}
+
+	if useAgent() && agentCredentials() {
+		return
+	}
+
 	resolveConfig()
 	log.Debugf("CONFIG: %+v", cfg)
 
+	if *listCache || len(*purgeCache) > 0 {
+		// cache management only works with local files, no need to look up AWS credentials or identity
+		cacheHandler()
+		return
+	}
+
+	if len(cfg.SamlAuthUrl) > 0 && *listRoles {
+		// the roles come from the SAML identity provider, no need to look up AWS credentials or identity
+		printSamlRoles()
+		return
+	}
+
+	if len(cfg.SsoStartUrl) > 0 && *listRoles {
+		// the roles come from the AWS SSO portal, no need to look up AWS credentials or identity
+		printSsoRoles()
+		return
+	}
+
 	awsSession(*profile, cfg)
 
 	awsUser(false)
@@ -125,7 +222,7 @@ func main() {
 	switch {
 	case *listMfa:
 		printMfa()
-	case *listRoles, *makeConf:
+	case *listRoles, *makeConf, *writeConf:
 		roleHandler()
 	case *updateFlag:
 		if err := versionCheck(Version); err != nil {
@@ -135,9 +232,10 @@ func main() {
 		if err := runDiagnostics(cfg); err != nil {
 			log.Debugf("error running diagnostics: %v", err)
 		}
-	case *ec2MdFlag:
+	case *ec2MdFlag, *ecsMdFlag:
 		log.Debug("Metadata Server")
-		if usr.IdentityType == "user" {
+		// SSO role credentials were already verified by awsUser(), and the SSO token is cached for the metadata service
+		if usr.IdentityType == "user" || len(cfg.SsoStartUrl) > 0 {
 			opts := new(metadata.EC2MetadataInput)
 			opts.Config = cfg  // should never be nil, from resolveConfig() call above
 			opts.Logger = log  // should never be nil, initialized at startup
@@ -145,59 +243,122 @@ func main() {
 			opts.User = usr    // should never be nil, from awsUser() above
 			opts.InitialProfile = *profile
 			opts.SessionCacheDir = filepath.Dir(sessionTokenCacheFile())
+			opts.TokenRequired = *imdsV2Flag
+			opts.Instance = &metadata.InstanceMetadata{
+				InstanceID:   cfg.Ec2InstanceID,
+				InstanceType: cfg.Ec2InstanceType,
+				ImageID:      cfg.Ec2ImageID,
+				Hostname:     cfg.Ec2Hostname,
+				LocalIPv4:    cfg.Ec2LocalIPv4,
+			}
 
-			if profile != nil && len(*profile) > 0 {
+			if profile != nil && len(*profile) > 0 && len(cfg.SsoStartUrl) < 1 {
 				cp := sessionTokenCredentials()
 				if _, err := cp.Get(); err != nil {
 					log.Fatal("Error getting initial credentials: %v", err)
 				}
 			}
 
+			if *ecsMdFlag {
+				opts.ECSReady = printEcsEnv
+				log.Fatal(metadata.NewECSMetadataService(opts))
+			}
 			log.Fatal(metadata.NewEC2MetadataService(opts))
 		}
 	default:
 		var c *credentials.Credentials
 
-		if usr.IdentityType == "user" {
+		if (isFederated() && len(cfg.RoleChain) < 1) || (len(cfg.SsoStartUrl) > 0 && len(cfg.RoleArn) < 1) {
+			// the session is already using the web identity, SAML or SSO credentials for the role, setup in awsSession()
+			c = ses.Config.Credentials
+		} else if usr.IdentityType == "user" {
 			c = handleUserCreds()
 		} else {
 			// non-IAM user (instance profile, other?)
-			c = assumeRoleCredentials(ses)
+			validateRoleChain()
+			c = assumeRoleCredentials(roleChainSession(ses))
 		}
 
-		creds, err := c.Get()
-		if err != nil {
-			log.Fatalf("Error getting credentials: %v", err)
-		}
+		handleCredentials(c)
+	}
+}
 
-		updateEnv(creds)
+// printEcsEnv prints the environment variables which configure the AWS SDKs to use the ECS credential service
+func printEcsEnv(url, token string) {
+	lineFmt := envLineFormat(*outputFormat)
+	fmt.Printf(lineFmt, metadata.ECSCredentialsUriEnvVar, url)
+	fmt.Printf(lineFmt, metadata.ECSAuthTokenEnvVar, token)
+}
 
-		if len(*cmd) > 0 {
-			signal.Notify(sigCh, os.Interrupt, syscall.SIGQUIT)
-			go func() {
-				for {
-					sig := <-sigCh
-					log.Debugf("Got signal: %s", sig.String())
-				}
-			}()
-
-			cmd = wrapCmd(cmd)
-			c := exec.Command((*cmd)[0], (*cmd)[1:]...)
-			c.Stdin = os.Stdin
-			c.Stdout = os.Stdout
-			c.Stderr = os.Stderr
-
-			err := c.Run()
-			if err != nil {
-				log.Debug("Error running command")
-				log.Fatalf("%v", err)
+// handleCredentials runs the command with the credentials set in the environment, or prints them if there's no command
+func handleCredentials(c *credentials.Credentials) {
+	creds, err := c.Get()
+	if err != nil {
+		log.Fatalf("Error getting credentials: %v", err)
+	}
+
+	if t, err := c.ExpiresAt(); err == nil {
+		credExpiration = t
+	}
+
+	updateEnv(creds)
+
+	if len(*cmd) > 0 {
+		if *autoRefresh {
+			srv := credentialEndpoint(c)
+			defer srv.Close()
+		}
+
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGQUIT)
+		go func() {
+			for {
+				sig := <-sigCh
+				log.Debugf("Got signal: %s", sig.String())
 			}
-		} else {
-			printCredentials()
+		}()
+
+		cmd = wrapCmd(cmd)
+		proc := exec.Command((*cmd)[0], (*cmd)[1:]...)
+		proc.Stdin = os.Stdin
+		proc.Stdout = os.Stdout
+		proc.Stderr = os.Stderr
+
+		if err := proc.Run(); err != nil {
+			log.Debug("Error running command")
+			log.Fatalf("%v", err)
 		}
+	} else {
+		printCredentials()
 	}
 }
 
+// credentialEndpoint starts an ECS container credentials endpoint serving credentials c, and points the wrapped command
+// at it, in place of the credential environment variables.  The AWS SDK in the command gets fresh credentials from the
+// endpoint when they expire, so commands running longer than the credential lifetime keep working.
+func credentialEndpoint(c *credentials.Credentials) *metadata.ECSCredentialServer {
+	srv, err := metadata.NewECSCredentialServer(c)
+	if err != nil {
+		log.Fatalf("Error starting credential endpoint: %v", err)
+	}
+	srv.WithLogger(log)
+
+	go func() {
+		if err := srv.Serve(); err != nil {
+			log.Errorf("Credential endpoint error: %v", err)
+		}
+	}()
+	log.Debugf("CREDENTIAL ENDPOINT: %s", srv.URL())
+
+	// the SDKs prefer credential environment variables over the container credentials endpoint
+	for _, e := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_SECURITY_TOKEN"} {
+		os.Unsetenv(e)
+	}
+	os.Setenv(metadata.ECSCredentialsUriEnvVar, srv.URL())
+	os.Setenv(metadata.ECSAuthTokenEnvVar, srv.Token)
+
+	return srv
+}
+
 func wrapCmd(cmd *[]string) *[]string {
 	// If on a non-windows platform, with the SHELL environment variable set, and a call to
 	// exec.LookPath() for the command fails, run the command in a sub-shell so we can support shell aliases.
@@ -230,33 +391,6 @@ func wrapCmd(cmd *[]string) *[]string {
 	return &newCmd
 }
 
-func printCredentials() {
-	format := "%s %s='%s'\n"
-	exportToken := "export"
-	switch runtime.GOOS {
-	case "windows":
-		// SHELL env var is not set by default in "normal" Windows cmd.exe and PowerShell sessions.
-		// If we detect it, assume we're running under something like git-bash (or maybe Cygwin?)
-		// and fall through to using linux-style env var setting syntax
-		if len(os.Getenv("SHELL")) < 1 {
-			exportToken = "set"
-		}
-	}
-
-	envVars := []string{
-		config.RegionEnvVar, config.DefaultRegionEnvVar,
-		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY",
-		"AWS_SESSION_TOKEN", "AWS_SECURITY_TOKEN",
-	}
-
-	for _, v := range envVars {
-		val, ok := os.LookupEnv(v)
-		if ok {
-			fmt.Printf(format, exportToken, v, val)
-		}
-	}
-}
-
 func updateEnv(creds credentials.Value) {
 	// Explicitly unset AWS_PROFILE to avoid unintended consequences
 	os.Unsetenv(config.ProfileEnvVar)
@@ -290,6 +424,10 @@ func handleUserCreds() *credentials.Credentials {
 
 	checkRefresh()
 
+	if !*sesCreds {
+		validateRoleChain()
+	}
+
 	if cfg.RoleDuration > 1*time.Hour {
 		// Not allowed to use session tokens to fetch assume role credentials > 1h
 		c = assumeRoleCredentials(ses)
@@ -299,7 +437,7 @@ func handleUserCreds() *credentials.Credentials {
 
 		if !*sesCreds && len(cfg.RoleArn) > 0 {
 			cfg.MfaSerial = "" // unset MfaSerial since MFA is handled in the session token
-			c = assumeRoleCredentials(s)
+			c = assumeRoleCredentials(roleChainSession(s))
 		} else {
 			// -s option found, or no role arn provided/found
 			c = sc
@@ -317,22 +455,36 @@ func checkRefresh() {
 	if *refresh {
 		var err error
 		if !*sesCreds {
-			err = os.Remove(assumeRoleCacheFile())
+			err = expireCache(assumeRoleCacheFile())
+			for _, r := range cfg.RoleChain {
+				if e := expireCache(chainedRoleCacheFile(r.RoleArn)); e != nil {
+					log.Debugf("Error removing cache file: %v", e)
+				}
+			}
 		}
-		err = os.Remove(sessionTokenCacheFile())
+		err = expireCache(sessionTokenCacheFile())
 		if err != nil {
 			log.Debugf("Error removing cache files: %v", err)
 		}
 	}
 }
 
+// caches which aren't backed by a file we can remove get overwritten with empty (expired) credentials
+func expireCache(path string) error {
+	switch cfg.CacheType {
+	case cache.MemoryCacheType, cache.ExternalCacheType:
+		return credentialCache(path).Store(new(cache.CacheableCredentials))
+	}
+	return os.Remove(path)
+}
+
 func printCredExpire() {
-	var f *cache.FileCredentialCache
+	var f cache.CredentialCacher
 
 	if !*sesCreds && len(cfg.RoleArn) > 0 {
-		f = &cache.FileCredentialCache{Path: assumeRoleCacheFile()}
+		f = credentialCache(assumeRoleCacheFile())
 	} else {
-		f = &cache.FileCredentialCache{Path: sessionTokenCacheFile()}
+		f = credentialCache(sessionTokenCacheFile())
 	}
 
 	creds, err := f.Fetch()
@@ -340,7 +492,10 @@ func printCredExpire() {
 		creds = new(cache.CacheableCredentials)
 	}
 
-	exp := time.Unix(creds.Expiration, 0)
+	printExpiration(time.Unix(creds.Expiration, 0))
+}
+
+func printExpiration(exp time.Time) {
 	format := exp.Format("2006-01-02 15:04:05")
 	hmn := humanize.Time(exp)
 
@@ -354,17 +509,33 @@ func printCredExpire() {
 	}
 }
 
+// credentialCache returns the CredentialCacher configured by the credential_cache setting for the provided cache file path
+func credentialCache(path string) cache.CredentialCacher {
+	c, err := cache.NewCredentialCacher(cfg.CacheType, path, cacheOptions())
+	if err != nil {
+		log.Fatalf("Error configuring credential cache: %v", err)
+	}
+	return c
+}
+
+func cacheOptions() *cache.Options {
+	return &cache.Options{KeyFile: cfg.CacheKeyFile, Command: cfg.CacheCommand}
+}
+
+// the directory holding the credential cache files, alongside the SDK credentials file
+func cacheDir() string {
+	return filepath.Dir(defaults.SharedCredentialsFilename())
+}
+
 func cacheFile(f string) string {
-	d := filepath.Dir(defaults.SharedCredentialsFilename())
-	return filepath.Join(d, f)
+	return filepath.Join(cacheDir(), f)
 }
 
 func assumeRoleCacheFile() string {
 	p := *profile
-	if *profile == cfg.RoleArn {
-		a, _ := arn.Parse(*profile) // if we get this far, it's assumed the ARN will parse
-		r := strings.Split(a.Resource, "/")
-		p = fmt.Sprintf("%s-%s", a.AccountID, r[len(r)-1])
+	if len(p) < 1 || p == cfg.RoleArn {
+		// a role ARN used as the profile, or a role only set by environment variables, has no profile name to use
+		p = roleArnCacheName(cfg.RoleArn)
 	}
 
 	cf := fmt.Sprintf("%s_%s", assumeRoleCachePrefix, p)
@@ -374,7 +545,34 @@ func assumeRoleCacheFile() string {
 	return cacheFile(cf)
 }
 
-func sessionTokenCacheFile() string {
+// cache file for the credentials of an intermediate role in a role chain
+func chainedRoleCacheFile(roleArn string) string {
+	return cacheFile(fmt.Sprintf("%s_%s", assumeRoleCachePrefix, roleArnCacheName(roleArn)))
+}
+
+// cache name for roles which aren't referenced by a profile name is <account id>-<role name>
+func roleArnCacheName(roleArn string) string {
+	a, err := arn.Parse(roleArn)
+	if err != nil {
+		return roleArn
+	}
+
+	r := strings.Split(a.Resource, "/")
+	return fmt.Sprintf("%s-%s", a.AccountID, r[len(r)-1])
+}
+
+// cache file for the roles found in the IAM policies of the user, the user name is only unique within an account
+func roleCacheFile() string {
+	return cacheFile(fmt.Sprintf("%s_%s-%s", roleCachePrefix, *usr.Identity.Account, usr.UserName))
+}
+
+// cache file for the account aliases looked up using the roles the user is allowed to assume
+func accountAliasCacheFile() string {
+	return cacheFile(fmt.Sprintf("%s_%s-%s", aliasCachePrefix, *usr.Identity.Account, usr.UserName))
+}
+
+// the name of the profile holding the credentials used to fetch the session token
+func sourceProfile() string {
 	p := cfg.SourceProfile
 	if len(p) < 1 {
 		if len(*profile) > 0 {
@@ -383,39 +581,232 @@ func sessionTokenCacheFile() string {
 			p = "default"
 		}
 	}
+	return p
+}
 
-	cf := fmt.Sprintf("%s_%s", sessionTokenCachePrefix, p)
+func sessionTokenCacheFile() string {
+	cf := fmt.Sprintf("%s_%s", sessionTokenCachePrefix, sourceProfile())
 	if log != nil {
 		log.Debugf("SessionToken CACHE PATH: %s", cf)
 	}
 	return cacheFile(cf)
 }
 
+func assumeRoleExpiryWindow() time.Duration {
+	if cfg.RoleDuration < credlib.AssumeRoleMinDuration {
+		return credlib.AssumeRoleMinDuration / 10
+	}
+	return cfg.RoleDuration / 10
+}
+
 func assumeRoleCredentials(c client.ConfigProvider) *credentials.Credentials {
-	var ew time.Duration
+	ew := assumeRoleExpiryWindow()
 
 	if c == nil {
 		c = ses
 	}
 
-	if cfg.RoleDuration < credlib.AssumeRoleMinDuration {
-		ew = credlib.AssumeRoleMinDuration / 10
-	} else {
-		ew = cfg.RoleDuration / 10
-	}
-
 	return credlib.NewAssumeRoleCredentials(c, cfg.RoleArn, func(p *credlib.AssumeRoleProvider) {
 		p.RoleSessionName = usr.UserName
 		p.ExternalID = cfg.ExternalID
 		p.SerialNumber = cfg.MfaSerial
-		p.TokenProvider = credlib.StdinTokenProvider
+		p.TokenProvider = deviceTokenProvider(func() string { return p.SerialNumber })
 		p.Duration = cfg.RoleDuration
 		p.ExpiryWindow = ew
-		p.Cache = &cache.FileCredentialCache{Path: assumeRoleCacheFile()}
+		p.Cache = credentialCache(assumeRoleCacheFile())
+		p.WithLogger(log)
+
+		if cfg.RoleDuration > 1*time.Hour {
+			// session token credentials aren't used to assume the role, so MFA is done in the assume role call
+			p.SerialNumberProvider = mfaSerialProvider()
+		}
+	})
+}
+
+// isFederated returns true if the role credentials come from an external identity provider (web identity or SAML),
+// instead of IAM user credentials
+func isFederated() bool {
+	return len(cfg.WebIdentityTokenFile) > 0 || len(cfg.SamlAuthUrl) > 0
+}
+
+// federatedRole returns the ARN, and the cache file, of the role assumed using the external identity provider
+// credentials, which is the first role in the role chain, or the profile's role if there is no role chain
+func federatedRole() (string, string) {
+	roleArn := cfg.RoleArn
+	cf := assumeRoleCacheFile()
+	if len(cfg.RoleChain) > 0 {
+		roleArn = cfg.RoleChain[0].RoleArn
+		cf = chainedRoleCacheFile(roleArn)
+	}
+
+	if *refresh {
+		if err := expireCache(cf); err != nil {
+			log.Debugf("Error removing cache file: %v", err)
+		}
+	}
+
+	return roleArn, cf
+}
+
+func webIdentityCredentials() *credentials.Credentials {
+	roleArn, cf := federatedRole()
+
+	return credlib.NewWebIdentityRoleCredentials(ses, roleArn, cfg.WebIdentityTokenFile, func(p *credlib.WebIdentityRoleProvider) {
+		p.RoleSessionName = os.Getenv("AWS_ROLE_SESSION_NAME")
+		p.Duration = cfg.RoleDuration
+		p.ExpiryWindow = assumeRoleExpiryWindow()
+		p.Cache = credentialCache(cf)
+		p.WithLogger(log)
+	})
+}
+
+func samlRoleCredentials() *credentials.Credentials {
+	roleArn, cf := federatedRole()
+	if len(roleArn) < 1 {
+		log.Fatal("A role ARN is required to get credentials using SAML, use the -l option to list the available roles")
+	}
+
+	return credlib.NewSamlRoleCredentials(ses, roleArn, samlClient(), func(p *credlib.SamlRoleProvider) {
+		p.Duration = cfg.RoleDuration
+		p.ExpiryWindow = assumeRoleExpiryWindow()
+		p.Cache = credentialCache(cf)
+		p.WithLogger(log)
+	})
+}
+
+// samlClient returns the client for the SAML identity provider, the same client is always returned so we only need
+// to authenticate with the identity provider once
+func samlClient() saml.Client {
+	if samlIdp == nil {
+		c, err := saml.NewFormLoginClient(cfg.SamlAuthUrl, func(c *saml.FormLoginClient) {
+			c.Username = cfg.SamlUsername
+			c.Password = os.Getenv(saml.PasswordEnvVar)
+			c.PasswordProvider = saml.TtyPasswordProvider
+			c.MfaTokenProvider = tokenProvider()
+		})
+		if err != nil {
+			log.Fatalf("Error configuring SAML client: %v", err)
+		}
+
+		if len(c.Username) < 1 {
+			log.Fatal("A user name is required for SAML authentication, set saml_username in the profile or the SAML_USERNAME environment variable")
+		}
+		samlIdp = c.WithLogger(log)
+	}
+	return samlIdp
+}
+
+// list the roles available in the SAML assertion, no AWS credentials are needed
+func printSamlRoles() {
+	a, err := samlClient().AwsSaml()
+	if err != nil {
+		log.Fatalf("Error getting SAML assertion: %v", err)
+	}
+
+	roles, err := a.Roles()
+	if err != nil {
+		log.Fatalf("Error reading roles from SAML assertion: %v", err)
+	}
+
+	fmt.Printf("Available role ARNs for %s (%s)\n", cfg.SamlUsername, cfg.SamlAuthUrl)
+	for _, r := range roles {
+		fmt.Printf("  %s\n", r.RoleArn)
+	}
+}
+
+// ssoRoleCredentials returns the credentials for the AWS SSO account and role of the profile.  If the profile has a
+// role_arn, these are used as the source credentials to assume that role.
+func ssoRoleCredentials() *credentials.Credentials {
+	if len(cfg.SsoAccountID) < 1 || len(cfg.SsoRoleName) < 1 {
+		log.Fatal("The sso_account_id and sso_role_name attributes are required to get AWS SSO credentials, use the -l option to list the available roles")
+	}
+
+	cf := ssoRoleCacheFile(cfg.SsoAccountID, cfg.SsoRoleName)
+	if *refresh {
+		if err := expireCache(cf); err != nil {
+			log.Debugf("Error removing cache file: %v", err)
+		}
+	}
+
+	return credlib.NewSsoRoleCredentials(ses, cfg.SsoAccountID, cfg.SsoRoleName, ssoClient(), func(p *credlib.SsoRoleProvider) {
+		p.ExpiryWindow = assumeRoleExpiryWindow()
+		p.Cache = credentialCache(cf)
 		p.WithLogger(log)
 	})
 }
 
+// cache file for AWS SSO role credentials, named so it won't collide with an IAM role of the same name
+func ssoRoleCacheFile(acct, role string) string {
+	return cacheFile(fmt.Sprintf("%s_sso-%s-%s", assumeRoleCachePrefix, acct, role))
+}
+
+// ssoClient returns the client for the AWS SSO start url of the profile, the same client is always returned so the
+// SSO token is only looked up once
+func ssoClient() *sso.Client {
+	if ssoIdp == nil {
+		r := cfg.SsoRegion
+		if len(r) < 1 {
+			r = cfg.Region
+		}
+
+		c, err := sso.NewClient(cfg.SsoStartUrl, r)
+		if err != nil {
+			log.Fatalf("Error configuring AWS SSO client: %v", err)
+		}
+		ssoIdp = c.WithLogger(log)
+	}
+	return ssoIdp
+}
+
+// list the accounts and roles available to the user in the AWS SSO portal, no AWS credentials are needed
+func printSsoRoles() {
+	roles, err := ssoClient().AccountRoles()
+	if err != nil {
+		log.Fatalf("Error listing AWS SSO roles: %v", err)
+	}
+
+	fmt.Printf("Available AWS SSO roles for %s\n", cfg.SsoStartUrl)
+	for _, r := range roles {
+		fmt.Printf("  %s (%s) %s\n", r.AccountID, r.AccountName, r.RoleName)
+	}
+}
+
+// AWS limits the duration of credentials for roles assumed using another role's credentials
+func validateRoleChain() {
+	if len(cfg.RoleChain) > 0 && cfg.RoleDuration > credlib.ChainedRoleMaxDuration {
+		log.Fatalf("The role for this profile is assumed using another role (role chaining), which limits the credential "+
+			"duration to %s, but a duration of %s was requested", credlib.ChainedRoleMaxDuration, cfg.RoleDuration)
+	}
+}
+
+// roleChainSession returns a copy of session s using the credentials of the last intermediate role in the configured
+// role chain.  Each role in the chain is assumed using the credentials of the role before it, the first role is assumed
+// using the credentials of session s.  If there is no role chain, session s is returned.
+func roleChainSession(s *session.Session) *session.Session {
+	for _, r := range cfg.RoleChain {
+		if len(r.WebIdentityTokenFile) > 0 || len(r.SamlAuthUrl) > 0 {
+			// the session already has the web identity or SAML credentials for this role
+			continue
+		}
+		roleArn := r.RoleArn
+		extID := r.ExternalID
+
+		c := credlib.NewAssumeRoleCredentials(s, roleArn, func(p *credlib.AssumeRoleProvider) {
+			p.RoleSessionName = usr.UserName
+			p.ExternalID = extID
+			p.Duration = cfg.RoleDuration
+			p.ExpiryWindow = assumeRoleExpiryWindow()
+			p.Cache = credentialCache(chainedRoleCacheFile(roleArn))
+			p.WithLogger(log)
+		})
+		log.Debugf("ROLE CHAIN: %s", roleArn)
+
+		s = s.Copy(new(aws.Config).WithCredentials(c))
+	}
+
+	return s
+}
+
 func sessionTokenCredentials(cacheFile ...string) *credentials.Credentials {
 	var ew time.Duration
 
@@ -430,48 +821,240 @@ func sessionTokenCredentials(cacheFile ...string) *credentials.Credentials {
 	}
 
 	return credlib.NewSessionCredentials(ses, func(p *credlib.SessionTokenProvider) {
-		p.Cache = &cache.FileCredentialCache{Path: cacheFile[0]}
+		p.Cache = credentialCache(cacheFile[0])
 		p.SerialNumber = cfg.MfaSerial
-		p.TokenProvider = credlib.StdinTokenProvider
+		p.SerialNumberProvider = mfaSerialProvider()
+		p.TokenProvider = deviceTokenProvider(func() string { return p.SerialNumber })
 		p.Duration = cfg.SessionDuration
 		p.ExpiryWindow = ew
 		p.WithLogger(log)
 	})
 }
 
+// Configure the program to act as a credential_process provider for the AWS SDK, where the only output on stdout must
+// be the JSON credentials document
+func credentialProcessSetup() {
+	if _, ok := os.LookupEnv(config.ProfileEnvVar); ok && len(*cmd) == 1 {
+		// the AWS_PROFILE env var from the SDK caller's environment caused the profile arg to be parsed as a command,
+		// the profile set in the credential_process attribute must win
+		profile = aws.String((*cmd)[0])
+		*cmd = []string{}
+	}
+
+	if len(*cmd) > 0 {
+		log.Fatal("--credential-process can not be used to execute a command")
+	}
+
+	*outputFormat = jsonOutput
+}
+
+// tokenProvider returns the MFA token provider configured for the profile
+func tokenProvider() func() (string, error) {
+	return newTokenProvider(cfg)
+}
+
 func roleHandler() {
 	if usr.IdentityType == "user" {
-		rg := util.NewAwsRoleGetter(ses, usr.UserName).WithLogger(log)
-		roles := rg.Roles()
+		var roles util.Roles
+		if *simulateFlag {
+			roles = simulatedRoles()
+		} else {
+			roles = policyRoles()
+		}
+
+		if *makeConf {
+			log.Debug("Make Configuration Files.")
+			if err := makeConfig(roles, os.Stdout); err != nil {
+				log.Fatalf("Error building configuration: %v", err)
+			}
+		}
+
+		if *writeConf {
+			log.Debug("Write Configuration File.")
+			if err := writeConfig(roles, os.Stdout); err != nil {
+				log.Fatalf("Error updating configuration file: %v", err)
+			}
+		}
+	}
+}
+
+// policyRoles finds the roles the user is able to assume from the user's IAM policies, and prints the roles when
+// listing roles
+func policyRoles() util.Roles {
+	cf := roleCacheFile()
+	if *refresh {
+		os.Remove(cf)
+	}
+
+	rg := util.NewAwsRoleGetter(ses, usr.UserName).WithAccounts(cfg.RoleAccounts).WithCache(cf, roleCacheTTL).WithLogger(log)
+	assumable, err := rg.FindRoles()
+	if e, ok := err.(util.RoleErrors); ok {
+		for _, v := range e {
+			log.Warnf("Error looking up roles: %v", v)
+		}
+		log.Warn("The role list may be incomplete")
+	}
+
+	if *listRoles {
+		log.Debug("List Roles")
+		if len(*listFormat) > 0 {
+			profiles := roleProfiles()
+			aliases := roleAccountAliases(assumable.Roles(), profiles)
+
+			entries := make([]*roleListEntry, 0, len(assumable))
+			for _, r := range assumable {
+				e := newRoleListEntry(r.Arn, aliases, profiles)
+				e.Conditions = r.Conditions
+				entries = append(entries, e)
+			}
 
-		if *listRoles {
-			log.Debug("List Roles")
+			if err := printRoleList(entries, os.Stdout, *listFormat); err != nil {
+				log.Fatalf("Error printing roles: %v", err)
+			}
+		} else {
 			fmt.Printf("Available role ARNs for %s (%s)\n", usr.UserName, *usr.Identity.Arn)
-			for _, v := range roles {
+			for _, v := range assumable {
 				fmt.Printf("  %s\n", v)
 			}
 		}
+	}
 
-		if *makeConf {
-			log.Debug("Make Configuration Files.")
-			// todo
-			//var mfa *string
-			//if mfaArn != nil && len(*mfaArn) > 0 {
-			//	// MFA arn provided by cmdline option
-			//	mfa = mfaArn
-			//} else {
-			//	m, err := util.LookupMfa(ses)
-			//	if err != nil {
-			//		log.Errorf("MFA lookup failed, will not configure MFA: %v", err)
-			//	}
-			//
-			//	if len(m) > 0 {
-			//		// use 1st MFA device found
-			//		mfa = m[0].SerialNumber
-			//	}
-			//}
+	return assumable.Roles()
+}
+
+func makeConfig(roles util.Roles, w io.Writer) error {
+	b := configBuilder()
+
+	if *confType == "aws" {
+		return b.WriteAwsConfig(w, roles)
+	}
+	return b.WriteSwitchRoleConfig(w, roles)
+}
+
+func writeConfig(roles util.Roles, w io.Writer) error {
+	profiles := make(map[string]*config.AwsConfig)
+	for _, p := range configBuilder().Profiles(roles) {
+		profiles[p.Name] = &config.AwsConfig{RoleArn: p.RoleArn, SourceProfile: p.SourceProfile, MfaSerial: p.MfaSerial,
+			Region: p.Region}
+	}
+
+	added, err := config.MergeProfiles(profiles, w, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		log.Infof("Added %d profiles to configuration file: %s", len(added), strings.Join(added, ", "))
+	}
+	return nil
+}
+
+func configBuilder() *util.ConfigBuilder {
+	var mfa string
+	if mfaArn != nil && len(*mfaArn) > 0 {
+		// MFA arn provided by cmdline option
+		mfa = *mfaArn
+	} else {
+		m, err := lookupMfa()
+		if err != nil {
+			log.Errorf("MFA lookup failed, will not configure MFA: %v", err)
+		}
+
+		if len(m) > 0 {
+			// use 1st MFA device found
+			mfa = *m[0].SerialNumber
+		}
+	}
+
+	return util.NewConfigBuilder(func(b *util.ConfigBuilder) {
+		b.Region = cfg.Region
+		b.MfaSerial = mfa
+		b.SourceProfile = sourceProfile()
+		b.AccountAliases = accountAliases()
+	})
+}
+
+// account aliases come from the account_alias_file, IAM only provides the alias for the account of the caller's
+// credentials, which is looked up if the file doesn't have it
+func accountAliases() map[string]string {
+	m := accountAliasFile()
+	if usr == nil || usr.Identity == nil || usr.Identity.Account == nil {
+		return m
+	}
+
+	if _, ok := m[*usr.Identity.Account]; ok {
+		return m
+	}
+
+	o, err := iam.New(ses).ListAccountAliases(new(iam.ListAccountAliasesInput))
+	if err != nil {
+		log.Debugf("Error looking up account alias: %v", err)
+		return m
+	}
+
+	if len(o.AccountAliases) > 0 {
+		m[*usr.Identity.Account] = *o.AccountAliases[0]
+	}
+	return m
+}
+
+// roleAccountAliases returns the accountAliases, along with the aliases of the other accounts of the listed roles,
+// which are looked up by assuming one of the roles in the account.  Only used for --list-format, since it may require
+// an MFA code, and is slow for many accounts, the aliases found through the roles are cached.
+func roleAccountAliases(roles util.Roles, profiles map[string][]*roleListProfile) map[string]string {
+	m := accountAliases()
+	if usr == nil || usr.Identity == nil || usr.Identity.Account == nil {
+		return m
+	}
+
+	cf := accountAliasCacheFile()
+	if *refresh {
+		os.Remove(cf)
+	}
+
+	cache := readAccountAliasCache(cf)
+	if lookupAccountAliases(roles, m, cache, roleAccountAlias(profiles)) {
+		if err := writeAccountAliasCache(cf, cache, aliasCacheTTL); err != nil {
+			log.Debugf("Error writing account alias cache: %v", err)
+		}
+	}
+
+	for k, v := range cache {
+		if _, ok := m[k]; !ok && len(v) > 0 {
+			m[k] = v
 		}
 	}
+	return m
+}
+
+// roleAccountAlias returns the function to look up the alias of the account of a role, using credentials for the role
+// assumed with the session token credentials, so MFA is only needed once.  The external ID of a profile using the role
+// is sent when assuming the role.
+func roleAccountAlias(profiles map[string][]*roleListProfile) func(string) (string, error) {
+	var s *session.Session
+
+	return func(roleArn string) (string, error) {
+		if s == nil {
+			s = ses.Copy(new(aws.Config).WithCredentials(sessionTokenCredentials()))
+		}
+
+		c := credlib.NewAssumeRoleCredentials(s, roleArn, func(p *credlib.AssumeRoleProvider) {
+			p.RoleSessionName = usr.UserName
+			p.ExternalID = roleExternalID(profiles[roleArn])
+			p.Duration = credlib.AssumeRoleMinDuration
+			p.WithLogger(log)
+		})
+
+		o, err := iam.New(s.Copy(new(aws.Config).WithCredentials(c))).ListAccountAliases(new(iam.ListAccountAliasesInput))
+		if err != nil {
+			return "", err
+		}
+
+		if len(o.AccountAliases) > 0 {
+			return *o.AccountAliases[0], nil
+		}
+		return "", nil
+	}
 }
 
 func printMfa() {
@@ -535,11 +1118,37 @@ func awsSession(profile string, cfg *config.AwsConfig) {
 	if len(cfg.SourceProfile) > 0 {
 		p = cfg.SourceProfile
 	}
+
+	if len(cfg.CredentialSource) > 0 || len(cfg.WebIdentityTokenFile) > 0 || len(cfg.SamlAuthUrl) > 0 || len(cfg.SsoStartUrl) > 0 {
+		// credentials come from the credential_source, web identity token, SAML identity provider or AWS SSO, not a
+		// profile in the credentials file
+		p = ""
+	}
 	opts.Profile = p
 
 	// Do not set opts.SharedConfigState to enabled so we only get credentials for the profile.  We don't want the config
 	// file values getting in the way (like prompting for MFA and assuming roles) at this point.
 	ses = session.Must(session.NewSessionWithOptions(opts))
+
+	if len(cfg.CredentialSource) > 0 {
+		c, err := credlib.NewCredentialSourceCredentials(ses, cfg.CredentialSource)
+		if err != nil {
+			log.Fatalf("Error configuring credential_source: %v", err)
+		}
+		log.Debugf("CREDENTIAL SOURCE: %s", cfg.CredentialSource)
+		ses = ses.Copy(new(aws.Config).WithCredentials(c))
+	}
+
+	if len(cfg.WebIdentityTokenFile) > 0 {
+		log.Debugf("WEB IDENTITY TOKEN FILE: %s", cfg.WebIdentityTokenFile)
+		ses = ses.Copy(new(aws.Config).WithCredentials(webIdentityCredentials()))
+	} else if len(cfg.SamlAuthUrl) > 0 {
+		log.Debugf("SAML AUTH URL: %s", cfg.SamlAuthUrl)
+		ses = ses.Copy(new(aws.Config).WithCredentials(samlRoleCredentials()))
+	} else if len(cfg.SsoStartUrl) > 0 {
+		log.Debugf("SSO START URL: %s", cfg.SsoStartUrl)
+		ses = ses.Copy(new(aws.Config).WithCredentials(ssoRoleCredentials()))
+	}
 }
 
 func awsUser(resetEnv bool) {
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/mmmorris1975/aws-runas/lib/config"
 	credlib "github.com/mmmorris1975/aws-runas/lib/credentials"
+	"github.com/mmmorris1975/aws-runas/lib/metadata"
+	"github.com/mmmorris1975/aws-runas/lib/util"
 	"os"
 	"strings"
 	"testing"
@@ -63,6 +66,13 @@ func Example_printCredentials() {
 	// export AWS_SECRET_ACCESS_KEY='SecretKey'
 }
 
+func Example_printEcsEnv() {
+	printEcsEnv("http://127.0.0.1:12345/credentials", "mock-token")
+	// Output:
+	// export AWS_CONTAINER_CREDENTIALS_FULL_URI='http://127.0.0.1:12345/credentials'
+	// export AWS_CONTAINER_AUTHORIZATION_TOKEN='mock-token'
+}
+
 // requires setting up credential cache files
 //func ExamplePrintCredExpire() {
 //
@@ -141,6 +151,26 @@ func TestAssumeRoleCacheFile(t *testing.T) {
 	}
 }
 
+func TestAssumeRoleCacheFile_NoProfile(t *testing.T) {
+	oldP := *profile
+	profile = aws.String("")
+	defer func() { profile = &oldP; cfg.RoleArn = "" }()
+
+	cfg.RoleArn = "arn:aws:iam::123456789012:role/WebIdentity"
+	f1 := assumeRoleCacheFile()
+
+	cfg.RoleArn = "arn:aws:iam::210987654321:role/Other"
+	f2 := assumeRoleCacheFile()
+
+	if f1 == f2 {
+		t.Errorf("roles share cache file: %s", f1)
+	}
+
+	if !strings.HasSuffix(f1, fmt.Sprintf("%s_%s", assumeRoleCachePrefix, "123456789012-WebIdentity")) {
+		t.Errorf("bad role cache name: %s", f1)
+	}
+}
+
 func TestSessionTokenCacheFile(t *testing.T) {
 	// returned name will change depending on the machine it runs on
 	t.Run("profile", func(t *testing.T) {
@@ -155,6 +185,163 @@ func TestSessionTokenCacheFile(t *testing.T) {
 	})
 }
 
+func TestChainedRoleCacheFile(t *testing.T) {
+	f := chainedRoleCacheFile("arn:aws:iam::123456789012:role/path/Hub")
+	if !strings.HasSuffix(f, fmt.Sprintf("%s_%s", assumeRoleCachePrefix, "123456789012-Hub")) {
+		t.Error("bad chained role cache name")
+	}
+}
+
+func TestRoleCacheFile(t *testing.T) {
+	origUsr := usr
+	defer func() { usr = origUsr }()
+
+	usr = &credlib.AwsIdentity{UserName: "bob", Identity: &sts.GetCallerIdentityOutput{Account: aws.String("123456789012")}}
+	if f := roleCacheFile(); !strings.HasSuffix(f, fmt.Sprintf("%s_%s", roleCachePrefix, "123456789012-bob")) {
+		t.Errorf("bad role list cache name: %s", f)
+	}
+}
+
+func TestRoleChainSession(t *testing.T) {
+	t.Run("no chain", func(t *testing.T) {
+		if s := roleChainSession(ses); s != ses {
+			t.Error("unexpected new session")
+		}
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		cfg.RoleChain = []*config.AwsConfig{{RoleArn: "arn:aws:iam::123456789012:role/Hub"}}
+		defer func() { cfg.RoleChain = nil }()
+
+		s := roleChainSession(ses)
+		if s == ses || s.Config.Credentials == ses.Config.Credentials {
+			t.Error("session not updated with chained role credentials")
+		}
+	})
+
+	t.Run("web identity", func(t *testing.T) {
+		cfg.RoleChain = []*config.AwsConfig{{RoleArn: "arn:aws:iam::123456789012:role/Hub", WebIdentityTokenFile: "token-file"}}
+		defer func() { cfg.RoleChain = nil }()
+
+		if s := roleChainSession(ses); s != ses {
+			t.Error("web identity role in chain was assumed again")
+		}
+	})
+}
+
+func TestAwsSession_CredentialSource(t *testing.T) {
+	orig := ses
+	defer func() { ses = orig }()
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIAMOCK")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "MockSecretKey")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	c := &config.AwsConfig{CredentialSource: credlib.EnvironmentCredentialSource, RoleArn: "arn:aws:iam::123456789012:role/Admin"}
+	awsSession("x", c)
+
+	v, err := ses.Config.Credentials.Get()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if v.AccessKeyID != "AKIAMOCK" {
+		t.Error("credentials not from credential_source")
+	}
+}
+
+func TestAwsSession_WebIdentity(t *testing.T) {
+	orig := ses
+	origCfg := cfg
+	defer func() { ses = orig; cfg = origCfg }()
+
+	cfg = &config.AwsConfig{WebIdentityTokenFile: "token-file", RoleArn: "arn:aws:iam::123456789012:role/Admin"}
+	awsSession("x", cfg)
+
+	if ses == orig || ses.Config.Credentials == orig.Config.Credentials {
+		t.Error("session not updated with web identity credentials")
+	}
+}
+
+func TestAwsSession_Saml(t *testing.T) {
+	orig := ses
+	origCfg := cfg
+	defer func() { ses = orig; cfg = origCfg; samlIdp = nil }()
+
+	cfg = &config.AwsConfig{SamlAuthUrl: "https://idp.example.com/saml", SamlUsername: "bob", RoleArn: "arn:aws:iam::123456789012:role/Admin"}
+	awsSession("x", cfg)
+
+	if ses == orig || ses.Config.Credentials == orig.Config.Credentials {
+		t.Error("session not updated with SAML credentials")
+	}
+
+	if samlIdp == nil || samlClient() != samlIdp {
+		t.Error("SAML client not reused")
+	}
+}
+
+func TestAwsSession_Sso(t *testing.T) {
+	orig := ses
+	origCfg := cfg
+	defer func() { ses = orig; cfg = origCfg; ssoIdp = nil }()
+
+	cfg = &config.AwsConfig{SsoStartUrl: "https://example.awsapps.com/start", SsoRegion: "us-east-1",
+		SsoAccountID: "123456789012", SsoRoleName: "Admin"}
+	awsSession("x", cfg)
+
+	if ses == orig || ses.Config.Credentials == orig.Config.Credentials {
+		t.Error("session not updated with SSO credentials")
+	}
+
+	if ssoIdp == nil || ssoClient() != ssoIdp {
+		t.Error("SSO client not reused")
+	}
+}
+
+func TestSsoRoleCacheFile(t *testing.T) {
+	f := ssoRoleCacheFile("123456789012", "Admin")
+	if !strings.HasSuffix(f, fmt.Sprintf("%s_%s", assumeRoleCachePrefix, "sso-123456789012-Admin")) {
+		t.Error("bad SSO role cache name")
+	}
+}
+
+func TestTokenProvider(t *testing.T) {
+	defer func() { cfg.MfaTokenProvider = ""; cfg.MfaTokenCommand = ""; *credProcess = false }()
+
+	t.Run("default", func(t *testing.T) {
+		if fmt.Sprintf("%p", tokenProvider()) != fmt.Sprintf("%p", credlib.StdinTokenProvider) {
+			t.Error("did not get stdin token provider")
+		}
+	})
+
+	t.Run("stdin with credential process", func(t *testing.T) {
+		cfg.MfaTokenProvider = credlib.StdinTokenProviderType
+		*credProcess = true
+		defer func() { *credProcess = false }()
+
+		if fmt.Sprintf("%p", tokenProvider()) != fmt.Sprintf("%p", credlib.TtyTokenProvider) {
+			t.Error("did not get tty token provider")
+		}
+	})
+
+	t.Run("command", func(t *testing.T) {
+		cfg.MfaTokenProvider = credlib.CommandTokenProviderType
+		cfg.MfaTokenCommand = "echo 123456"
+
+		c, err := tokenProvider()()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if c != "123456" {
+			t.Error("bad mfa code")
+		}
+	})
+}
+
 func TestAssumeRoleCredentials(t *testing.T) {
 	c := assumeRoleCredentials(nil)
 	if c == nil {
@@ -181,3 +368,100 @@ func TestResolveConfig(t *testing.T) {
 		t.Error("session duration mismatch")
 	}
 }
+
+func TestMakeConfig(t *testing.T) {
+	mfaArn = aws.String("arn:aws:iam::123456789012:mfa/bob")
+	defer func() { mfaArn = aws.String(""); confType = aws.String("plugin") }()
+	roles := util.Roles{"arn:aws:iam::123456789012:role/Admin"}
+
+	t.Run("plugin", func(t *testing.T) {
+		confType = aws.String("plugin")
+		b := new(strings.Builder)
+		if err := makeConfig(roles, b); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if !strings.Contains(b.String(), "aws_account_id = 123456789012") {
+			t.Error("missing account id in plugin config")
+		}
+	})
+
+	t.Run("aws", func(t *testing.T) {
+		confType = aws.String("aws")
+		b := new(strings.Builder)
+		if err := makeConfig(roles, b); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if !strings.Contains(b.String(), "mfa_serial = arn:aws:iam::123456789012:mfa/bob") {
+			t.Error("missing mfa serial in aws config")
+		}
+	})
+}
+
+func TestWriteConfig(t *testing.T) {
+	mfaArn = aws.String("arn:aws:iam::123456789012:mfa/bob")
+	dryRun = aws.Bool(true)
+	cfg.Region = "us-west-2"
+	defer func() { mfaArn = aws.String(""); dryRun = aws.Bool(false); cfg.Region = "" }()
+
+	b := new(strings.Builder)
+	if err := writeConfig(util.Roles{"arn:aws:iam::123456789012:role/Admin"}, b); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !strings.Contains(b.String(), "+[profile 123456789012-Admin]") || !strings.Contains(b.String(), "+region = us-west-2") {
+		t.Errorf("unexpected diff output: %s", b.String())
+	}
+}
+
+func TestCredentialProcessSetup(t *testing.T) {
+	origProfile := profile
+	defer func() {
+		profile = origProfile
+		*outputFormat = autoOutput
+		*credProcess = false
+	}()
+
+	t.Run("profile env var", func(t *testing.T) {
+		os.Setenv(config.ProfileEnvVar, "other")
+		defer os.Unsetenv(config.ProfileEnvVar)
+		*cmd = []string{"my-profile"}
+
+		credentialProcessSetup()
+		if *profile != "my-profile" || len(*cmd) > 0 {
+			t.Error("profile arg was not used as the profile")
+		}
+
+		if *outputFormat != jsonOutput {
+			t.Error("output format not set to json")
+		}
+	})
+
+	t.Run("token provider", func(t *testing.T) {
+		*credProcess = true
+		if fmt.Sprintf("%p", tokenProvider()) != fmt.Sprintf("%p", credlib.TtyTokenProvider) {
+			t.Error("did not get tty token provider")
+		}
+	})
+}
+
+func TestCredentialEndpoint(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIAMOCK")
+	defer os.Unsetenv(metadata.ECSCredentialsUriEnvVar)
+	defer os.Unsetenv(metadata.ECSAuthTokenEnvVar)
+
+	srv := credentialEndpoint(credentials.NewStaticCredentials("AKIAMOCK", "MockSecret", ""))
+	defer srv.Close()
+
+	if _, ok := os.LookupEnv("AWS_ACCESS_KEY_ID"); ok {
+		t.Error("credential env vars were not unset")
+	}
+
+	if os.Getenv(metadata.ECSCredentialsUriEnvVar) != srv.URL() || os.Getenv(metadata.ECSAuthTokenEnvVar) != srv.Token {
+		t.Error("credential endpoint env vars were not set")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mmmorris1975/aws-runas/lib/config"
+	credlib "github.com/mmmorris1975/aws-runas/lib/credentials"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// the MFA device selected by selectMfaDevice(), so the user is only asked once
+var mfaDevice *string
+
+// mfaSerialProvider returns the function used to select the MFA device when the profile doesn't set mfa_serial.
+// The device is only looked up when credentials need to be fetched from AWS, so using cached credentials doesn't
+// require an IAM API call.  A nil value is returned if the MFA device is known, or the identity is not an IAM user.
+func mfaSerialProvider() func() (string, error) {
+	if len(cfg.MfaSerial) > 0 || usr == nil || usr.IdentityType != "user" {
+		return nil
+	}
+	return selectMfaDevice
+}
+
+// selectMfaDevice returns the serial number of the MFA device to use, chosen from the mfa_serials list of the profile,
+// or the MFA devices of the IAM user if there is no list.  If there are multiple devices, the user is asked to choose
+// one.  An empty serial number is returned if there are no MFA devices.
+func selectMfaDevice() (string, error) {
+	if mfaDevice != nil {
+		return *mfaDevice, nil
+	}
+
+	devices := cfg.MfaSerials
+	if len(devices) < 1 {
+		mfa, err := lookupMfa()
+		if err != nil {
+			// the user may not have permission to list their MFA devices, carry on without MFA
+			log.Debugf("Error retrieving MFA devices: %v", err)
+		}
+
+		for _, d := range mfa {
+			devices = append(devices, *d.SerialNumber)
+		}
+	}
+
+	var sn string
+	switch len(devices) {
+	case 0:
+	case 1:
+		sn = devices[0]
+	default:
+		if *credProcess {
+			return "", fmt.Errorf("found %d MFA devices, set mfa_serial in the profile to select one", len(devices))
+		}
+
+		var err error
+		sn, err = pickMfaDevice(os.Stdin, os.Stderr, devices)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	log.Debugf("MFA DEVICE: %s", sn)
+	mfaDevice = &sn
+	return sn, nil
+}
+
+// pickMfaDevice prompts the user on out to select one of the MFA devices, reading the selection from in
+func pickMfaDevice(in io.Reader, out io.Writer, devices []string) (string, error) {
+	fmt.Fprintln(out, "Multiple MFA devices found:")
+	for i, d := range devices {
+		fmt.Fprintf(out, "  %d) %s\n", i+1, d)
+	}
+
+	r := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "Select MFA device [1-%d]: ", len(devices))
+		l, err := r.ReadString('\n')
+		if n, e := strconv.Atoi(strings.TrimSpace(l)); e == nil && n > 0 && n <= len(devices) {
+			return devices[n-1], nil
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("no MFA device selected")
+		}
+	}
+}
+
+// deviceTokenProvider returns an MFA token provider using the token provider configured for the MFA device with the
+// serial number returned by the serial function.  The serial function is called when the MFA code is needed, since
+// the device may not be known until then.
+func deviceTokenProvider(serial func() string) func() (string, error) {
+	return func() (string, error) {
+		return newTokenProvider(cfg.MfaDeviceConfig(serial()))()
+	}
+}
+
+// newTokenProvider returns the MFA token provider configured in c.  MFA prompts must not be written to stdout when it's
+// reserved for the credential_process JSON output, so the tty provider is used in place of stdin.
+func newTokenProvider(c *config.AwsConfig) func() (string, error) {
+	t := strings.ToLower(c.MfaTokenProvider)
+	if *credProcess && (len(t) < 1 || t == credlib.StdinTokenProviderType) {
+		return credlib.TtyTokenProvider
+	}
+
+	p, err := credlib.NewTokenProvider(t, &credlib.TokenProviderOptions{Command: c.MfaTokenCommand,
+		SecretFile: c.MfaTotpSecretFile, SecretCommand: c.MfaTotpSecretCommand, StateDir: cacheDir()})
+	if err != nil {
+		log.Fatalf("Error configuring MFA token provider: %v", err)
+	}
+	return p
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/mmmorris1975/aws-runas/lib/config"
+	credlib "github.com/mmmorris1975/aws-runas/lib/credentials"
+	"strings"
+	"testing"
+)
+
+func TestMfaSerialProvider(t *testing.T) {
+	origUsr := usr
+	defer func() { usr = origUsr; cfg.MfaSerial = "" }()
+
+	t.Run("not a user", func(t *testing.T) {
+		usr = &credlib.AwsIdentity{IdentityType: "role"}
+		if mfaSerialProvider() != nil {
+			t.Error("received serial provider for non-user identity")
+		}
+	})
+
+	t.Run("serial configured", func(t *testing.T) {
+		usr = &credlib.AwsIdentity{IdentityType: "user"}
+		cfg.MfaSerial = "arn:aws:iam::123456789012:mfa/bob"
+		defer func() { cfg.MfaSerial = "" }()
+
+		if mfaSerialProvider() != nil {
+			t.Error("received serial provider with mfa_serial set")
+		}
+	})
+
+	t.Run("discover", func(t *testing.T) {
+		usr = &credlib.AwsIdentity{IdentityType: "user"}
+		if mfaSerialProvider() == nil {
+			t.Error("nil serial provider")
+		}
+	})
+}
+
+func TestSelectMfaDevice(t *testing.T) {
+	defer func() { cfg.MfaSerials = nil; mfaDevice = nil; *credProcess = false }()
+
+	t.Run("single serial", func(t *testing.T) {
+		mfaDevice = nil
+		cfg.MfaSerials = []string{"arn:aws:iam::123456789012:mfa/phone"}
+
+		sn, err := selectMfaDevice()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if sn != "arn:aws:iam::123456789012:mfa/phone" {
+			t.Error("bad mfa device")
+		}
+
+		// the selection is remembered
+		cfg.MfaSerials = []string{"arn:aws:iam::123456789012:mfa/other"}
+		if sn, _ = selectMfaDevice(); sn != "arn:aws:iam::123456789012:mfa/phone" {
+			t.Error("mfa device selection not reused")
+		}
+	})
+
+	t.Run("multiple with credential process", func(t *testing.T) {
+		mfaDevice = nil
+		cfg.MfaSerials = []string{"arn:aws:iam::123456789012:mfa/phone", "arn:aws:iam::123456789012:mfa/yubikey"}
+		*credProcess = true
+
+		if _, err := selectMfaDevice(); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
+
+func TestPickMfaDevice(t *testing.T) {
+	devices := []string{"arn:aws:iam::123456789012:mfa/phone", "arn:aws:iam::123456789012:mfa/yubikey"}
+
+	t.Run("good", func(t *testing.T) {
+		out := new(strings.Builder)
+		d, err := pickMfaDevice(strings.NewReader("3\nx\n2\n"), out, devices)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if d != devices[1] {
+			t.Error("wrong device selected")
+		}
+
+		if strings.Count(out.String(), "Select MFA device [1-2]: ") != 3 {
+			t.Error("invalid selections did not re-prompt")
+		}
+	})
+
+	t.Run("no selection", func(t *testing.T) {
+		if _, err := pickMfaDevice(strings.NewReader(""), new(strings.Builder), devices); err == nil {
+			t.Error("did not receive expected error")
+		}
+	})
+}
+
+func TestDeviceTokenProvider(t *testing.T) {
+	origCfg := cfg
+	defer func() { cfg = origCfg }()
+
+	cfg = &config.AwsConfig{MfaDevices: map[string]*config.MfaDevice{
+		"yubikey": {MfaTokenProvider: credlib.CommandTokenProviderType, MfaTokenCommand: "echo 654321"},
+	}}
+
+	serial := aws.String("arn:aws:iam::123456789012:mfa/yubikey")
+	c, err := deviceTokenProvider(func() string { return *serial })()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if c != "654321" {
+		t.Error("device token provider not used")
+	}
+}
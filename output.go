@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mmmorris1975/aws-runas/lib/config"
+	"io"
+	"os"
+	"runtime"
+	"time"
+)
+
+// credential output formats for the --output option
+const (
+	autoOutput        = "auto"
+	shOutput          = "sh"
+	fishOutput        = "fish"
+	powershellOutput  = "powershell"
+	envOutput         = "env"
+	jsonOutput        = "json"
+	credentialsOutput = "credentials"
+)
+
+var outputFormats = []string{autoOutput, shOutput, fishOutput, powershellOutput, envOutput, jsonOutput, credentialsOutput}
+
+// expiration time of the credentials being printed, only used by the json output format
+var credExpiration time.Time
+
+// credentialProcessOutput is the JSON document expected by the AWS SDK credential_process configuration
+type credentialProcessOutput struct {
+	Version         int
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string `json:",omitempty"`
+	Expiration      string `json:",omitempty"`
+}
+
+func printCredentials() {
+	if err := writeCredentials(os.Stdout, *outputFormat); err != nil {
+		log.Errorf("Error printing credentials: %v", err)
+	}
+}
+
+// writeCredentials writes the credentials found in the AWS env vars to w in the requested format
+func writeCredentials(w io.Writer, format string) error {
+	switch format {
+	case jsonOutput:
+		return writeJSONCredentials(w)
+	case credentialsOutput:
+		return writeCredentialsFile(w)
+	}
+
+	lineFmt := envLineFormat(format)
+	envVars := []string{
+		config.RegionEnvVar, config.DefaultRegionEnvVar,
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY",
+		"AWS_SESSION_TOKEN", "AWS_SECURITY_TOKEN",
+	}
+
+	for _, v := range envVars {
+		val, ok := os.LookupEnv(v)
+		if ok {
+			if _, err := fmt.Fprintf(w, lineFmt, v, val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// envLineFormat returns the Printf format used to set an environment variable (name and value) in the requested format
+func envLineFormat(format string) string {
+	switch format {
+	case shOutput:
+		return "export %s='%s'\n"
+	case fishOutput:
+		return "set -gx %s '%s';\n"
+	case powershellOutput:
+		return "$env:%s='%s'\n"
+	case envOutput:
+		return "%s=%s\n"
+	}
+
+	if runtime.GOOS == "windows" {
+		// SHELL env var is not set by default in "normal" Windows cmd.exe and PowerShell sessions.
+		// If we detect it, assume we're running under something like git-bash (or maybe Cygwin?)
+		// and fall through to using linux-style env var setting syntax
+		if len(os.Getenv("SHELL")) < 1 {
+			return "set %s='%s'\n"
+		}
+	}
+	return "export %s='%s'\n"
+}
+
+func writeJSONCredentials(w io.Writer) error {
+	o := &credentialProcessOutput{
+		Version:         1,
+		AccessKeyId:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	if !credExpiration.IsZero() {
+		o.Expiration = credExpiration.UTC().Format(time.RFC3339)
+	}
+
+	return json.NewEncoder(w).Encode(o)
+}
+
+// write a profile section suitable for the SDK credentials file, using the profile name as the section name
+func writeCredentialsFile(w io.Writer) error {
+	p := "default"
+	if profile != nil && len(*profile) > 0 {
+		p = *profile
+	}
+
+	if _, err := fmt.Fprintf(w, "[%s]\n", p); err != nil {
+		return err
+	}
+
+	keys := [][]string{
+		{"aws_access_key_id", "AWS_ACCESS_KEY_ID"},
+		{"aws_secret_access_key", "AWS_SECRET_ACCESS_KEY"},
+		{"aws_session_token", "AWS_SESSION_TOKEN"},
+	}
+
+	for _, k := range keys {
+		if v, ok := os.LookupEnv(k[1]); ok {
+			if _, err := fmt.Fprintf(w, "%s = %s\n", k[0], v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
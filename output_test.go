@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setCredentialEnv() func() {
+	env := map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKIAMOCK",
+		"AWS_SECRET_ACCESS_KEY": "SecretKey",
+		"AWS_SESSION_TOKEN":     "Token",
+		"AWS_REGION":            "us-east-1",
+	}
+
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+
+	return func() {
+		for k := range env {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+func Example_writeCredentialsFish() {
+	defer setCredentialEnv()()
+	writeCredentials(os.Stdout, fishOutput)
+	// Output:
+	// set -gx AWS_REGION 'us-east-1';
+	// set -gx AWS_ACCESS_KEY_ID 'AKIAMOCK';
+	// set -gx AWS_SECRET_ACCESS_KEY 'SecretKey';
+	// set -gx AWS_SESSION_TOKEN 'Token';
+}
+
+func Example_writeCredentialsPowershell() {
+	defer setCredentialEnv()()
+	writeCredentials(os.Stdout, powershellOutput)
+	// Output:
+	// $env:AWS_REGION='us-east-1'
+	// $env:AWS_ACCESS_KEY_ID='AKIAMOCK'
+	// $env:AWS_SECRET_ACCESS_KEY='SecretKey'
+	// $env:AWS_SESSION_TOKEN='Token'
+}
+
+func Example_writeCredentialsEnv() {
+	defer setCredentialEnv()()
+	writeCredentials(os.Stdout, envOutput)
+	// Output:
+	// AWS_REGION=us-east-1
+	// AWS_ACCESS_KEY_ID=AKIAMOCK
+	// AWS_SECRET_ACCESS_KEY=SecretKey
+	// AWS_SESSION_TOKEN=Token
+}
+
+func Example_writeCredentialsFile() {
+	defer setCredentialEnv()()
+	writeCredentials(os.Stdout, credentialsOutput)
+	// Output:
+	// [x]
+	// aws_access_key_id = AKIAMOCK
+	// aws_secret_access_key = SecretKey
+	// aws_session_token = Token
+}
+
+func TestWriteJSONCredentials(t *testing.T) {
+	defer setCredentialEnv()()
+
+	t.Run("expiration", func(t *testing.T) {
+		credExpiration = time.Date(2019, 6, 8, 13, 20, 0, 0, time.UTC)
+		defer func() { credExpiration = time.Time{} }()
+
+		b := new(strings.Builder)
+		if err := writeCredentials(b, jsonOutput); err != nil {
+			t.Error(err)
+			return
+		}
+
+		o := new(credentialProcessOutput)
+		if err := json.Unmarshal([]byte(b.String()), o); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if o.Version != 1 || o.AccessKeyId != "AKIAMOCK" || o.SecretAccessKey != "SecretKey" || o.SessionToken != "Token" {
+			t.Errorf("bad credentials: %s", b.String())
+		}
+
+		if o.Expiration != "2019-06-08T13:20:00Z" {
+			t.Errorf("bad expiration: %s", o.Expiration)
+		}
+	})
+
+	t.Run("no expiration", func(t *testing.T) {
+		b := new(strings.Builder)
+		if err := writeCredentials(b, jsonOutput); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if strings.Contains(b.String(), "Expiration") {
+			t.Errorf("unexpected expiration: %s", b.String())
+		}
+	})
+}
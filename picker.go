@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/mmmorris1975/aws-runas/internal/tty"
+	"github.com/mmmorris1975/aws-runas/lib/cache"
+	"github.com/mmmorris1975/aws-runas/lib/config"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+)
+
+const (
+	recentProfilesFile = ".aws_runas_recent_profiles"
+	maxRecentProfiles  = 10
+	pickerRows         = 10
+	pickerPrompt       = "Profile> "
+)
+
+// pickerEntry is a profile shown by the interactive profile picker
+type pickerEntry struct {
+	Profile    string
+	RoleArn    string
+	Region     string
+	Expiration time.Time
+}
+
+// expires returns the remaining lifetime of the cached credentials for the profile
+func (e *pickerEntry) expires() string {
+	switch {
+	case e.Expiration.IsZero():
+		return "-"
+	case time.Until(e.Expiration) <= 0:
+		return "expired"
+	default:
+		return time.Until(e.Expiration).Round(time.Second).String()
+	}
+}
+
+// usePicker returns true if the profile should be selected using the interactive profile picker.  The picker is only
+// used when the profile is not set on the command line or in the environment, for running a command or printing
+// assume role credentials from a terminal session.  Session token credentials don't use a role, so the picker is not
+// used with --session.
+func usePicker() bool {
+	if len(*profile) > 0 || *sesCreds || *credProcess || *agentFlag || *agentFgFlag {
+		return false
+	}
+
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	return !(*listRoles || *listMfa || *makeConf || *writeConf || *updateFlag || *diagFlag || *ec2MdFlag ||
+		*ecsMdFlag || *listCache || len(*purgeCache) > 0)
+}
+
+// pickProfile prompts the user on the terminal to select one of the profiles with a role_arn in the config file, and
+// returns the selected profile.  An empty string is returned if the picker can't be used, or the selection is
+// cancelled, so the default profile is used, as before.
+func pickProfile() string {
+	entries := pickerEntries()
+	if len(entries) < 1 {
+		log.Debug("No role profiles found for profile picker")
+		return ""
+	}
+
+	recentFile := cacheFile(recentProfilesFile)
+	recent := readRecentProfiles(recentFile)
+	sortPickerEntries(entries, recent)
+
+	in, out, err := tty.Open()
+	if err != nil {
+		log.Debugf("Unable to open terminal for profile picker: %v", err)
+		return ""
+	}
+	defer in.Close()
+	defer out.Close()
+
+	restore, err := rawMode(in, out)
+	if err != nil {
+		log.Debugf("Unable to configure terminal for profile picker: %v", err)
+		return ""
+	}
+
+	p, err := runPicker(in, out, entries)
+	restore()
+	if err != nil {
+		log.Debugf("%v, using default profile", err)
+		return ""
+	}
+	log.Debugf("PICKED PROFILE: %s", p)
+
+	if err := writeRecentProfiles(recentFile, addRecentProfile(recent, p)); err != nil {
+		log.Debugf("Error saving recent profiles: %v", err)
+	}
+	return p
+}
+
+// pickerEntries returns the profiles in the config file which set role_arn, with the expiration of any cached
+// credentials for the profile
+func pickerEntries() []*pickerEntry {
+	entries := make([]*pickerEntry, 0)
+
+	r, err := config.NewConfigResolver(nil)
+	if err != nil {
+		log.Debugf("Error loading config file: %v", err)
+		return entries
+	}
+
+	exp := make(map[string]time.Time)
+	if ce, err := cache.FindCacheEntries(nil, cacheDir()); err == nil {
+		for _, e := range ce {
+			if e.Type == cache.AssumeRoleEntryType && e.Readable {
+				exp[e.Profile] = e.Expiration
+			}
+		}
+	}
+
+	for _, p := range r.ListProfiles(true) {
+		c, err := r.ResolveConfig(p)
+		if err != nil {
+			log.Debugf("Error resolving profile %s: %v", p, err)
+			continue
+		}
+		entries = append(entries, &pickerEntry{Profile: p, RoleArn: c.RoleArn, Region: c.Region, Expiration: exp[p]})
+	}
+	return entries
+}
+
+// sortPickerEntries orders the entries with the recently selected profiles first, most recent first, followed by the
+// remaining profiles sorted by name
+func sortPickerEntries(entries []*pickerEntry, recent []string) {
+	rank := make(map[string]int)
+	for i, p := range recent {
+		rank[p] = i + 1
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := rank[entries[i].Profile], rank[entries[j].Profile]
+		switch {
+		case a > 0 && b > 0:
+			return a < b
+		case a > 0 || b > 0:
+			return a > 0
+		default:
+			return entries[i].Profile < entries[j].Profile
+		}
+	})
+}
+
+// runPicker draws the picker on out, reading key presses from in until a profile is selected.  Typed characters filter
+// the list, the up and down arrow keys (or Ctrl-P and Ctrl-N) move the selection, and Enter selects the profile.
+// Esc or Ctrl-C cancels the selection, returning an error.
+func runPicker(in io.Reader, out io.Writer, entries []*pickerEntry) (string, error) {
+	r := bufio.NewReader(in)
+	query := make([]rune, 0)
+	sel := 0
+
+	for {
+		matches := filterPickerEntries(entries, string(query))
+		if sel >= len(matches) {
+			sel = len(matches) - 1
+		}
+		if sel < 0 {
+			sel = 0
+		}
+		drawPicker(out, string(query), matches, sel)
+
+		c, _, err := r.ReadRune()
+		if err != nil {
+			clearPicker(out)
+			return "", fmt.Errorf("no profile selected")
+		}
+
+		switch c {
+		case '\r', '\n':
+			if len(matches) > 0 {
+				clearPicker(out)
+				return matches[sel].Profile, nil
+			}
+		case 0x03, 0x04:
+			clearPicker(out)
+			return "", fmt.Errorf("profile selection cancelled")
+		case 0x7f, 0x08:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				sel = 0
+			}
+		case 0x15:
+			query = query[:0]
+			sel = 0
+		case 0x0e:
+			sel++
+		case 0x10:
+			sel--
+		case 0x1b:
+			// arrow keys are sent as the escape sequence ESC [ A (or ESC O A), a lone ESC cancels the picker
+			if r.Buffered() < 2 {
+				clearPicker(out)
+				return "", fmt.Errorf("profile selection cancelled")
+			}
+
+			b, _ := r.Peek(2)
+			if b[0] == '[' || b[0] == 'O' {
+				r.Discard(2)
+				switch b[1] {
+				case 'A':
+					sel--
+				case 'B':
+					sel++
+				}
+			}
+		default:
+			if unicode.IsPrint(c) {
+				query = append(query, c)
+				sel = 0
+			}
+		}
+	}
+}
+
+// drawPicker replaces the previous picker output with the query prompt and the matching entries.  The cursor is left
+// on the prompt line, where the next call starts drawing.
+func drawPicker(out io.Writer, query string, matches []*pickerEntry, sel int) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "\r\x1b[J%s%s", pickerPrompt, query)
+
+	// scroll the list to keep the selection visible
+	start := 0
+	if sel >= pickerRows {
+		start = sel - pickerRows + 1
+	}
+	end := start + pickerRows
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	rows := new(bytes.Buffer)
+	tw := tabwriter.NewWriter(rows, 0, 4, 2, ' ', 0)
+	for i := start; i < end; i++ {
+		m := "  "
+		if i == sel {
+			m = "> "
+		}
+		e := matches[i]
+		fmt.Fprintf(tw, "%s%s\t%s\t%s\t%s\n", m, e.Profile, dashIfEmpty(e.RoleArn), dashIfEmpty(e.Region), e.expires())
+	}
+	tw.Flush()
+
+	n := 0
+	for _, l := range strings.Split(strings.TrimSuffix(rows.String(), "\n"), "\n") {
+		if len(l) > 0 {
+			fmt.Fprintf(buf, "\r\n%s", l)
+			n++
+		}
+	}
+
+	if n < 1 {
+		fmt.Fprint(buf, "\r\n  no matching profiles")
+		n++
+	}
+
+	// leave the cursor at the end of the query
+	fmt.Fprintf(buf, "\x1b[%dA\r\x1b[%dC", n, len(pickerPrompt)+len([]rune(query)))
+	out.Write(buf.Bytes())
+}
+
+// clearPicker removes the picker output from the terminal
+func clearPicker(out io.Writer) {
+	fmt.Fprint(out, "\r\x1b[J")
+}
+
+// filterPickerEntries returns the entries with a profile name or role ARN fuzzy matching the query, best matches first.
+// Entries with an equal score keep their order, so all entries are returned in their original order for an empty query.
+func filterPickerEntries(entries []*pickerEntry, query string) []*pickerEntry {
+	type match struct {
+		e     *pickerEntry
+		score int
+	}
+
+	matches := make([]match, 0, len(entries))
+	for _, e := range entries {
+		s, ok := fuzzyScore(query, e.Profile)
+		if a, aok := fuzzyScore(query, e.RoleArn); aok && (!ok || a > s) {
+			s, ok = a, true
+		}
+
+		if ok {
+			matches = append(matches, match{e, s})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	res := make([]*pickerEntry, len(matches))
+	for i, m := range matches {
+		res[i] = m.e
+	}
+	return res
+}
+
+// fuzzyScore returns true if all of the characters of the pattern appear in s, in order, ignoring case.  The score
+// favors consecutive characters, and characters at the start of a word in s.
+func fuzzyScore(pattern, s string) (int, bool) {
+	p := []rune(strings.ToLower(pattern))
+	if len(p) < 1 {
+		return 0, true
+	}
+
+	score := 0
+	i := 0
+	prev := -2
+	str := []rune(strings.ToLower(s))
+	for j, c := range str {
+		if c != p[i] {
+			continue
+		}
+
+		score++
+		if prev == j-1 {
+			score += 2
+		}
+		if j == 0 || strings.ContainsRune("-_/:. ", str[j-1]) {
+			score += 3
+		}
+		prev = j
+
+		i++
+		if i == len(p) {
+			return score, true
+		}
+	}
+	return 0, false
+}
+
+// readRecentProfiles returns the recently selected profiles from the file, most recent first
+func readRecentProfiles(file string) []string {
+	recent := make([]string, 0)
+
+	f, err := os.Open(file)
+	if err != nil {
+		return recent
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if l := strings.TrimSpace(s.Text()); len(l) > 0 {
+			recent = append(recent, l)
+		}
+	}
+	return recent
+}
+
+// addRecentProfile returns the list of recent profiles with p as the most recent, keeping at most maxRecentProfiles
+func addRecentProfile(recent []string, p string) []string {
+	res := []string{p}
+	for _, r := range recent {
+		if r != p && len(res) < maxRecentProfiles {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// writeRecentProfiles saves the recently selected profiles to the file
+func writeRecentProfiles(file string, recent []string) error {
+	return ioutil.WriteFile(file, []byte(strings.Join(recent, "\n")+"\n"), 0600)
+}
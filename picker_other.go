@@ -0,0 +1,14 @@
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// rawMode is not supported on this platform, so the profile picker is not used
+func rawMode(in, out *os.File) (func(), error) {
+	return nil, fmt.Errorf("the profile picker is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testPickerEntries() []*pickerEntry {
+	return []*pickerEntry{
+		{Profile: "dev-admin", RoleArn: "arn:aws:iam::111111111111:role/Admin", Region: "us-east-2"},
+		{Profile: "prod-admin", RoleArn: "arn:aws:iam::222222222222:role/Admin", Region: "us-west-2"},
+		{Profile: "prod-readonly", RoleArn: "arn:aws:iam::222222222222:role/ReadOnly"},
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	t.Run("match", func(t *testing.T) {
+		if _, ok := fuzzyScore("PrdRO", "prod-readonly"); !ok {
+			t.Error("did not match")
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		if _, ok := fuzzyScore("ord", "prod-admin-x"); ok {
+			t.Error("unexpected match")
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if _, ok := fuzzyScore("", "prod-admin"); !ok {
+			t.Error("did not match")
+		}
+	})
+
+	t.Run("word start", func(t *testing.T) {
+		a, _ := fuzzyScore("pa", "prod-admin")
+		b, _ := fuzzyScore("pa", "dev-ops-alpha")
+		if a <= b {
+			t.Errorf("unexpected scores: %d <= %d", a, b)
+		}
+	})
+}
+
+func TestFilterPickerEntries(t *testing.T) {
+	t.Run("empty query", func(t *testing.T) {
+		e := testPickerEntries()
+		if !reflect.DeepEqual(filterPickerEntries(e, ""), e) {
+			t.Error("unexpected entries")
+		}
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		m := filterPickerEntries(testPickerEntries(), "prad")
+		if len(m) != 2 || m[0].Profile != "prod-admin" {
+			t.Errorf("unexpected matches: %v", m)
+		}
+	})
+
+	t.Run("role arn", func(t *testing.T) {
+		m := filterPickerEntries(testPickerEntries(), "1111")
+		if len(m) != 1 || m[0].Profile != "dev-admin" {
+			t.Errorf("unexpected matches: %v", m)
+		}
+	})
+}
+
+func TestSortPickerEntries(t *testing.T) {
+	e := testPickerEntries()
+	sortPickerEntries(e, []string{"prod-readonly", "gone", "dev-admin"})
+
+	if e[0].Profile != "prod-readonly" || e[1].Profile != "dev-admin" || e[2].Profile != "prod-admin" {
+		t.Errorf("unexpected order: %s, %s, %s", e[0].Profile, e[1].Profile, e[2].Profile)
+	}
+}
+
+func TestRunPicker(t *testing.T) {
+	t.Run("enter", func(t *testing.T) {
+		p, err := runPicker(strings.NewReader("\r"), ioutil.Discard, testPickerEntries())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if p != "dev-admin" {
+			t.Errorf("unexpected profile: %s", p)
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		p, err := runPicker(strings.NewReader("prx\x7fro\r"), ioutil.Discard, testPickerEntries())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if p != "prod-readonly" {
+			t.Errorf("unexpected profile: %s", p)
+		}
+	})
+
+	t.Run("arrow keys", func(t *testing.T) {
+		p, err := runPicker(strings.NewReader("\x1b[B\x1b[B\x1b[B\x1b[A\r"), ioutil.Discard, testPickerEntries())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if p != "prod-admin" {
+			t.Errorf("unexpected profile: %s", p)
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		if _, err := runPicker(strings.NewReader("zzz\r"), ioutil.Discard, testPickerEntries()); err == nil {
+			t.Error("did not see expected error")
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		if _, err := runPicker(strings.NewReader("\x1b"), ioutil.Discard, testPickerEntries()); err == nil {
+			t.Error("did not see expected error")
+		}
+	})
+}
+
+func TestPickerEntry_Expires(t *testing.T) {
+	t.Run("not cached", func(t *testing.T) {
+		if e := new(pickerEntry).expires(); e != "-" {
+			t.Errorf("unexpected expiration: %s", e)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		e := &pickerEntry{Expiration: time.Now().Add(-1 * time.Minute)}
+		if e.expires() != "expired" {
+			t.Errorf("unexpected expiration: %s", e.expires())
+		}
+	})
+}
+
+func TestRecentProfiles(t *testing.T) {
+	f := filepath.Join(os.TempDir(), "aws-runas-recent-test")
+	defer os.Remove(f)
+
+	if r := readRecentProfiles(f); len(r) > 0 {
+		t.Errorf("unexpected recent profiles: %v", r)
+		return
+	}
+
+	recent := make([]string, 0)
+	for _, p := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "c"} {
+		recent = addRecentProfile(recent, p)
+	}
+
+	if err := writeRecentProfiles(f, recent); err != nil {
+		t.Error(err)
+		return
+	}
+
+	r := readRecentProfiles(f)
+	if len(r) != maxRecentProfiles || r[0] != "c" || r[1] != "k" || r[len(r)-1] != "b" {
+		t.Errorf("unexpected recent profiles: %v", r)
+	}
+}
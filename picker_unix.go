@@ -0,0 +1,30 @@
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package main
+
+import (
+	"github.com/mmmorris1975/aws-runas/internal/tty"
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+// rawMode disables line buffering, echo and signal generation on the terminal, so the profile picker can handle each
+// key press.  The returned function restores the original terminal settings.
+func rawMode(in, out *os.File) (func(), error) {
+	fd := int(in.Fd())
+	t, err := unix.IoctlGetTermios(fd, tty.IoctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	orig := *t
+	t.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Iflag &^= unix.ICRNL | unix.IXON
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, tty.IoctlSetTermios, t); err != nil {
+		return nil, err
+	}
+
+	return func() { unix.IoctlSetTermios(fd, tty.IoctlSetTermios, &orig) }, nil
+}
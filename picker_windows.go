@@ -0,0 +1,49 @@
+// +build windows
+
+package main
+
+import (
+	"github.com/mmmorris1975/aws-runas/internal/tty"
+	"os"
+	"syscall"
+)
+
+const (
+	enableProcessedInput            = 0x1
+	enableLineInput                 = 0x2
+	enableEchoInput                 = 0x4
+	enableVirtualTerminalInput      = 0x200
+	enableVirtualTerminalProcessing = 0x4
+)
+
+// rawMode disables line buffering, echo and Ctrl-C processing on the console, so the profile picker can handle each
+// key press.  Virtual terminal sequences are enabled for the arrow keys and redrawing the picker.  The returned
+// function restores the original console settings.
+func rawMode(in, out *os.File) (func(), error) {
+	hIn := syscall.Handle(in.Fd())
+	hOut := syscall.Handle(out.Fd())
+
+	var inMode, outMode uint32
+	if err := syscall.GetConsoleMode(hIn, &inMode); err != nil {
+		return nil, err
+	}
+
+	if err := syscall.GetConsoleMode(hOut, &outMode); err != nil {
+		return nil, err
+	}
+
+	mode := inMode&^(enableProcessedInput|enableLineInput|enableEchoInput) | enableVirtualTerminalInput
+	if err := tty.SetConsoleMode(hIn, mode); err != nil {
+		return nil, err
+	}
+
+	if err := tty.SetConsoleMode(hOut, outMode|enableVirtualTerminalProcessing); err != nil {
+		tty.SetConsoleMode(hIn, inMode)
+		return nil, err
+	}
+
+	return func() {
+		tty.SetConsoleMode(hIn, inMode)
+		tty.SetConsoleMode(hOut, outMode)
+	}, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/mmmorris1975/aws-runas/lib/config"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// roleListEntry is the detail of a single role printed by --list-roles when the --list-format option is used
+type roleListEntry struct {
+	Arn          string             `json:"arn"`
+	AccountID    string             `json:"account_id"`
+	AccountAlias string             `json:"account_alias,omitempty"`
+	RoleName     string             `json:"role_name"`
+	Path         string             `json:"path"`
+	Profiles     []*roleListProfile `json:"profiles"`
+	Conditions   []string           `json:"conditions,omitempty"`
+	Decision     string             `json:"decision,omitempty"`
+}
+
+// roleListProfile is a profile in the config file which uses the role
+type roleListProfile struct {
+	Name       string `json:"name"`
+	Mfa        bool   `json:"mfa"`
+	ExternalID bool   `json:"external_id"`
+
+	externalID string
+}
+
+// roleProfiles returns the profiles in the config file which set role_arn, keyed by the role ARN
+func roleProfiles() map[string][]*roleListProfile {
+	m := make(map[string][]*roleListProfile)
+
+	r, err := config.NewConfigResolver(nil)
+	if err != nil {
+		log.Debugf("Error loading config file: %v", err)
+		return m
+	}
+
+	for _, p := range r.ListProfiles(true) {
+		c, err := r.ResolveConfig(p)
+		if err != nil {
+			log.Debugf("Error resolving profile %s: %v", p, err)
+			continue
+		}
+
+		m[c.RoleArn] = append(m[c.RoleArn], &roleListProfile{Name: p,
+			Mfa: len(c.MfaSerial) > 0 || len(c.MfaSerials) > 0, ExternalID: len(c.ExternalID) > 0, externalID: c.ExternalID})
+	}
+	return m
+}
+
+// roleExternalID returns the external ID set by the first of the profiles which has one
+func roleExternalID(profiles []*roleListProfile) string {
+	for _, p := range profiles {
+		if len(p.externalID) > 0 {
+			return p.externalID
+		}
+	}
+	return ""
+}
+
+// newRoleListEntry returns the roleListEntry for the role ARN, using the account alias and profile mappings
+func newRoleListEntry(role string, aliases map[string]string, profiles map[string][]*roleListProfile) *roleListEntry {
+	e := &roleListEntry{Arn: role, Profiles: profiles[role]}
+	if e.Profiles == nil {
+		e.Profiles = make([]*roleListProfile, 0)
+	}
+
+	a, err := arn.Parse(role)
+	if err != nil {
+		return e
+	}
+
+	e.AccountID = a.AccountID
+	e.AccountAlias = aliases[a.AccountID]
+
+	// the role resource is role/<path>/<name>, where the path is optional
+	res := strings.TrimPrefix(a.Resource, "role")
+	i := strings.LastIndex(res, "/")
+	e.RoleName = res[i+1:]
+	e.Path = res[:i+1]
+	return e
+}
+
+// printRoleList writes the role details to w as a table, or as JSON if the format is json
+func printRoleList(entries []*roleListEntry, w io.Writer, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACCOUNT\tALIAS\tROLE\tPATH\tPROFILES\tMFA\tEXTERNAL ID\tACCESS")
+	for _, e := range entries {
+		names := make([]string, 0, len(e.Profiles))
+		var mfa, extID bool
+		for _, p := range e.Profiles {
+			names = append(names, p.Name)
+			mfa = mfa || p.Mfa
+			extID = extID || p.ExternalID
+		}
+
+		access := e.Decision
+		if len(access) < 1 {
+			access = strings.Join(e.Conditions, ", ")
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", dashIfEmpty(e.AccountID), dashIfEmpty(e.AccountAlias),
+			dashIfEmpty(e.RoleName), dashIfEmpty(e.Path), dashIfEmpty(strings.Join(names, ",")), yesNo(mfa, len(names)),
+			yesNo(extID, len(names)), dashIfEmpty(access))
+	}
+	return tw.Flush()
+}
+
+// yesNo returns yes or no for the setting, or a dash if there are no profiles to have the setting
+func yesNo(b bool, profiles int) string {
+	switch {
+	case profiles < 1:
+		return "-"
+	case b:
+		return "yes"
+	default:
+		return "no"
+	}
+}
+
+// readAccountAliases reads the mapping of AWS account IDs to account aliases from r.  Each line is the account ID
+// and alias, separated by '='.  Blank lines, and lines starting with '#', are skipped.
+func readAccountAliases(r io.Reader) (map[string]string, error) {
+	m := make(map[string]string)
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if len(l) < 1 || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		f := strings.SplitN(l, "=", 2)
+		if len(f) < 2 {
+			return nil, fmt.Errorf("invalid account alias line: %s", l)
+		}
+		m[strings.TrimSpace(f[0])] = strings.TrimSpace(f[1])
+	}
+
+	return m, s.Err()
+}
+
+// accountAliasFile returns the account aliases from the file set by the account_alias_file attribute of the profile
+func accountAliasFile() map[string]string {
+	if cfg == nil || len(cfg.AccountAliasFile) < 1 {
+		return make(map[string]string)
+	}
+
+	f, err := os.Open(cfg.AccountAliasFile)
+	if err == nil {
+		defer f.Close()
+
+		var m map[string]string
+		if m, err = readAccountAliases(f); err == nil {
+			return m
+		}
+	}
+
+	log.Warnf("Error reading account alias file: %v", err)
+	return make(map[string]string)
+}
+
+// accountAliasCache is the content of the cache file of the account aliases looked up using the roles in each account.
+// An empty alias means the account has no alias, or none of its roles could be used to look it up.
+type accountAliasCache struct {
+	Expiration int64             `json:"expiration"`
+	Aliases    map[string]string `json:"aliases"`
+}
+
+// readAccountAliasCache returns the cached account aliases, or an empty map if there's no cache, or it's expired
+func readAccountAliasCache(path string) map[string]string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return make(map[string]string)
+	}
+
+	c := new(accountAliasCache)
+	if err := json.Unmarshal(data, c); err != nil || time.Now().Unix() >= c.Expiration || c.Aliases == nil {
+		return make(map[string]string)
+	}
+	return c.Aliases
+}
+
+func writeAccountAliasCache(path string, aliases map[string]string, ttl time.Duration) error {
+	data, err := json.Marshal(&accountAliasCache{Expiration: time.Now().Add(ttl).Unix(), Aliases: aliases})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// lookupAccountAliases calls lookup with the roles of each account which isn't in known or cache, until one of them
+// returns the account alias, and adds the aliases to cache.  Accounts where every role failed are added with an empty
+// alias, so they aren't tried again until the cache expires.  Returns true if any accounts were added to cache.
+func lookupAccountAliases(roles []string, known, cache map[string]string, lookup func(string) (string, error)) bool {
+	failed := make(map[string]bool)
+	var added bool
+
+	for _, r := range roles {
+		a, err := arn.Parse(r)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := known[a.AccountID]; ok {
+			continue
+		}
+
+		if _, ok := cache[a.AccountID]; ok {
+			continue
+		}
+
+		alias, err := lookup(r)
+		if err != nil {
+			log.Debugf("Error looking up account alias using %s: %v", r, err)
+			failed[a.AccountID] = true
+			continue
+		}
+
+		cache[a.AccountID] = alias
+		added = true
+	}
+
+	for k := range failed {
+		if _, ok := cache[k]; !ok {
+			cache[k] = ""
+			added = true
+		}
+	}
+	return added
+}
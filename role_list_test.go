@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Example_printRoleList() {
+	aliases := map[string]string{"123456789012": "prod"}
+	profiles := map[string][]*roleListProfile{
+		"arn:aws:iam::123456789012:role/Admin": {{Name: "prod-admin", Mfa: true}, {Name: "admin", ExternalID: true}},
+	}
+
+	a := newRoleListEntry("arn:aws:iam::123456789012:role/Admin", aliases, profiles)
+	a.Conditions = []string{"MFA required"}
+	b := newRoleListEntry("arn:aws:iam::210987654321:role/ops/ReadOnly", aliases, profiles)
+
+	printRoleList([]*roleListEntry{a, b}, os.Stdout, "table")
+	// Output:
+	// ACCOUNT       ALIAS  ROLE      PATH   PROFILES          MFA  EXTERNAL ID  ACCESS
+	// 123456789012  prod   Admin     /      prod-admin,admin  yes  yes          MFA required
+	// 210987654321  -      ReadOnly  /ops/  -                 -    -            -
+}
+
+func TestNewRoleListEntry(t *testing.T) {
+	t.Run("path", func(t *testing.T) {
+		e := newRoleListEntry("arn:aws:iam::123456789012:role/a/b/Role", nil, nil)
+		if e.AccountID != "123456789012" || e.RoleName != "Role" || e.Path != "/a/b/" || e.Profiles == nil {
+			t.Errorf("unexpected entry: %+v", e)
+		}
+	})
+
+	t.Run("not arn", func(t *testing.T) {
+		e := newRoleListEntry("role", nil, nil)
+		if e.Arn != "role" || len(e.AccountID) > 0 || len(e.RoleName) > 0 {
+			t.Errorf("unexpected entry: %+v", e)
+		}
+	})
+}
+
+func TestPrintRoleList(t *testing.T) {
+	e := newRoleListEntry("arn:aws:iam::123456789012:role/Admin", map[string]string{"123456789012": "prod"}, nil)
+	e.Decision = "allowed"
+
+	out := new(strings.Builder)
+	if err := printRoleList([]*roleListEntry{e}, out, "json"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	res := make([]map[string]interface{}, 0)
+	if err := json.Unmarshal([]byte(out.String()), &res); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(res) != 1 || res[0]["account_alias"] != "prod" || res[0]["role_name"] != "Admin" || res[0]["decision"] != "allowed" {
+		t.Errorf("unexpected json output: %s", out.String())
+	}
+}
+
+func TestReadAccountAliases(t *testing.T) {
+	t.Run("good", func(t *testing.T) {
+		m, err := readAccountAliases(strings.NewReader("# aliases\n123456789012 = prod\n\n210987654321=dev\n"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(m) != 2 || m["123456789012"] != "prod" || m["210987654321"] != "dev" {
+			t.Errorf("unexpected aliases: %v", m)
+		}
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		if _, err := readAccountAliases(strings.NewReader("123456789012 prod\n")); err == nil {
+			t.Error("did not see expected error")
+		}
+	})
+}
+
+func TestRoleExternalID(t *testing.T) {
+	p := []*roleListProfile{{Name: "a"}, {Name: "b", ExternalID: true, externalID: "ext"}}
+	if id := roleExternalID(p); id != "ext" {
+		t.Errorf("unexpected external id: %s", id)
+	}
+
+	if id := roleExternalID(nil); len(id) > 0 {
+		t.Errorf("unexpected external id: %s", id)
+	}
+}
+
+func TestLookupAccountAliases(t *testing.T) {
+	roles := []string{"arn:aws:iam::111111111111:role/Admin", "arn:aws:iam::222222222222:role/Denied",
+		"arn:aws:iam::222222222222:role/ReadOnly", "arn:aws:iam::333333333333:role/Denied",
+		"arn:aws:iam::444444444444:role/Admin", "arn:aws:iam::555555555555:role/Admin"}
+
+	calls := make([]string, 0)
+	lookup := func(r string) (string, error) {
+		calls = append(calls, r)
+		if strings.HasSuffix(r, "/Denied") {
+			return "", fmt.Errorf("AccessDenied")
+		}
+		return "alias-" + r[13:16], nil
+	}
+
+	known := map[string]string{"111111111111": "file"}
+	cache := map[string]string{"555555555555": ""}
+
+	if !lookupAccountAliases(roles, known, cache, lookup) {
+		t.Error("no aliases added")
+		return
+	}
+
+	if len(calls) != 4 {
+		t.Errorf("unexpected lookups: %v", calls)
+	}
+
+	if len(cache) != 4 || cache["222222222222"] != "alias-222" || cache["333333333333"] != "" ||
+		cache["444444444444"] != "alias-444" {
+		t.Errorf("unexpected aliases: %v", cache)
+	}
+
+	if lookupAccountAliases(roles, known, cache, lookup) {
+		t.Error("cached aliases looked up again")
+	}
+}
+
+func TestAccountAliasCache(t *testing.T) {
+	f := filepath.Join(os.TempDir(), "aws-runas-alias-cache-test")
+	defer os.Remove(f)
+
+	if m := readAccountAliasCache(f); len(m) > 0 {
+		t.Errorf("unexpected aliases: %v", m)
+		return
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		if err := writeAccountAliasCache(f, map[string]string{"123456789012": "prod"}, 1*time.Minute); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if m := readAccountAliasCache(f); m["123456789012"] != "prod" {
+			t.Errorf("unexpected aliases: %v", m)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		if err := writeAccountAliasCache(f, map[string]string{"123456789012": "prod"}, -1*time.Minute); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if m := readAccountAliasCache(f); len(m) > 0 {
+			t.Errorf("unexpected aliases: %v", m)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/mmmorris1975/aws-runas/lib/util"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// simulatedRoles finds the roles the user is able to assume using the IAM policy simulator, and prints the decision
+// for each candidate role when listing roles
+func simulatedRoles() util.Roles {
+	candidates, err := simulationCandidates()
+	if err != nil {
+		log.Fatalf("Error reading candidate roles: %v", err)
+	}
+
+	if len(candidates) < 1 {
+		log.Fatal("No candidate roles for --simulate, add profiles with role_arn to the config file, or use --role-file")
+	}
+	log.Debugf("CANDIDATE ROLES: %v", candidates)
+
+	s := util.NewRoleSimulator(ses, *usr.Identity.Arn, func(s *util.RoleSimulator) {
+		s.Accounts = cfg.RoleAccounts
+	}).WithLogger(log)
+	res := s.Simulate(candidates)
+
+	if *listRoles {
+		log.Debug("List Roles")
+		var err error
+		if len(*listFormat) > 0 {
+			profiles := roleProfiles()
+			aliases := roleAccountAliases(res.Allowed(), profiles)
+
+			entries := make([]*roleListEntry, 0, len(res))
+			for _, r := range res {
+				e := newRoleListEntry(r.Arn, aliases, profiles)
+				e.Decision = r.Decision
+				entries = append(entries, e)
+			}
+			err = printRoleList(entries, os.Stdout, *listFormat)
+		} else {
+			fmt.Printf("IAM policy simulation of role ARNs for %s (%s)\n", usr.UserName, *usr.Identity.Arn)
+			err = printSimulatedRoles(res, os.Stdout)
+		}
+
+		if err != nil {
+			log.Fatalf("Error printing roles: %v", err)
+		}
+	}
+
+	return res.Allowed()
+}
+
+// printSimulatedRoles writes the simulation decision for each role to w, along with any error simulating the role
+func printSimulatedRoles(res util.SimulatedRoles, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, r := range res {
+		d := r.Decision
+		if r.Error != nil {
+			d = fmt.Sprintf("%s (%v)", d, r.Error)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", r.Arn, d)
+	}
+	return tw.Flush()
+}
+
+// simulationCandidates returns the role ARNs of the profiles in the config file, along with the roles in the file
+// set by the --role-file option
+func simulationCandidates() (util.Roles, error) {
+	roles := make([]string, 0)
+
+	for r := range roleProfiles() {
+		roles = append(roles, r)
+	}
+
+	if len(*roleFile) > 0 {
+		f, err := os.Open(*roleFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		partition := "aws"
+		if a, err := arn.Parse(*usr.Identity.Arn); err == nil {
+			partition = a.Partition
+		}
+
+		r, err := readRoles(f, partition)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, r...)
+	}
+
+	return util.Roles(roles).Dedup(), nil
+}
+
+// readRoles reads the list of roles from r, one per line.  Blank lines, and lines starting with '#', are skipped.  A
+// line may be a role ARN, which can use a '*' in the account ID field to match any account, or a role name, which is
+// looked up in every account.
+func readRoles(r io.Reader, partition string) (util.Roles, error) {
+	roles := make([]string, 0)
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if len(l) < 1 || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		if !strings.HasPrefix(l, "arn:") {
+			l = fmt.Sprintf("arn:%s:iam::*:role/%s", partition, l)
+		}
+		roles = append(roles, l)
+	}
+
+	return roles, s.Err()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mmmorris1975/aws-runas/lib/util"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Example_printSimulatedRoles() {
+	res := util.SimulatedRoles{
+		{Arn: "arn:aws:iam::123456789012:role/Admin", Decision: util.DecisionAllowed},
+		{Arn: "arn:aws:iam::123456789012:role/Deny", Decision: util.DecisionExplicitDeny},
+		{Arn: "arn:aws:iam::123456789012:role/X", Decision: util.DecisionError, Error: fmt.Errorf("AccessDenied")},
+	}
+	printSimulatedRoles(res, os.Stdout)
+	// Output:
+	//   arn:aws:iam::123456789012:role/Admin  allowed
+	//   arn:aws:iam::123456789012:role/Deny   explicitDeny
+	//   arn:aws:iam::123456789012:role/X      error (AccessDenied)
+}
+
+func TestReadRoles(t *testing.T) {
+	t.Run("good", func(t *testing.T) {
+		in := "# candidate roles\narn:aws:iam::123456789012:role/Admin\n\n  ReadOnly  \narn:aws:iam::*:role/Dev\n"
+		r, err := readRoles(strings.NewReader(in), "aws-us-gov")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(r) != 3 || r[0] != "arn:aws:iam::123456789012:role/Admin" || r[1] != "arn:aws-us-gov:iam::*:role/ReadOnly" ||
+			r[2] != "arn:aws:iam::*:role/Dev" {
+			t.Errorf("unexpected roles: %v", r)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		r, err := readRoles(strings.NewReader(""), "aws")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(r) > 0 {
+			t.Errorf("unexpected roles: %v", r)
+		}
+	})
+}